@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bigKeysCount int
+)
+
+func init() {
+	bigKeysCmd.Flags().IntVarP(&bigKeysCount, "count", "c", 10, "number of keys to show")
+}
+
+var (
+	bigKeysCmd = &cobra.Command{
+		Use:   "bigkeys",
+		Short: "Show largest keys of namespace given with --namespace or of all namespaces",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("wrong args number")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			keys, err := cl.BigKeys(ctx, namespace, bigKeysCount)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(keys)
+			if err != nil {
+				return fmt.Errorf("output keys: %v", err)
+			}
+			return nil
+		},
+	}
+)
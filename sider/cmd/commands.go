@@ -1,23 +1,39 @@
 package cmd
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/aandryashin/sider/siderd/client"
 	"github.com/spf13/cobra"
+	"io/ioutil"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
 var (
-	ttl time.Duration
+	ttl     time.Duration
+	persist bool
+	yes     bool
+	getWait time.Duration
+
+	contentType string
 )
 
 func init() {
+	getCmd.Flags().DurationVarP(&getWait, "wait", "w", 0, "time to wait for the key to appear")
 	setCmd.Flags().DurationVarP(&ttl, "ttl", "", 0, "key expiration timeout")
-
+	setCmd.Flags().StringVarP(&contentType, "content-type", "", "", "content type of raw value, detected for @file values which are not json")
+	for _, cmd := range []*cobra.Command{renameCmd, copyCmd} {
+		cmd.Flags().DurationVarP(&ttl, "ttl", "", 0, "new expiration timeout, remaining timeout of the source key is kept by default")
+		cmd.Flags().BoolVarP(&persist, "persist", "", false, "remove expiration timeout")
+	}
+	flushCmd.Flags().BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation")
 }
 
 var (
@@ -28,7 +44,10 @@ var (
 			if len(args) != 0 {
 				return fmt.Errorf("wrong args number")
 			}
-			cl := &client.Client{siderURL}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
 			ctx, cancel := context.WithTimeout(context.Background(), timeout)
 			defer cancel()
 			keys, err := cl.Keys(ctx)
@@ -52,10 +71,32 @@ var (
 				return fmt.Errorf("missing key arg")
 			}
 			key := args[0]
-			cl := &client.Client{siderURL}
-			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			defer cancel()
-			v, err := cl.Get(ctx, key)
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			var v interface{}
+			if getWait > 0 {
+				ctx, cancel := context.WithTimeout(context.Background(), getWait)
+				defer cancel()
+				_, err = cl.Wait(ctx, key, "", &v)
+			} else {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				var b []byte
+				var ct string
+				b, ct, err = cl.GetBytes(ctx, key)
+				if err == nil && !isJSON(ct) {
+					_, err = os.Stdout.Write(b)
+					if err != nil {
+						return fmt.Errorf("output value: %v", err)
+					}
+					return nil
+				}
+				if err == nil {
+					err = json.Unmarshal(b, &v)
+				}
+			}
 			if err != nil {
 				return fmt.Errorf("client: %v", err)
 			}
@@ -79,11 +120,98 @@ var (
 				return fmt.Errorf("missing value arg")
 			default:
 			}
-			key, value := args[0], args[1]
-			cl := &client.Client{siderURL}
+			key, value := args[0], []byte(args[1])
+			ct := contentType
+			if strings.HasPrefix(args[1], "@") {
+				var err error
+				value, err = ioutil.ReadFile(args[1][1:])
+				if err != nil {
+					return fmt.Errorf("read value: %v", err)
+				}
+				if ct == "" && !json.Valid(value) {
+					ct = mime.TypeByExtension(filepath.Ext(args[1]))
+					if ct == "" {
+						ct = http.DetectContentType(value)
+					}
+				}
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.SetBytes(ctx, key, value, ct, ttl)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	existsCmd = &cobra.Command{
+		Use:   "exists",
+		Short: "Check whether the key exists",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing key arg")
+			}
+			key := args[0]
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			ok, err := cl.Exists(ctx, key)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return output(ok)
+		},
+	}
+	renameCmd = &cobra.Command{
+		Use:   "rename",
+		Short: "Rename the key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return renameOrCopy(args, (*client.Client).Rename)
+		},
+	}
+	copyCmd = &cobra.Command{
+		Use:   "copy",
+		Short: "Copy value to another key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return renameOrCopy(args, (*client.Client).Copy)
+		},
+	}
+	flushCmd = &cobra.Command{
+		Use:   "flush",
+		Short: "Delete all keys in namespace given with --namespace or in all namespaces",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("wrong args number")
+			}
+			scope := "all namespaces"
+			if namespace != "" {
+				scope = fmt.Sprintf("namespace %s", namespace)
+			}
+			if !yes {
+				fmt.Printf("Delete all keys in %s of %s? [y/N]: ", scope, siderURL)
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					return fmt.Errorf("flush cancelled")
+				}
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
 			ctx, cancel := context.WithTimeout(context.Background(), timeout)
 			defer cancel()
-			err := cl.Set(ctx, key, bytes.NewReader([]byte(value)), ttl)
+			if namespace != "" {
+				err = cl.Flush(ctx)
+			} else {
+				err = cl.FlushAll(ctx)
+			}
 			if err != nil {
 				return fmt.Errorf("client: %v", err)
 			}
@@ -98,10 +226,13 @@ var (
 				return fmt.Errorf("missing key arg")
 			}
 			key := args[0]
-			cl := &client.Client{siderURL}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
 			ctx, cancel := context.WithTimeout(context.Background(), timeout)
 			defer cancel()
-			err := cl.Del(ctx, key)
+			err = cl.Del(ctx, key)
 			if err != nil {
 				return fmt.Errorf("client: %v", err)
 			}
@@ -109,3 +240,40 @@ var (
 		},
 	}
 )
+
+func renameOrCopy(args []string, fn func(cl *client.Client, ctx context.Context, src string, dst string, ttl time.Duration) error) error {
+	switch len(args) {
+	case 0:
+		return fmt.Errorf("missing source and destination key args")
+	case 1:
+		return fmt.Errorf("missing destination key arg")
+	default:
+	}
+	cl, err := newClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	t := ttl
+	if persist {
+		t = client.Persist
+	}
+	err = fn(cl, ctx, args[0], args[1], t)
+	if err != nil {
+		return fmt.Errorf("client: %v", err)
+	}
+	return nil
+}
+
+func output(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(v)
+}
+
+// isJSON reports whether content type is json.
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mt == "application/json"
+}
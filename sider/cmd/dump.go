@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var (
+	restoreMode string
+)
+
+func init() {
+	restoreCmd.Flags().StringVarP(&restoreMode, "mode", "m", client.RestoreFail, "existing keys conflict mode: skip, overwrite or fail")
+}
+
+var (
+	dumpCmd = &cobra.Command{
+		Use:   "dump [file]",
+		Short: "Dump all keys as newline delimited json to file or stdout",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("wrong args number")
+			}
+			out := os.Stdout
+			if len(args) == 1 {
+				f, err := os.Create(args[0])
+				if err != nil {
+					return fmt.Errorf("create dump file: %v", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			w := bufio.NewWriter(out)
+			err = cl.Dump(ctx, w)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = w.Flush()
+			if err != nil {
+				return fmt.Errorf("write dump: %v", err)
+			}
+			return nil
+		},
+	}
+	restoreCmd = &cobra.Command{
+		Use:   "restore [file]",
+		Short: "Restore keys from dump file or stdin",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("wrong args number")
+			}
+			in := os.Stdin
+			if len(args) == 1 {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("open dump file: %v", err)
+				}
+				defer f.Close()
+				in = f
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			result, err := cl.Restore(ctx, bufio.NewReader(in), restoreMode)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return output(result)
+		},
+	}
+)
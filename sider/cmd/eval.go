@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"strings"
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval",
+	Short: "Execute lua script atomically",
+	Long:  "Execute lua script given as text or as @file with keys available to the script as KEYS and json arguments after -- as ARGV, arguments which are not valid json are passed as strings.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("missing script arg")
+		}
+		script := args[0]
+		if strings.HasPrefix(script, "@") {
+			b, err := ioutil.ReadFile(script[1:])
+			if err != nil {
+				return fmt.Errorf("read script: %v", err)
+			}
+			script = string(b)
+		}
+		keys := args[1:]
+		var scriptArgs []interface{}
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			if dash < 1 {
+				return fmt.Errorf("missing script arg")
+			}
+			keys = args[1:dash]
+			for _, arg := range args[dash:] {
+				var v interface{}
+				if json.Unmarshal([]byte(arg), &v) != nil {
+					v = arg
+				}
+				scriptArgs = append(scriptArgs, v)
+			}
+		}
+		cl, err := newClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var result interface{}
+		err = cl.Eval(ctx, script, keys, scriptArgs, &result)
+		if err != nil {
+			return fmt.Errorf("client: %v", err)
+		}
+		err = output(result)
+		if err != nil {
+			return fmt.Errorf("output result: %v", err)
+		}
+		return nil
+	},
+}
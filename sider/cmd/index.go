@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryEq     string
+	queryGt     string
+	queryGte    string
+	queryLt     string
+	queryLte    string
+	queryLimit  int
+	queryCursor string
+	queryValues bool
+)
+
+func init() {
+	queryCmd.Flags().StringVarP(&queryEq, "eq", "", "", "indexed value equal to")
+	queryCmd.Flags().StringVarP(&queryGt, "gt", "", "", "indexed value greater than")
+	queryCmd.Flags().StringVarP(&queryGte, "gte", "", "", "indexed value greater than or equal to")
+	queryCmd.Flags().StringVarP(&queryLt, "lt", "", "", "indexed value less than")
+	queryCmd.Flags().StringVarP(&queryLte, "lte", "", "", "indexed value less than or equal to")
+	queryCmd.Flags().IntVarP(&queryLimit, "limit", "", 0, "maximal number of keys, 100 by default")
+	queryCmd.Flags().StringVarP(&queryCursor, "cursor", "", "", "cursor of the previous page")
+	queryCmd.Flags().BoolVarP(&queryValues, "values", "", false, "output values of the keys")
+	indexCmd.AddCommand(indexCreateCmd)
+	indexCmd.AddCommand(indexDropCmd)
+	indexCmd.AddCommand(indexListCmd)
+}
+
+// queryValue parses flag as json number or string, value which is not
+// valid json is a string.
+func queryValue(cmd *cobra.Command, name string, s string) interface{} {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	var v interface{}
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+	return v
+}
+
+var (
+	indexCmd = &cobra.Command{
+		Use:   "index",
+		Short: "Manage secondary indexes",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+	indexCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Index keys by value at json pointer path",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("missing index name and path args")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.CreateIndex(ctx, args[0], args[1])
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	indexDropCmd = &cobra.Command{
+		Use:   "drop",
+		Short: "Drop index",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing index name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.DropIndex(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	indexListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List indexes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("wrong args number")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			infos, err := cl.Indexes(ctx)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(infos)
+			if err != nil {
+				return fmt.Errorf("output indexes: %v", err)
+			}
+			return nil
+		},
+	}
+	queryCmd = &cobra.Command{
+		Use:   "query",
+		Short: "Find keys by indexed value",
+		Long:  "Find keys by indexed value, bound values are json numbers or strings, values which are not valid json are strings.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing index name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			result, err := cl.Query(ctx, args[0], client.Query{
+				Eq:     queryValue(cmd, "eq", queryEq),
+				Gt:     queryValue(cmd, "gt", queryGt),
+				Gte:    queryValue(cmd, "gte", queryGte),
+				Lt:     queryValue(cmd, "lt", queryLt),
+				Lte:    queryValue(cmd, "lte", queryLte),
+				Limit:  queryLimit,
+				Cursor: queryCursor,
+				Values: queryValues,
+			})
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(result)
+			if err != nil {
+				return fmt.Errorf("output result: %v", err)
+			}
+			return nil
+		},
+	}
+)
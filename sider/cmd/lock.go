@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+	"time"
+)
+
+var (
+	leaseTTL time.Duration
+	lockWait time.Duration
+)
+
+func init() {
+	lockCmd.Flags().DurationVarP(&leaseTTL, "lease", "", 30*time.Second, "lock lease, renewed while command runs")
+	lockCmd.Flags().DurationVarP(&lockWait, "wait", "w", 0, "time to wait for the lock, fail immediately if zero")
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock name -- command [args]",
+	Short: "Run command holding the lock",
+	Long: "Run command holding the lock, fencing token is passed in SIDER_LOCK_FENCE environment variable. " +
+		"Command is killed if lock lease is lost.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("wrong args number")
+		}
+		cl, err := newClient()
+		if err != nil {
+			return err
+		}
+		m := cl.NewMutex(args[0], leaseTTL)
+		if lockWait > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), lockWait)
+			err = m.Lock(ctx)
+			cancel()
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err = m.TryLock(ctx)
+			cancel()
+		}
+		if err != nil {
+			return fmt.Errorf("lock [%s]: %v", args[0], err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-m.Lost():
+				fmt.Fprintf(os.Stderr, "lock [%s] lease is lost\n", args[0])
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		c := exec.CommandContext(ctx, args[1], args[2:]...)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		c.Env = append(os.Environ(), fmt.Sprintf("SIDER_LOCK_FENCE=%d", m.Fence()))
+		runErr := c.Run()
+		cancel()
+		unlockCtx, unlockCancel := context.WithTimeout(context.Background(), timeout)
+		defer unlockCancel()
+		if err := m.Unlock(unlockCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "unlock [%s]: %v\n", args[0], err)
+		}
+		if exit, ok := runErr.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode())
+		}
+		if runErr != nil {
+			return fmt.Errorf("run: %v", runErr)
+		}
+		return nil
+	},
+}
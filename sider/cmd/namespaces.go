@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxMemory int64
+)
+
+func init() {
+	nsCreateCmd.Flags().Int64VarP(&maxMemory, "max-memory", "", 0, "namespace memory limit in bytes")
+	nsCmd.AddCommand(nsListCmd)
+	nsCmd.AddCommand(nsCreateCmd)
+	nsCmd.AddCommand(nsDropCmd)
+	nsCmd.AddCommand(nsFlushCmd)
+	nsCmd.AddCommand(nsStatsCmd)
+}
+
+var (
+	nsCmd = &cobra.Command{
+		Use:   "ns",
+		Short: "Manage namespaces",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+	nsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List of namespaces",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("wrong args number")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			names, err := cl.Namespaces(ctx)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(names)
+			if err != nil {
+				return fmt.Errorf("output namespaces: %v", err)
+			}
+			return nil
+		},
+	}
+	nsCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create namespace",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.CreateNamespace(ctx, args[0], maxMemory)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	nsDropCmd = &cobra.Command{
+		Use:   "drop",
+		Short: "Drop namespace with all keys",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.DropNamespace(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	nsFlushCmd = &cobra.Command{
+		Use:   "flush",
+		Short: "Delete all keys in namespace",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.Scoped(args[0]).Flush(ctx)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	nsStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Namespace statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			stats, err := cl.Stats(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(stats)
+			if err != nil {
+				return fmt.Errorf("output stats: %v", err)
+			}
+			return nil
+		},
+	}
+)
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+var (
+	visibility time.Duration
+	popWait    time.Duration
+)
+
+func init() {
+	queuePopCmd.Flags().DurationVarP(&visibility, "visibility", "", 30*time.Second, "time message is hidden from other consumers until acknowledged")
+	queuePopCmd.Flags().DurationVarP(&popWait, "wait", "w", 0, "time to wait for message, fail immediately if zero")
+	queueCmd.AddCommand(queuePushCmd)
+	queueCmd.AddCommand(queuePopCmd)
+	queueCmd.AddCommand(queueAckCmd)
+	queueCmd.AddCommand(queueNackCmd)
+}
+
+var (
+	queueCmd = &cobra.Command{
+		Use:   "queue",
+		Short: "Push and consume queue messages",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+	queuePushCmd = &cobra.Command{
+		Use:   "push",
+		Short: "Push json message to the queue",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch len(args) {
+			case 0:
+				return fmt.Errorf("missing queue and message args")
+			case 1:
+				return fmt.Errorf("missing message arg")
+			default:
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			id, err := cl.Push(ctx, args[0], strings.NewReader(args[1]))
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			fmt.Println(id)
+			return nil
+		},
+	}
+	queuePopCmd = &cobra.Command{
+		Use:   "pop",
+		Short: "Reserve message of the queue",
+		Long:  "Reserve message of the queue, message must be acknowledged with its receipt before visibility timeout expires.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing queue arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout+popWait)
+			defer cancel()
+			m, err := cl.Pop(ctx, args[0], visibility, popWait)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			if m == nil {
+				return fmt.Errorf("queue [%s] is empty", args[0])
+			}
+			err = output(m)
+			if err != nil {
+				return fmt.Errorf("output message: %v", err)
+			}
+			return nil
+		},
+	}
+	queueAckCmd = &cobra.Command{
+		Use:   "ack",
+		Short: "Acknowledge processed message",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return acknowledge(args, false)
+		},
+	}
+	queueNackCmd = &cobra.Command{
+		Use:   "nack",
+		Short: "Return message to the queue",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return acknowledge(args, true)
+		},
+	}
+)
+
+func acknowledge(args []string, nack bool) error {
+	if len(args) != 2 {
+		return fmt.Errorf("missing queue and receipt args")
+	}
+	cl, err := newClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if nack {
+		err = cl.Nack(ctx, args[0], args[1])
+	} else {
+		err = cl.Ack(ctx, args[0], args[1])
+	}
+	if err != nil {
+		return fmt.Errorf("client: %v", err)
+	}
+	return nil
+}
@@ -1,22 +1,51 @@
 package cmd
 
 import (
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
 	"github.com/spf13/cobra"
+	"net/http"
+	"os"
 	"time"
 )
 
 var (
-	siderURL string
-	timeout  time.Duration
+	siderURL  string
+	timeout   time.Duration
+	token     string
+	namespace string
+	caFile    string
+	certFile  string
+	keyFile   string
 )
 
 func init() {
 	RootCmd.PersistentFlags().StringVarP(&siderURL, "url", "u", "http://localhost:8080", "Sider API URL")
 	RootCmd.PersistentFlags().DurationVarP(&timeout, "timeout", "t", 30*time.Second, "Operation timeout")
+	RootCmd.PersistentFlags().StringVarP(&token, "token", "", os.Getenv("SIDER_TOKEN"), "Authentication token (default $SIDER_TOKEN)")
+	RootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the keys")
+	RootCmd.PersistentFlags().StringVarP(&caFile, "ca", "", "", "CA bundle to verify server certificate")
+	RootCmd.PersistentFlags().StringVarP(&certFile, "cert", "", "", "Client certificate file")
+	RootCmd.PersistentFlags().StringVarP(&keyFile, "key", "", "", "Client private key file")
 	RootCmd.AddCommand(keysCmd)
 	RootCmd.AddCommand(getCmd)
 	RootCmd.AddCommand(setCmd)
 	RootCmd.AddCommand(delCmd)
+	RootCmd.AddCommand(existsCmd)
+	RootCmd.AddCommand(renameCmd)
+	RootCmd.AddCommand(copyCmd)
+	RootCmd.AddCommand(flushCmd)
+	RootCmd.AddCommand(dumpCmd)
+	RootCmd.AddCommand(restoreCmd)
+	RootCmd.AddCommand(nsCmd)
+	RootCmd.AddCommand(lockCmd)
+	RootCmd.AddCommand(queueCmd)
+	RootCmd.AddCommand(streamCmd)
+	RootCmd.AddCommand(evalCmd)
+	RootCmd.AddCommand(indexCmd)
+	RootCmd.AddCommand(queryCmd)
+	RootCmd.AddCommand(schemaCmd)
+	RootCmd.AddCommand(bigKeysCmd)
 }
 
 var RootCmd = &cobra.Command{
@@ -27,3 +56,20 @@ var RootCmd = &cobra.Command{
 		cmd.Usage()
 	},
 }
+
+func newClient() (*client.Client, error) {
+	opts := []client.Option{
+		client.WithToken(token),
+		client.WithNamespace(namespace),
+		client.WithUserAgent("sider-cli"),
+		client.WithRetryPolicy(client.DefaultRetryPolicy),
+	}
+	if caFile != "" || certFile != "" {
+		config, err := client.NewTLSConfig(caFile, certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %v", err)
+		}
+		opts = append(opts, client.WithHTTPClient(&http.Client{Transport: &http.Transport{TLSClientConfig: config}}))
+	}
+	return client.NewClient(siderURL, opts...), nil
+}
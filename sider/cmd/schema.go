@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"strings"
+)
+
+func init() {
+	schemaCmd.AddCommand(schemaPutCmd)
+	schemaCmd.AddCommand(schemaGetCmd)
+	schemaCmd.AddCommand(schemaListCmd)
+	schemaCmd.AddCommand(schemaDelCmd)
+}
+
+var (
+	schemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "Manage JSON Schemas validating values",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+	schemaPutCmd = &cobra.Command{
+		Use:   "put",
+		Short: "Register schema for keys matching glob pattern",
+		Long:  "Register schema given as text or as @file for keys matching glob pattern in namespace given with --namespace or in all namespaces.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 3 {
+				return fmt.Errorf("missing name, pattern and schema args")
+			}
+			s := args[2]
+			if strings.HasPrefix(s, "@") {
+				b, err := ioutil.ReadFile(s[1:])
+				if err != nil {
+					return fmt.Errorf("read schema: %v", err)
+				}
+				s = string(b)
+			}
+			if !json.Valid([]byte(s)) {
+				return fmt.Errorf("schema is not valid json")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.PutSchema(ctx, &client.Schema{Name: args[0], Namespace: namespace, Pattern: args[1], Schema: json.RawMessage(s)})
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	schemaGetCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Show schema",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			s, err := cl.Schema(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(s)
+			if err != nil {
+				return fmt.Errorf("output schema: %v", err)
+			}
+			return nil
+		},
+	}
+	schemaListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List schemas",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("wrong args number")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			schemas, err := cl.Schemas(ctx)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(schemas)
+			if err != nil {
+				return fmt.Errorf("output schemas: %v", err)
+			}
+			return nil
+		},
+	}
+	schemaDelCmd = &cobra.Command{
+		Use:   "del",
+		Short: "Delete schema",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing name arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.DeleteSchema(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+)
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+var (
+	maxLen      int
+	maxAge      time.Duration
+	rangeStart  string
+	rangeEnd    string
+	count       int
+	group       string
+	consumer    string
+	groupStart  string
+	readWait    time.Duration
+	followAfter string
+)
+
+func init() {
+	streamAddCmd.Flags().IntVarP(&maxLen, "maxlen", "", 0, "trim stream to at most maxlen entries")
+	streamTrimCmd.Flags().IntVarP(&maxLen, "maxlen", "", 0, "keep at most maxlen entries")
+	streamTrimCmd.Flags().DurationVarP(&maxAge, "maxage", "", 0, "remove entries older than maxage")
+	streamRangeCmd.Flags().StringVarP(&rangeStart, "start", "", "", "first entry id, beginning of the stream by default")
+	streamRangeCmd.Flags().StringVarP(&rangeEnd, "end", "", "", "last entry id, end of the stream by default")
+	streamRangeCmd.Flags().StringVarP(&followAfter, "after", "", "", "return entries after entry id waiting for them")
+	streamRangeCmd.Flags().DurationVarP(&readWait, "wait", "w", 0, "time to wait for entries after --after id")
+	streamGroupCmd.Flags().StringVarP(&groupStart, "start", "", "", "id of the last entry considered delivered, 0 delivers all entries, only new entries are delivered by default")
+	streamReadCmd.Flags().StringVarP(&group, "group", "g", "", "consumer group")
+	streamReadCmd.Flags().StringVarP(&consumer, "consumer", "c", "", "consumer name")
+	streamReadCmd.Flags().DurationVarP(&readWait, "wait", "w", 0, "time to wait for entries")
+	for _, cmd := range []*cobra.Command{streamRangeCmd, streamReadCmd} {
+		cmd.Flags().IntVarP(&count, "count", "", 0, "maximal number of entries, 100 by default")
+	}
+	streamCmd.AddCommand(streamAddCmd)
+	streamCmd.AddCommand(streamRangeCmd)
+	streamCmd.AddCommand(streamTrimCmd)
+	streamCmd.AddCommand(streamGroupCmd)
+	streamCmd.AddCommand(streamReadCmd)
+	streamCmd.AddCommand(streamAckCmd)
+	streamCmd.AddCommand(streamPendingCmd)
+	streamCmd.AddCommand(streamInfoCmd)
+}
+
+var (
+	streamCmd = &cobra.Command{
+		Use:   "stream",
+		Short: "Append to and read append-only streams",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+	streamAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Append json entry to the stream",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch len(args) {
+			case 0:
+				return fmt.Errorf("missing key and entry args")
+			case 1:
+				return fmt.Errorf("missing entry arg")
+			default:
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			id, err := cl.Stream(args[0]).Append(ctx, strings.NewReader(args[1]), maxLen)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			fmt.Println(id)
+			return nil
+		},
+	}
+	streamRangeCmd = &cobra.Command{
+		Use:   "range",
+		Short: "Read stream entries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing key arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout+readWait)
+			defer cancel()
+			s := cl.Stream(args[0])
+			var entries interface{}
+			if followAfter != "" {
+				entries, err = s.Read(ctx, followAfter, count, readWait)
+			} else {
+				entries, err = s.Range(ctx, rangeStart, rangeEnd, count)
+			}
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(entries)
+			if err != nil {
+				return fmt.Errorf("output entries: %v", err)
+			}
+			return nil
+		},
+	}
+	streamTrimCmd = &cobra.Command{
+		Use:   "trim",
+		Short: "Remove oldest stream entries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing key arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			trimmed, err := cl.Stream(args[0]).Trim(ctx, maxLen, maxAge)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			fmt.Println(trimmed)
+			return nil
+		},
+	}
+	streamGroupCmd = &cobra.Command{
+		Use:   "group",
+		Short: "Create consumer group",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("missing key and group args")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = cl.Stream(args[0]).CreateGroup(ctx, args[1], groupStart)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			return nil
+		},
+	}
+	streamReadCmd = &cobra.Command{
+		Use:   "read",
+		Short: "Read entries as consumer of the group",
+		Long:  "Read entries not delivered to the group yet, entries are pending until acknowledged.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing key arg")
+			}
+			if group == "" || consumer == "" {
+				return fmt.Errorf("missing group or consumer")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout+readWait)
+			defer cancel()
+			entries, err := cl.Stream(args[0]).ReadGroup(ctx, group, consumer, count, readWait)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(entries)
+			if err != nil {
+				return fmt.Errorf("output entries: %v", err)
+			}
+			return nil
+		},
+	}
+	streamAckCmd = &cobra.Command{
+		Use:   "ack",
+		Short: "Acknowledge entries delivered to the group",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 3 {
+				return fmt.Errorf("missing key, group and entry id args")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			acked, err := cl.Stream(args[0]).Ack(ctx, args[1], args[2:]...)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			fmt.Println(acked)
+			return nil
+		},
+	}
+	streamPendingCmd = &cobra.Command{
+		Use:   "pending",
+		Short: "List entries pending in the group",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("missing key and group args")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			pending, err := cl.Stream(args[0]).Pending(ctx, args[1])
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(pending)
+			if err != nil {
+				return fmt.Errorf("output pending entries: %v", err)
+			}
+			return nil
+		},
+	}
+	streamInfoCmd = &cobra.Command{
+		Use:   "info",
+		Short: "Show stream length and consumer groups",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("missing key arg")
+			}
+			cl, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			info, err := cl.Stream(args[0]).Info(ctx)
+			if err != nil {
+				return fmt.Errorf("client: %v", err)
+			}
+			err = output(info)
+			if err != nil {
+				return fmt.Errorf("output info: %v", err)
+			}
+			return nil
+		},
+	}
+)
@@ -0,0 +1,5 @@
+// Package api contains protocol buffers definition of sider gRPC service
+// and code generated from it.
+package api
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative sider.proto
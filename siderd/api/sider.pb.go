@@ -0,0 +1,1035 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: sider.proto
+
+package api
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Event_Type int32
+
+const (
+	Event_SET    Event_Type = 0
+	Event_DEL    Event_Type = 1
+	Event_EXPIRE Event_Type = 2
+)
+
+// Enum value maps for Event_Type.
+var (
+	Event_Type_name = map[int32]string{
+		0: "SET",
+		1: "DEL",
+		2: "EXPIRE",
+	}
+	Event_Type_value = map[string]int32{
+		"SET":    0,
+		"DEL":    1,
+		"EXPIRE": 2,
+	}
+)
+
+func (x Event_Type) Enum() *Event_Type {
+	p := new(Event_Type)
+	*p = x
+	return p
+}
+
+func (x Event_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Event_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_sider_proto_enumTypes[0].Descriptor()
+}
+
+func (Event_Type) Type() protoreflect.EnumType {
+	return &file_sider_proto_enumTypes[0]
+}
+
+func (x Event_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Event_Type.Descriptor instead.
+func (Event_Type) EnumDescriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{13, 0}
+}
+
+type KeysRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeysRequest) Reset() {
+	*x = KeysRequest{}
+	mi := &file_sider_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeysRequest) ProtoMessage() {}
+
+func (x *KeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeysRequest.ProtoReflect.Descriptor instead.
+func (*KeysRequest) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *KeysRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+type KeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          []string               `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeysResponse) Reset() {
+	*x = KeysResponse{}
+	mi := &file_sider_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeysResponse) ProtoMessage() {}
+
+func (x *KeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeysResponse.ProtoReflect.Descriptor instead.
+func (*KeysResponse) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *KeysResponse) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_sider_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *GetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type GetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         *structpb.Value        `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_sider_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
+
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetResponse) GetValue() *structpb.Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+type SetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value         *structpb.Value        `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	Ttl           *durationpb.Duration   `protobuf:"bytes,4,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetRequest) Reset() {
+	*x = SetRequest{}
+	mi := &file_sider_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRequest) ProtoMessage() {}
+
+func (x *SetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRequest.ProtoReflect.Descriptor instead.
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SetRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *SetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *SetRequest) GetValue() *structpb.Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *SetRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+type SetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetResponse) Reset() {
+	*x = SetResponse{}
+	mi := &file_sider_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetResponse) ProtoMessage() {}
+
+func (x *SetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetResponse.ProtoReflect.Descriptor instead.
+func (*SetResponse) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{5}
+}
+
+type DelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DelRequest) Reset() {
+	*x = DelRequest{}
+	mi := &file_sider_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DelRequest) ProtoMessage() {}
+
+func (x *DelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DelRequest.ProtoReflect.Descriptor instead.
+func (*DelRequest) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DelRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *DelRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type DelResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deleted       bool                   `protobuf:"varint,1,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DelResponse) Reset() {
+	*x = DelResponse{}
+	mi := &file_sider_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DelResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DelResponse) ProtoMessage() {}
+
+func (x *DelResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DelResponse.ProtoReflect.Descriptor instead.
+func (*DelResponse) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DelResponse) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+type Operation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Op:
+	//
+	//	*Operation_Get
+	//	*Operation_Set
+	//	*Operation_Del
+	Op            isOperation_Op `protobuf_oneof:"op"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Operation) Reset() {
+	*x = Operation{}
+	mi := &file_sider_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operation) ProtoMessage() {}
+
+func (x *Operation) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operation.ProtoReflect.Descriptor instead.
+func (*Operation) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Operation) GetOp() isOperation_Op {
+	if x != nil {
+		return x.Op
+	}
+	return nil
+}
+
+func (x *Operation) GetGet() *GetRequest {
+	if x != nil {
+		if x, ok := x.Op.(*Operation_Get); ok {
+			return x.Get
+		}
+	}
+	return nil
+}
+
+func (x *Operation) GetSet() *SetRequest {
+	if x != nil {
+		if x, ok := x.Op.(*Operation_Set); ok {
+			return x.Set
+		}
+	}
+	return nil
+}
+
+func (x *Operation) GetDel() *DelRequest {
+	if x != nil {
+		if x, ok := x.Op.(*Operation_Del); ok {
+			return x.Del
+		}
+	}
+	return nil
+}
+
+type isOperation_Op interface {
+	isOperation_Op()
+}
+
+type Operation_Get struct {
+	Get *GetRequest `protobuf:"bytes,1,opt,name=get,proto3,oneof"`
+}
+
+type Operation_Set struct {
+	Set *SetRequest `protobuf:"bytes,2,opt,name=set,proto3,oneof"`
+}
+
+type Operation_Del struct {
+	Del *DelRequest `protobuf:"bytes,3,opt,name=del,proto3,oneof"`
+}
+
+func (*Operation_Get) isOperation_Op() {}
+
+func (*Operation_Set) isOperation_Op() {}
+
+func (*Operation_Del) isOperation_Op() {}
+
+type Result struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Result:
+	//
+	//	*Result_Get
+	//	*Result_Set
+	//	*Result_Del
+	//	*Result_Error
+	Result        isResult_Result `protobuf_oneof:"result"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_sider_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Result) GetResult() isResult_Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *Result) GetGet() *GetResponse {
+	if x != nil {
+		if x, ok := x.Result.(*Result_Get); ok {
+			return x.Get
+		}
+	}
+	return nil
+}
+
+func (x *Result) GetSet() *SetResponse {
+	if x != nil {
+		if x, ok := x.Result.(*Result_Set); ok {
+			return x.Set
+		}
+	}
+	return nil
+}
+
+func (x *Result) GetDel() *DelResponse {
+	if x != nil {
+		if x, ok := x.Result.(*Result_Del); ok {
+			return x.Del
+		}
+	}
+	return nil
+}
+
+func (x *Result) GetError() string {
+	if x != nil {
+		if x, ok := x.Result.(*Result_Error); ok {
+			return x.Error
+		}
+	}
+	return ""
+}
+
+type isResult_Result interface {
+	isResult_Result()
+}
+
+type Result_Get struct {
+	Get *GetResponse `protobuf:"bytes,1,opt,name=get,proto3,oneof"`
+}
+
+type Result_Set struct {
+	Set *SetResponse `protobuf:"bytes,2,opt,name=set,proto3,oneof"`
+}
+
+type Result_Del struct {
+	Del *DelResponse `protobuf:"bytes,3,opt,name=del,proto3,oneof"`
+}
+
+type Result_Error struct {
+	Error string `protobuf:"bytes,4,opt,name=error,proto3,oneof"`
+}
+
+func (*Result_Get) isResult_Result() {}
+
+func (*Result_Set) isResult_Result() {}
+
+func (*Result_Del) isResult_Result() {}
+
+func (*Result_Error) isResult_Result() {}
+
+type BatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operations    []*Operation           `protobuf:"bytes,1,rep,name=operations,proto3" json:"operations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_sider_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *BatchRequest) GetOperations() []*Operation {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*Result              `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_sider_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *BatchResponse) GetResults() []*Result {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Pattern       string                 `protobuf:"bytes,2,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_sider_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *WatchRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *WatchRequest) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          Event_Type             `protobuf:"varint,1,opt,name=type,proto3,enum=sider.v1.Event_Type" json:"type,omitempty"`
+	Namespace     string                 `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Key           string                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_sider_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_sider_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_sider_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Event) GetType() Event_Type {
+	if x != nil {
+		return x.Type
+	}
+	return Event_SET
+}
+
+func (x *Event) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *Event) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+var File_sider_proto protoreflect.FileDescriptor
+
+const file_sider_proto_rawDesc = "" +
+	"\n" +
+	"\vsider.proto\x12\bsider.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1cgoogle/protobuf/struct.proto\"+\n" +
+	"\vKeysRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\"\"\n" +
+	"\fKeysResponse\x12\x12\n" +
+	"\x04keys\x18\x01 \x03(\tR\x04keys\"<\n" +
+	"\n" +
+	"GetRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\";\n" +
+	"\vGetResponse\x12,\n" +
+	"\x05value\x18\x01 \x01(\v2\x16.google.protobuf.ValueR\x05value\"\x97\x01\n" +
+	"\n" +
+	"SetRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12,\n" +
+	"\x05value\x18\x03 \x01(\v2\x16.google.protobuf.ValueR\x05value\x12+\n" +
+	"\x03ttl\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\"\r\n" +
+	"\vSetResponse\"<\n" +
+	"\n" +
+	"DelRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\"'\n" +
+	"\vDelResponse\x12\x18\n" +
+	"\adeleted\x18\x01 \x01(\bR\adeleted\"\x8f\x01\n" +
+	"\tOperation\x12(\n" +
+	"\x03get\x18\x01 \x01(\v2\x14.sider.v1.GetRequestH\x00R\x03get\x12(\n" +
+	"\x03set\x18\x02 \x01(\v2\x14.sider.v1.SetRequestH\x00R\x03set\x12(\n" +
+	"\x03del\x18\x03 \x01(\v2\x14.sider.v1.DelRequestH\x00R\x03delB\x04\n" +
+	"\x02op\"\xab\x01\n" +
+	"\x06Result\x12)\n" +
+	"\x03get\x18\x01 \x01(\v2\x15.sider.v1.GetResponseH\x00R\x03get\x12)\n" +
+	"\x03set\x18\x02 \x01(\v2\x15.sider.v1.SetResponseH\x00R\x03set\x12)\n" +
+	"\x03del\x18\x03 \x01(\v2\x15.sider.v1.DelResponseH\x00R\x03del\x12\x16\n" +
+	"\x05error\x18\x04 \x01(\tH\x00R\x05errorB\b\n" +
+	"\x06result\"C\n" +
+	"\fBatchRequest\x123\n" +
+	"\n" +
+	"operations\x18\x01 \x03(\v2\x13.sider.v1.OperationR\n" +
+	"operations\";\n" +
+	"\rBatchResponse\x12*\n" +
+	"\aresults\x18\x01 \x03(\v2\x10.sider.v1.ResultR\aresults\"F\n" +
+	"\fWatchRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x18\n" +
+	"\apattern\x18\x02 \x01(\tR\apattern\"\x87\x01\n" +
+	"\x05Event\x12(\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x14.sider.v1.Event.TypeR\x04type\x12\x1c\n" +
+	"\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key\"$\n" +
+	"\x04Type\x12\a\n" +
+	"\x03SET\x10\x00\x12\a\n" +
+	"\x03DEL\x10\x01\x12\n" +
+	"\n" +
+	"\x06EXPIRE\x10\x022\xc8\x02\n" +
+	"\x05Sider\x125\n" +
+	"\x04Keys\x12\x15.sider.v1.KeysRequest\x1a\x16.sider.v1.KeysResponse\x122\n" +
+	"\x03Get\x12\x14.sider.v1.GetRequest\x1a\x15.sider.v1.GetResponse\x122\n" +
+	"\x03Set\x12\x14.sider.v1.SetRequest\x1a\x15.sider.v1.SetResponse\x122\n" +
+	"\x03Del\x12\x14.sider.v1.DelRequest\x1a\x15.sider.v1.DelResponse\x128\n" +
+	"\x05Batch\x12\x16.sider.v1.BatchRequest\x1a\x17.sider.v1.BatchResponse\x122\n" +
+	"\x05Watch\x12\x16.sider.v1.WatchRequest\x1a\x0f.sider.v1.Event0\x01B)Z'github.com/aandryashin/sider/siderd/apib\x06proto3"
+
+var (
+	file_sider_proto_rawDescOnce sync.Once
+	file_sider_proto_rawDescData []byte
+)
+
+func file_sider_proto_rawDescGZIP() []byte {
+	file_sider_proto_rawDescOnce.Do(func() {
+		file_sider_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sider_proto_rawDesc), len(file_sider_proto_rawDesc)))
+	})
+	return file_sider_proto_rawDescData
+}
+
+var file_sider_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_sider_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_sider_proto_goTypes = []any{
+	(Event_Type)(0),             // 0: sider.v1.Event.Type
+	(*KeysRequest)(nil),         // 1: sider.v1.KeysRequest
+	(*KeysResponse)(nil),        // 2: sider.v1.KeysResponse
+	(*GetRequest)(nil),          // 3: sider.v1.GetRequest
+	(*GetResponse)(nil),         // 4: sider.v1.GetResponse
+	(*SetRequest)(nil),          // 5: sider.v1.SetRequest
+	(*SetResponse)(nil),         // 6: sider.v1.SetResponse
+	(*DelRequest)(nil),          // 7: sider.v1.DelRequest
+	(*DelResponse)(nil),         // 8: sider.v1.DelResponse
+	(*Operation)(nil),           // 9: sider.v1.Operation
+	(*Result)(nil),              // 10: sider.v1.Result
+	(*BatchRequest)(nil),        // 11: sider.v1.BatchRequest
+	(*BatchResponse)(nil),       // 12: sider.v1.BatchResponse
+	(*WatchRequest)(nil),        // 13: sider.v1.WatchRequest
+	(*Event)(nil),               // 14: sider.v1.Event
+	(*structpb.Value)(nil),      // 15: google.protobuf.Value
+	(*durationpb.Duration)(nil), // 16: google.protobuf.Duration
+}
+var file_sider_proto_depIdxs = []int32{
+	15, // 0: sider.v1.GetResponse.value:type_name -> google.protobuf.Value
+	15, // 1: sider.v1.SetRequest.value:type_name -> google.protobuf.Value
+	16, // 2: sider.v1.SetRequest.ttl:type_name -> google.protobuf.Duration
+	3,  // 3: sider.v1.Operation.get:type_name -> sider.v1.GetRequest
+	5,  // 4: sider.v1.Operation.set:type_name -> sider.v1.SetRequest
+	7,  // 5: sider.v1.Operation.del:type_name -> sider.v1.DelRequest
+	4,  // 6: sider.v1.Result.get:type_name -> sider.v1.GetResponse
+	6,  // 7: sider.v1.Result.set:type_name -> sider.v1.SetResponse
+	8,  // 8: sider.v1.Result.del:type_name -> sider.v1.DelResponse
+	9,  // 9: sider.v1.BatchRequest.operations:type_name -> sider.v1.Operation
+	10, // 10: sider.v1.BatchResponse.results:type_name -> sider.v1.Result
+	0,  // 11: sider.v1.Event.type:type_name -> sider.v1.Event.Type
+	1,  // 12: sider.v1.Sider.Keys:input_type -> sider.v1.KeysRequest
+	3,  // 13: sider.v1.Sider.Get:input_type -> sider.v1.GetRequest
+	5,  // 14: sider.v1.Sider.Set:input_type -> sider.v1.SetRequest
+	7,  // 15: sider.v1.Sider.Del:input_type -> sider.v1.DelRequest
+	11, // 16: sider.v1.Sider.Batch:input_type -> sider.v1.BatchRequest
+	13, // 17: sider.v1.Sider.Watch:input_type -> sider.v1.WatchRequest
+	2,  // 18: sider.v1.Sider.Keys:output_type -> sider.v1.KeysResponse
+	4,  // 19: sider.v1.Sider.Get:output_type -> sider.v1.GetResponse
+	6,  // 20: sider.v1.Sider.Set:output_type -> sider.v1.SetResponse
+	8,  // 21: sider.v1.Sider.Del:output_type -> sider.v1.DelResponse
+	12, // 22: sider.v1.Sider.Batch:output_type -> sider.v1.BatchResponse
+	14, // 23: sider.v1.Sider.Watch:output_type -> sider.v1.Event
+	18, // [18:24] is the sub-list for method output_type
+	12, // [12:18] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_sider_proto_init() }
+func file_sider_proto_init() {
+	if File_sider_proto != nil {
+		return
+	}
+	file_sider_proto_msgTypes[8].OneofWrappers = []any{
+		(*Operation_Get)(nil),
+		(*Operation_Set)(nil),
+		(*Operation_Del)(nil),
+	}
+	file_sider_proto_msgTypes[9].OneofWrappers = []any{
+		(*Result_Get)(nil),
+		(*Result_Set)(nil),
+		(*Result_Del)(nil),
+		(*Result_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sider_proto_rawDesc), len(file_sider_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sider_proto_goTypes,
+		DependencyIndexes: file_sider_proto_depIdxs,
+		EnumInfos:         file_sider_proto_enumTypes,
+		MessageInfos:      file_sider_proto_msgTypes,
+	}.Build()
+	File_sider_proto = out.File
+	file_sider_proto_goTypes = nil
+	file_sider_proto_depIdxs = nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	opRead   = "read"
+	opWrite  = "write"
+	opDelete = "delete"
+	opAdmin  = "admin"
+)
+
+type rule struct {
+	Namespaces []string `json:"namespaces"`
+	Keys       []string `json:"keys"`
+	Ops        []string `json:"ops"`
+}
+
+type user struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	ACL   []rule `json:"acl"`
+}
+
+type userKey struct{}
+
+var (
+	usersFile string
+	users     map[string]*user
+)
+
+func loadUsers(filename string) (map[string]*user, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open users file: %v", err)
+	}
+	defer f.Close()
+	var list []*user
+	err = json.NewDecoder(f).Decode(&list)
+	if err != nil {
+		return nil, fmt.Errorf("parse users file: %v", err)
+	}
+	m := make(map[string]*user)
+	for _, u := range list {
+		if u.Token == "" {
+			return nil, fmt.Errorf("user [%s]: empty token", u.Name)
+		}
+		if _, ok := m[u.Token]; ok {
+			return nil, fmt.Errorf("user [%s]: duplicate token", u.Name)
+		}
+		for _, r := range u.ACL {
+			for _, p := range append(r.Namespaces, r.Keys...) {
+				if _, err := path.Match(p, ""); err != nil {
+					return nil, fmt.Errorf("user [%s]: bad pattern [%s]: %v", u.Name, p, err)
+				}
+			}
+		}
+		m[u.Token] = u
+	}
+	return m, nil
+}
+
+// can checks whether user is allowed to perform operation on the key in
+// namespace, empty key checks access to the namespace itself. Admin
+// operations on the whole namespace require rule not restricted to
+// particular keys.
+func (u *user) can(op string, ns string, key string) bool {
+	for _, r := range u.ACL {
+		if !r.allows(op) || (len(r.Namespaces) > 0 && !match(r.Namespaces, ns)) {
+			continue
+		}
+		switch {
+		case key != "":
+			if match(r.Keys, key) {
+				return true
+			}
+		case op != opAdmin || r.allKeys():
+			return true
+		}
+	}
+	return false
+}
+
+func match(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allKeys reports whether rule applies to all keys.
+func (r rule) allKeys() bool {
+	for _, p := range r.Keys {
+		if p == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rule) allows(op string) bool {
+	for _, o := range r.Ops {
+		if o == op || o == opAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func token(r *http.Request) string {
+	return bearer(r.Header.Get("Authorization"))
+}
+
+func bearer(h string) string {
+	if !strings.HasPrefix(h, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+}
+
+func userOf(ctx context.Context) *user {
+	u, _ := ctx.Value(userKey{}).(*user)
+	return u
+}
+
+func allowedIn(ctx context.Context, op string, ns string, key string) bool {
+	if users == nil {
+		return true
+	}
+	u := userOf(ctx)
+	return u != nil && u.can(op, ns, key)
+}
+
+func permitted(r *http.Request, op string, ns string, key string) bool {
+	return allowedIn(r.Context(), op, ns, key)
+}
+
+func authHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if users == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		u, ok := users[token(r)]
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sider"`)
+			httpError(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, u)))
+	})
+}
+
+func authorize(op string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !permitted(r, op, namespaceOf(r).name, keyParam(r)) {
+			httpError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authorizeNamespace checks operation on the namespace itself for
+// requests not addressing particular key, e.g. index requests where
+// path parameter is index name.
+func authorizeNamespace(op string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !permitted(r, op, namespaceOf(r).name, "") {
+			httpError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authorizeAdmin allows requests from users with admin operation not
+// restricted to particular namespaces.
+func authorizeAdmin(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !permitted(r, opAdmin, "", "") {
+			httpError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
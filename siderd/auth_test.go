@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func withUsers(t *testing.T, content string) func() {
+	f, err := ioutil.TempFile("", "users")
+	if err != nil {
+		t.Fatalf("temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(content)
+	f.Close()
+	users, err = loadUsers(f.Name())
+	if err != nil {
+		t.Fatalf("load users: %v", err)
+	}
+	return func() {
+		users = nil
+	}
+}
+
+const testUsers = `[
+	{"name": "admin", "token": "admin", "acl": [{"keys": ["*"], "ops": ["admin"]}]},
+	{"name": "reader", "token": "reader", "acl": [{"keys": ["app:*"], "ops": ["read"]}]}
+]`
+
+func TestAuthUnauthorized(t *testing.T) {
+	defer withUsers(t, testUsers)()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	for _, token := range []string{"", "unknown"} {
+		r, _ := http.NewRequest(http.MethodGet, server.URL+"/keys", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("keys: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestAuthForbidden(t *testing.T) {
+	defer withUsers(t, testUsers)()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	admin := client.NewClient(server.URL)
+	admin.Token = "admin"
+	reader := client.NewClient(server.URL)
+	reader.Token = "reader"
+
+	key := "app:" + uuid.New()
+	err := reader.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	if !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("set without write permission: %v", err)
+	}
+	err = admin.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	defer admin.Del(context.Background(), key)
+
+	other := uuid.New()
+	err = admin.Set(context.Background(), other, bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	defer admin.Del(context.Background(), other)
+
+	_, err = reader.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_, err = reader.Get(context.Background(), other)
+	if err == nil {
+		t.Fatalf("get key outside of acl")
+	}
+	err = reader.Del(context.Background(), key)
+	if err == nil {
+		t.Fatalf("del without delete permission")
+	}
+
+	keys, err := reader.Keys(context.Background())
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != key {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestAuthKeyScopedAdmin(t *testing.T) {
+	defer withUsers(t, `[
+	{"name": "owner", "token": "owner", "acl": [{"keys": ["mine:*"], "ops": ["admin"]}]}
+]`)()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/admin/dump"},
+		{http.MethodGet, "/admin/bigkeys"},
+		{http.MethodPost, "/admin/flush"},
+		{http.MethodDelete, "/keys"},
+		{http.MethodDelete, "/ns/default"},
+		{http.MethodPut, "/indexes/mine"},
+		{http.MethodDelete, "/indexes/mine"},
+	}
+	for _, req := range requests {
+		r, _ := http.NewRequest(req.method, server.URL+req.path, nil)
+		r.Header.Set("Authorization", "Bearer owner")
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("%s %s: %v", req.method, req.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("%s %s: unexpected status: %d", req.method, req.path, resp.StatusCode)
+		}
+	}
+
+	owner := client.NewClient(server.URL)
+	owner.Token = "owner"
+	key := "mine:" + uuid.New()
+	err := owner.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := owner.Del(context.Background(), key); err != nil {
+		t.Fatalf("del: %v", err)
+	}
+}
+
+func TestAuthIndexes(t *testing.T) {
+	defer withUsers(t, `[
+	{"name": "admin", "token": "admin", "acl": [{"keys": ["*"], "ops": ["admin"]}]},
+	{"name": "reader", "token": "reader", "acl": [{"keys": ["app:*"], "ops": ["read"]}]}
+]`)()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	ctx := context.Background()
+
+	admin := client.NewClient(server.URL)
+	admin.Token = "admin"
+	name := uuid.New()
+	if err := admin.CreateIndex(ctx, name, "/"+name); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	defer admin.DropIndex(ctx, name)
+	for _, key := range []string{"app:" + name, "other:" + name} {
+		admin.Set(ctx, key, strings.NewReader(`{"`+name+`": 1}`), 0)
+		defer admin.Del(ctx, key)
+	}
+
+	reader := client.NewClient(server.URL)
+	reader.Token = "reader"
+	result, err := reader.Query(ctx, name, client.Query{Eq: 1})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(result.Items) != 1 || result.Items[0].Key != "app:"+name {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if err := reader.CreateIndex(ctx, uuid.New(), "/a"); !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingLoader struct {
+	loads  int32
+	delay  time.Duration
+	stored map[string]string
+}
+
+func (l *countingLoader) Load(ctx context.Context, key string) (string, error) {
+	n := atomic.AddInt32(&l.loads, 1)
+	time.Sleep(l.delay)
+	return key + ":" + string(rune('0'+n)), nil
+}
+
+func (l *countingLoader) Store(ctx context.Context, key string, v string) error {
+	l.stored[key] = v
+	return nil
+}
+
+func TestCacheSingleFlight(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	prefix := uuid.New() + ":"
+	defer cleanup(prefix + "key")
+	loader := &countingLoader{delay: 20 * time.Millisecond}
+	cache := client.NewCache[string](client.NewClient(server.URL), prefix, loader)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.Get(context.Background(), "key")
+			if err != nil || v != "key:1" {
+				t.Errorf("unexpected value: %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loader.loads != 1 {
+		t.Fatalf("unexpected number of loads: %d", loader.loads)
+	}
+	if !stored(prefix + "key") {
+		t.Fatalf("loaded value is not cached")
+	}
+	v, _ := cache.Get(context.Background(), "key")
+	if v != "key:1" || loader.loads != 1 {
+		t.Fatalf("cached value is not used: %v, %d", v, loader.loads)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	prefix := uuid.New() + ":"
+	defer cleanup(prefix + "key")
+	loader := &countingLoader{}
+	cache := client.NewCache[string](client.NewClient(server.URL), prefix, loader,
+		client.WithFreshFor(10*time.Millisecond), client.WithStaleWhileRevalidate(time.Minute))
+	ctx := context.Background()
+
+	cache.Get(ctx, "key")
+	time.Sleep(20 * time.Millisecond)
+	v, err := cache.Get(ctx, "key")
+	if err != nil || v != "key:1" {
+		t.Fatalf("stale value is not returned: %v, %v", v, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for v != "key:2" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		v, _ = cache.Get(ctx, "key")
+	}
+	if v != "key:2" {
+		t.Fatalf("stale value is not reloaded: %v", v)
+	}
+}
+
+func TestCacheLoadLock(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	prefix := uuid.New() + ":"
+	defer cleanup(prefix + "key")
+	loader := &countingLoader{delay: 50 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		// separate caches act as separate processes
+		cache := client.NewCache[string](client.NewClient(server.URL), prefix, loader, client.WithLoadLock(time.Second))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.Get(context.Background(), "key")
+			if err != nil || v != "key:1" {
+				t.Errorf("unexpected value: %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loader.loads != 1 {
+		t.Fatalf("unexpected number of loads: %d", loader.loads)
+	}
+	cl := client.NewClient(server.URL)
+	l, err := cl.Lock(context.Background(), prefix+"key", time.Second, 0)
+	if err != nil {
+		t.Fatalf("load lock is not released: %v", err)
+	}
+	cl.Unlock(context.Background(), l)
+}
+
+func TestCacheStaleLoadLock(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	prefix := uuid.New() + ":"
+	defer cleanup(prefix + "key")
+	loader := &countingLoader{delay: 200 * time.Millisecond}
+	ctx := context.Background()
+
+	var caches []*client.Cache[string]
+	for i := 0; i < 3; i++ {
+		caches = append(caches, client.NewCache[string](client.NewClient(server.URL), prefix, loader,
+			client.WithFreshFor(time.Second), client.WithStaleWhileRevalidate(time.Minute), client.WithLoadLock(time.Second)))
+	}
+	caches[0].Get(ctx, "key")
+	time.Sleep(time.Second)
+	for i := 0; i < 10; i++ {
+		for _, cache := range caches {
+			if _, err := cache.Get(ctx, "key"); err != nil {
+				t.Fatalf("get: %v", err)
+			}
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&loader.loads); n != 2 {
+		t.Fatalf("unexpected number of loads: %d", n)
+	}
+}
+
+func TestCacheWriteThrough(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	prefix := uuid.New() + ":"
+	defer cleanup(prefix + "key")
+	loader := &countingLoader{stored: make(map[string]string)}
+	cache := client.NewCache[string](client.NewClient(server.URL), prefix, loader)
+	ctx := context.Background()
+
+	err := cache.Set(ctx, "key", "value")
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if loader.stored["key"] != "value" {
+		t.Fatalf("value is not written through: %v", loader.stored)
+	}
+	v, _ := cache.Get(ctx, "key")
+	if v != "value" || loader.loads != 0 {
+		t.Fatalf("unexpected value: %v, loads: %d", v, loader.loads)
+	}
+	cache.Del(ctx, "key")
+	v, _ = cache.Get(ctx, "key")
+	if v != "key:1" {
+		t.Fatalf("deleted value is not reloaded: %v", v)
+	}
+}
@@ -0,0 +1,256 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheTTL = time.Minute
+	lockPollPeriod  = 20 * time.Millisecond
+	refreshTimeout  = 30 * time.Second
+)
+
+// Loader loads value of the key missing in cache, e.g. from database.
+type Loader[T any] interface {
+	Load(ctx context.Context, key string) (T, error)
+}
+
+// LoaderFunc adapts function to Loader.
+type LoaderFunc[T any] func(ctx context.Context, key string) (T, error)
+
+func (f LoaderFunc[T]) Load(ctx context.Context, key string) (T, error) {
+	return f(ctx, key)
+}
+
+// Storer is implemented by loaders supporting write-through, Cache.Set
+// stores value with Storer before caching it.
+type Storer[T any] interface {
+	Store(ctx context.Context, key string, v T) error
+}
+
+type cacheOptions struct {
+	ttl     time.Duration
+	stale   time.Duration
+	lockTTL time.Duration
+	codec   Codec
+}
+
+// CacheOption configures Cache created with NewCache.
+type CacheOption func(*cacheOptions)
+
+// WithFreshFor sets time loaded value is considered fresh, one minute by
+// default.
+func WithFreshFor(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithStaleWhileRevalidate allows returning value up to stale after it
+// is not fresh anymore while it is reloaded in background.
+func WithStaleWhileRevalidate(stale time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.stale = stale
+	}
+}
+
+// WithLoadLock makes processes sharing the cache coordinate loading
+// with lock in sider so that only one of them calls loader, other
+// ones wait for loaded value at most ttl.
+func WithLoadLock(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.lockTTL = ttl
+	}
+}
+
+// WithCacheCodec sets codec of cached values, JSONCodec is used by
+// default.
+func WithCacheCodec(codec Codec) CacheOption {
+	return func(o *cacheOptions) {
+		o.codec = codec
+	}
+}
+
+// cached is stored representation of the value, Expires is the end of
+// freshness period.
+type cached[T any] struct {
+	Value   T         `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// call is loading of the key in progress.
+type call[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// CacheClient contains operations used by Cache, locks are used only
+// with load lock enabled.
+type CacheClient interface {
+	BucketClient
+	Lock(ctx context.Context, name string, ttl time.Duration, wait time.Duration) (*Lease, error)
+	Unlock(ctx context.Context, l *Lease) error
+}
+
+// Cache reads values from sider loading missing ones with loader.
+// Concurrent misses of the same key in the process result in one load.
+type Cache[T any] struct {
+	client CacheClient
+	prefix string
+	loader Loader[T]
+	bucket *Bucket[cached[T]]
+	cacheOptions
+
+	lock  sync.Mutex
+	calls map[string]*call[T]
+}
+
+func NewCache[T any](c CacheClient, prefix string, loader Loader[T], opts ...CacheOption) *Cache[T] {
+	cache := &Cache[T]{
+		client:       c,
+		prefix:       prefix,
+		loader:       loader,
+		cacheOptions: cacheOptions{ttl: defaultCacheTTL, codec: JSONCodec},
+		calls:        make(map[string]*call[T]),
+	}
+	for _, opt := range opts {
+		opt(&cache.cacheOptions)
+	}
+	cache.bucket = NewBucket[cached[T]](c, prefix, WithCodec(cache.codec))
+	return cache
+}
+
+// Get returns cached value of the key loading it on miss. Value which
+// is not fresh but is within stale period is returned immediately and
+// reloaded in background.
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	e, err := c.bucket.Get(ctx, key)
+	switch {
+	case err == nil && time.Now().Before(e.Expires):
+		return e.Value, nil
+	case err == nil:
+		c.refresh(key)
+		return e.Value, nil
+	case errors.Is(err, ErrNotFound):
+		return c.do(ctx, key, c.fill)
+	default:
+		var zero T
+		return zero, err
+	}
+}
+
+// Set stores value with loader if it implements Storer and caches it.
+func (c *Cache[T]) Set(ctx context.Context, key string, v T) error {
+	if s, ok := c.loader.(Storer[T]); ok {
+		err := s.Store(ctx, key, v)
+		if err != nil {
+			return err
+		}
+	}
+	return c.put(ctx, key, v)
+}
+
+// Del removes cached value so that it is loaded on next Get.
+func (c *Cache[T]) Del(ctx context.Context, key string) error {
+	err := c.bucket.Del(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (c *Cache[T]) put(ctx context.Context, key string, v T) error {
+	return c.bucket.SetTTL(ctx, key, cached[T]{Value: v, Expires: time.Now().Add(c.ttl)}, c.ttl+c.stale)
+}
+
+// refresh reloads stale value in background unless it is already being
+// loaded. Refresh takes load lock like fill does and keeps stale value
+// if the lock is held by another process.
+func (c *Cache[T]) refresh(key string) {
+	c.lock.Lock()
+	_, ok := c.calls[key]
+	c.lock.Unlock()
+	if ok {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		c.do(ctx, key, c.fill)
+	}()
+}
+
+// do calls fn once for concurrent callers with the same key.
+func (c *Cache[T]) do(ctx context.Context, key string, fn func(context.Context, string) (T, error)) (T, error) {
+	c.lock.Lock()
+	if cl, ok := c.calls[key]; ok {
+		c.lock.Unlock()
+		select {
+		case <-cl.done:
+			return cl.value, cl.err
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+	cl := &call[T]{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.lock.Unlock()
+
+	cl.value, cl.err = fn(ctx, key)
+	c.lock.Lock()
+	delete(c.calls, key)
+	c.lock.Unlock()
+	close(cl.done)
+	return cl.value, cl.err
+}
+
+// load calls loader and caches loaded value, failure to cache value
+// does not fail the load.
+func (c *Cache[T]) load(ctx context.Context, key string) (T, error) {
+	v, err := c.loader.Load(ctx, key)
+	if err != nil {
+		return v, err
+	}
+	c.put(ctx, key, v)
+	return v, nil
+}
+
+// fill loads value holding load lock if it is enabled. When lock is
+// held by another process fill waits for the value to appear and loads
+// it itself if it does not appear in lock ttl. Lock is released only if
+// it was not taken over by another process after lock ttl.
+func (c *Cache[T]) fill(ctx context.Context, key string) (T, error) {
+	if c.lockTTL <= 0 {
+		return c.load(ctx, key)
+	}
+	l, err := c.client.Lock(ctx, c.prefix+key, c.lockTTL, 0)
+	if err == nil {
+		defer c.client.Unlock(context.Background(), l)
+		return c.load(ctx, key)
+	}
+	if !errors.Is(err, ErrConflict) {
+		return c.load(ctx, key)
+	}
+	timeout := time.NewTimer(c.lockTTL)
+	defer timeout.Stop()
+	ticker := time.NewTicker(lockPollPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-timeout.C:
+			return c.load(ctx, key)
+		case <-ticker.C:
+			if e, err := c.bucket.Get(ctx, key); err == nil {
+				return e.Value, nil
+			}
+		}
+	}
+}
@@ -5,119 +5,292 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
+const defaultRateLimitRetries = 3
+
+// Interface contains key operations of Client and NearCache, it allows
+// to substitute client in tests.
+type Interface interface {
+	Keys(ctx context.Context) ([]string, error)
+	Get(ctx context.Context, key string) (interface{}, error)
+	GetInto(ctx context.Context, key string, v interface{}) error
+	Set(ctx context.Context, key string, body io.Reader, ttl time.Duration) error
+	Put(ctx context.Context, key string, body io.Reader, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Rename(ctx context.Context, src string, dst string, ttl time.Duration) error
+	Copy(ctx context.Context, src string, dst string, ttl time.Duration) error
+	Flush(ctx context.Context) error
+}
+
+var _ Interface = (*Client)(nil)
+
 type Client struct {
 	Endpoint string
+	// Namespace scopes key operations, empty means default namespace.
+	Namespace  string
+	Token      string
+	HTTPClient *http.Client
+	// Timeout limits each request including reading response, zero
+	// means no limit besides context deadline.
+	Timeout time.Duration
+	// Header is added to every request.
+	Header    http.Header
+	UserAgent string
+	// RateLimitRetries is a number of times request is repeated
+	// after waiting for Retry-After when server responds with 429.
+	RateLimitRetries int
+	// Retry is applied to idempotent requests failed with network
+	// error or server unavailability.
+	Retry RetryPolicy
 }
 
-func NewClient(endpoint string) *Client {
-	return &Client{endpoint}
+func NewClient(endpoint string, opts ...Option) *Client {
+	c := &Client{Endpoint: endpoint, RateLimitRetries: defaultRateLimitRetries}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-func (c *Client) Keys(ctx context.Context) ([]string, error) {
-	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/keys", c.Endpoint), nil)
-	if err != nil {
-		return nil, fmt.Errorf("new request: %v", err)
-	}
-	resp, err := http.DefaultClient.Do(r.WithContext(ctx))
-	if resp != nil {
-		defer resp.Body.Close()
+func (c *Client) keysURL() string {
+	if c.Namespace == "" {
+		return fmt.Sprintf("%s/keys", c.Endpoint)
 	}
+	return fmt.Sprintf("%s/ns/%s/keys", c.Endpoint, url.PathEscape(c.Namespace))
+}
+
+func (c *Client) keyURL(key string) string {
+	return fmt.Sprintf("%s/%s", c.keysURL(), url.PathEscape(key))
+}
+
+// call sends request and decodes response into v if v is not nil.
+func (c *Client) call(ctx context.Context, op string, method string, u string, body io.Reader, v interface{}) error {
+	resp, err := c.send(ctx, op, method, u, body)
 	if err != nil {
-		return nil, fmt.Errorf("keys: %v", err)
+		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		msg, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("keys: %v", err)
-		}
-		return nil, fmt.Errorf("keys: %s", string(msg))
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
 	}
-	var keys []string
-	err = json.NewDecoder(resp.Body).Decode(&keys)
+	err = json.NewDecoder(resp.Body).Decode(v)
 	if err != nil {
-		return nil, fmt.Errorf("decode response: %v", err)
+		return fmt.Errorf("decode response: %v", err)
 	}
-	return keys, nil
+	return nil
 }
 
-func (c *Client) Get(ctx context.Context, key string) (interface{}, error) {
-	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/keys/%s", c.Endpoint, key), nil)
+// send sends request and returns response with successful status,
+// caller must close response body.
+func (c *Client) send(ctx context.Context, op string, method string, u string, body io.Reader) (*http.Response, error) {
+	r, err := http.NewRequest(method, u, body)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %v", err)
 	}
-	resp, err := http.DefaultClient.Do(r.WithContext(ctx))
-	if resp != nil {
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		defer resp.Body.Close()
+		return nil, responseError(op, resp)
 	}
+	return resp, nil
+}
+
+// cancelBody releases request timeout when response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (c *Client) do(ctx context.Context, r *http.Request) (*http.Response, error) {
+	c.prepare(r)
+	cancel := context.CancelFunc(func() {})
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+	resp, err := c.retry(ctx, r)
 	if err != nil {
-		return nil, fmt.Errorf("get: %v", err)
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// prepare adds configured headers to request.
+func (c *Client) prepare(r *http.Request) {
+	for k, v := range c.Header {
+		r.Header[k] = v
+	}
+	if c.UserAgent != "" {
+		r.Header.Set("User-Agent", c.UserAgent)
+	}
+	if c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.Token)
 	}
-	if resp.StatusCode != http.StatusOK {
-		msg, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("keys: %v", err)
+}
+
+func (c *Client) retry(ctx context.Context, r *http.Request) (*http.Response, error) {
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	idempotent := idempotent(r.Method)
+	rateLimited, failed := 0, 0
+	for {
+		resp, err := hc.Do(r.WithContext(ctx))
+		var wait time.Duration
+		switch {
+		case (err != nil || unavailable(resp.StatusCode)) && idempotent && failed+1 < c.Retry.Attempts:
+			wait = c.Retry.backoff(failed)
+			failed++
+		case err != nil:
+			return nil, err
+		case resp.StatusCode == http.StatusTooManyRequests && rateLimited < c.RateLimitRetries:
+			var ok bool
+			wait, ok = retryAfter(resp)
+			if !ok {
+				return resp, nil
+			}
+			rateLimited++
+		default:
+			return resp, nil
+		}
+		if r.Body != nil && r.GetBody == nil {
+			return resp, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
 		}
-		return nil, fmt.Errorf("get: %s", string(msg))
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if r.GetBody != nil {
+			r.Body, err = r.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("rewind body: %v", err)
+			}
+		}
+	}
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	h := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(h); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
 	}
+	if t, err := http.ParseTime(h); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+func (c *Client) Keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	err := c.call(ctx, "keys", http.MethodGet, c.keysURL(), nil, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (interface{}, error) {
 	var value interface{}
-	err = json.NewDecoder(resp.Body).Decode(&value)
+	err := c.GetInto(ctx, key, &value)
 	if err != nil {
-		return nil, fmt.Errorf("decode response: %v", err)
+		return nil, err
 	}
 	return value, nil
 }
 
+// GetInto decodes value of the key into v.
+func (c *Client) GetInto(ctx context.Context, key string, v interface{}) error {
+	return c.call(ctx, "get", http.MethodGet, c.keyURL(key), nil, v)
+}
+
+// Set stores value of the key failing with ErrConflict if key exists.
 func (c *Client) Set(ctx context.Context, key string, body io.Reader, ttl time.Duration) error {
-	var u string
+	return c.call(ctx, "set", http.MethodPost, c.ttlURL(key, ttl), body, nil)
+}
+
+// Put stores value of the key replacing existing one.
+func (c *Client) Put(ctx context.Context, key string, body io.Reader, ttl time.Duration) error {
+	return c.call(ctx, "put", http.MethodPut, c.ttlURL(key, ttl), body, nil)
+}
+
+func (c *Client) ttlURL(key string, ttl time.Duration) string {
+	u := c.keyURL(key)
 	if ttl != 0 {
-		u = fmt.Sprintf("%s/keys/%s?ttl=%v", c.Endpoint, key, ttl)
-	} else {
-		u = fmt.Sprintf("%s/keys/%s", c.Endpoint, key)
-	}
-	r, err := http.NewRequest(http.MethodPost, u, body)
-	if err != nil {
-		return fmt.Errorf("new request: %v", err)
-	}
-	resp, err := http.DefaultClient.Do(r.WithContext(ctx))
-	if resp != nil {
-		defer resp.Body.Close()
+		u = fmt.Sprintf("%s?ttl=%v", u, ttl)
 	}
-	if err != nil {
-		return fmt.Errorf("set: %v", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		msg, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("set: %v", err)
-		}
-		return fmt.Errorf("set: %s", string(msg))
-	}
-	return nil
+	return u
 }
 
 func (c *Client) Del(ctx context.Context, key string) error {
-	r, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/keys/%s", c.Endpoint, key), nil)
+	return c.call(ctx, "del", http.MethodDelete, c.keyURL(key), nil, nil)
+}
+
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	r, err := http.NewRequest(http.MethodHead, c.keyURL(key), nil)
 	if err != nil {
-		return fmt.Errorf("new request: %v", err)
-	}
-	resp, err := http.DefaultClient.Do(r.WithContext(ctx))
-	if resp != nil {
-		defer resp.Body.Close()
+		return false, fmt.Errorf("new request: %v", err)
 	}
+	resp, err := c.do(ctx, r)
 	if err != nil {
-		return fmt.Errorf("del: %v", err)
+		return false, fmt.Errorf("exists: %v", err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		msg, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("del: %v", err)
-		}
-		return fmt.Errorf("del: %s", string(msg))
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, &Error{Op: "exists", StatusCode: resp.StatusCode, Message: resp.Status}
 	}
-	return nil
+}
+
+// Persist passed as ttl to Rename or Copy removes expiration of the
+// destination key, zero ttl keeps remaining time to live of the source.
+const Persist time.Duration = -1
+
+func (c *Client) Rename(ctx context.Context, src string, dst string, ttl time.Duration) error {
+	return c.call(ctx, "rename", http.MethodPost, c.copyURL(src, "rename", dst, ttl), nil, nil)
+}
+
+func (c *Client) Copy(ctx context.Context, src string, dst string, ttl time.Duration) error {
+	return c.call(ctx, "copy", http.MethodPost, c.copyURL(src, "copy", dst, ttl), nil, nil)
+}
+
+func (c *Client) copyURL(src string, action string, dst string, ttl time.Duration) string {
+	u := fmt.Sprintf("%s/%s?to=%s", c.keyURL(src), action, url.QueryEscape(dst))
+	switch {
+	case ttl == Persist:
+		u += "&persist=true"
+	case ttl > 0:
+		u += fmt.Sprintf("&ttl=%v", ttl)
+	}
+	return u
+}
+
+// FlushAll deletes all keys in all namespaces.
+func (c *Client) FlushAll(ctx context.Context) error {
+	return c.call(ctx, "flush", http.MethodPost, fmt.Sprintf("%s/admin/flush", c.Endpoint), nil, nil)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -228,3 +229,311 @@ func TestServerBadJSONResponse(t *testing.T) {
 		t.Errorf("unexpected pass")
 	}
 }
+
+func TestToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		if h := r.Header.Get("Authorization"); h != "Bearer secret" {
+			t.Fatalf("unexpected authorization header: %s", h)
+		}
+		json.NewEncoder(w).Encode([]string{})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.Token = "secret"
+
+	_, err := client.Keys(context.Background())
+	if err != nil {
+		t.Errorf("query keys: %v", err)
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	attempts := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		var v interface{}
+		err := json.NewDecoder(r.Body).Decode(&v)
+		if err != nil {
+			t.Fatalf("decode body on attempt %d: %v", attempts, err)
+		}
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	err := client.Set(context.Background(), "0", bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Errorf("set: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("unexpected number of attempts: %d", attempts)
+	}
+}
+
+func TestRateLimitRetriesExceeded(t *testing.T) {
+	attempts := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "0")
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	_, err := client.Keys(context.Background())
+	if err == nil {
+		t.Errorf("unexpected pass")
+	}
+	if attempts != defaultRateLimitRetries+1 {
+		t.Errorf("unexpected number of attempts: %d", attempts)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ns/test/keys/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(struct{}{})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL).Scoped("test")
+
+	_, err := client.Get(context.Background(), "0")
+	if err != nil {
+		t.Errorf("get: %v", err)
+	}
+}
+
+func TestEscapedKey(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ns/", func(w http.ResponseWriter, r *http.Request) {
+		if path := r.URL.EscapedPath(); path != "/ns/a%20b/keys/a%2Fb%3Fc%23d" {
+			t.Errorf("unexpected path: %s", path)
+		}
+		json.NewEncoder(w).Encode(struct{}{})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL).Scoped("a b")
+
+	_, err := client.Get(context.Background(), "a/b?c#d")
+	if err != nil {
+		t.Errorf("get: %v", err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Fatalf("unexpected method: %s", r.Method)
+		}
+		if r.URL.Path != "/keys/0" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	ok, err := client.Exists(context.Background(), "0")
+	if err != nil || !ok {
+		t.Errorf("exists: %v, %v", ok, err)
+	}
+	ok, err = client.Exists(context.Background(), "1")
+	if err != nil || ok {
+		t.Errorf("exists: %v, %v", ok, err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/0/rename", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Fatalf("unexpected method: %s", r.Method)
+		}
+		if to := r.FormValue("to"); to != "1" {
+			t.Fatalf("unexpected destination: %s", to)
+		}
+		if persist := r.FormValue("persist"); persist != "true" {
+			t.Fatalf("unexpected persist: %s", persist)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	err := client.Rename(context.Background(), "0", "1", Persist)
+	if err != nil {
+		t.Errorf("rename: %v", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ns/test/keys", func(w http.ResponseWriter, r *http.Request) {
+		if h := r.Header.Get("Authorization"); h != "Bearer secret" {
+			t.Fatalf("unexpected authorization header: %s", h)
+		}
+		if h := r.Header.Get("User-Agent"); h != "service/1.0" {
+			t.Fatalf("unexpected user agent: %s", h)
+		}
+		if h := r.Header.Get("X-Request-Id"); h != "42" {
+			t.Fatalf("unexpected request id: %s", h)
+		}
+		json.NewEncoder(w).Encode([]string{})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var client Interface = NewClient(server.URL,
+		WithHTTPClient(&http.Client{}),
+		WithToken("secret"),
+		WithUserAgent("service/1.0"),
+		WithHeader("X-Request-Id", "42"),
+		WithNamespace("test"),
+		WithTimeout(time.Second))
+
+	_, err := client.Keys(context.Background())
+	if err != nil {
+		t.Errorf("query keys: %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL, WithTimeout(10*time.Millisecond))
+
+	_, err := client.Keys(context.Background())
+	if err == nil {
+		t.Errorf("unexpected pass")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/0", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode("value")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL, WithRetryPolicy(RetryPolicy{Attempts: 3, MinBackoff: time.Millisecond}))
+
+	v, err := client.Get(context.Background(), "0")
+	if err != nil {
+		t.Errorf("get: %v", err)
+	}
+	if v != "value" || attempts != 3 {
+		t.Errorf("unexpected value: %v, attempts: %d", v, attempts)
+	}
+
+	attempts = 0
+	err = client.Set(context.Background(), "0", bytes.NewReader([]byte("{}")), 0)
+	if err == nil {
+		t.Errorf("unexpected pass")
+	}
+	if attempts != 1 {
+		t.Errorf("non idempotent request is retried: %d", attempts)
+	}
+}
+
+func TestRetryExceeded(t *testing.T) {
+	attempts := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/0", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL, WithRetryPolicy(RetryPolicy{Attempts: 2}))
+
+	err := client.Del(context.Background(), "0")
+	if err == nil {
+		t.Errorf("unexpected pass")
+	}
+	if attempts != 2 {
+		t.Errorf("unexpected number of attempts: %d", attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		d := p.backoff(attempt)
+		if d < max/2 || d > max {
+			t.Errorf("backoff %d is out of range: %v", attempt, d)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code":404,"message":"Key [json] not found."}`)
+	})
+	mux.HandleFunc("/keys/text", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Key already exists", http.StatusConflict)
+	})
+	mux.HandleFunc("/keys/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	_, err := client.Get(context.Background(), "json")
+	var e *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &e) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.StatusCode != http.StatusNotFound || e.Message != "Key [json] not found." || e.Op != "get" {
+		t.Errorf("unexpected error: %#v", e)
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Errorf("not found error matches conflict")
+	}
+
+	err = client.Del(context.Background(), "text")
+	if !errors.Is(err, ErrConflict) || err.Error() != "del: Key already exists" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = client.Del(context.Background(), "empty")
+	if !errors.Is(err, ErrPreconditionFailed) || err.Error() != "del: 412 Precondition Failed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Conflict resolution modes for Restore.
+const (
+	RestoreSkip      = "skip"
+	RestoreOverwrite = "overwrite"
+	RestoreFail      = "fail"
+)
+
+type RestoreResult struct {
+	Restored int `json:"restored"`
+	Skipped  int `json:"skipped"`
+}
+
+// Dump streams all keys of all namespaces as newline delimited json
+// records to w.
+func (c *Client) Dump(ctx context.Context, w io.Writer) error {
+	resp, err := c.send(ctx, "dump", http.MethodGet, fmt.Sprintf("%s/admin/dump", c.Endpoint), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("dump: %v", err)
+	}
+	return nil
+}
+
+// Restore streams records produced by Dump from r to the server
+// resolving conflicts with existing keys according to mode.
+func (c *Client) Restore(ctx context.Context, r io.Reader, mode string) (*RestoreResult, error) {
+	var result RestoreResult
+	err := c.call(ctx, "restore", http.MethodPost, fmt.Sprintf("%s/admin/restore?mode=%s", c.Endpoint, url.QueryEscape(mode)), ioutil.NopCloser(r), &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
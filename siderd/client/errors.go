@@ -0,0 +1,74 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Errors matching Error by response status code with errors.Is.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrInvalidValue       = errors.New("invalid value")
+	ErrTooLarge           = errors.New("too large")
+)
+
+var statusErrors = map[int]error{
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusConflict:              ErrConflict,
+	http.StatusPreconditionFailed:    ErrPreconditionFailed,
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusTooManyRequests:       ErrRateLimited,
+	http.StatusUnprocessableEntity:   ErrInvalidValue,
+	http.StatusRequestEntityTooLarge: ErrTooLarge,
+}
+
+// Error is returned when server responds with unsuccessful status,
+// use errors.As to get status code and server message.
+type Error struct {
+	Op         string
+	StatusCode int
+	Message    string
+	// Path is json pointer to the part of the value rejected by schema.
+	Path string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
+
+// responseError reads error message from json body of the response
+// falling back to body text and status.
+func responseError(op string, resp *http.Response) error {
+	e := &Error{Op: op, StatusCode: resp.StatusCode}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	var body struct {
+		Message string `json:"message"`
+		Path    string `json:"path"`
+	}
+	if json.Unmarshal(b, &body) == nil && body.Message != "" {
+		e.Message, e.Path = body.Message, body.Path
+	} else {
+		e.Message = strings.TrimSpace(string(b))
+	}
+	if e.Message == "" {
+		e.Message = resp.Status
+	}
+	return e
+}
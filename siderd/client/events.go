@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Event types.
+const (
+	EventSet    = "set"
+	EventDel    = "del"
+	EventExpire = "expire"
+)
+
+// Event describes change of the key.
+type Event struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+func (c *Client) eventsURL(pattern string) string {
+	u := fmt.Sprintf("%s/events", c.Endpoint)
+	if c.Namespace != "" {
+		u = fmt.Sprintf("%s/ns/%s/events", c.Endpoint, url.PathEscape(c.Namespace))
+	}
+	if pattern != "" {
+		u += "?pattern=" + url.QueryEscape(pattern)
+	}
+	return u
+}
+
+// Events subscribes to changes of keys matching glob pattern in client
+// namespace. Returned channel is closed when ctx is cancelled or stream
+// breaks, e.g. because subscriber is too slow, events can be lost
+// after that. Client timeout does not apply to event stream.
+func (c *Client) Events(ctx context.Context, pattern string) (<-chan Event, error) {
+	r, err := http.NewRequest(http.MethodGet, c.eventsURL(pattern), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %v", err)
+	}
+	c.prepare(r)
+	resp, err := c.retry(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("events: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError("events", resp)
+	}
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var e Event
+			if err := dec.Decode(&e); err != nil {
+				return
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// IndexInfo describes secondary index and number of indexed keys.
+type IndexInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Keys int    `json:"keys"`
+}
+
+// Query selects keys by indexed value, nil bounds are not applied. Eq,
+// Gt, Gte, Lt and Lte must be numbers or strings.
+type Query struct {
+	Eq     interface{}
+	Gt     interface{}
+	Gte    interface{}
+	Lt     interface{}
+	Lte    interface{}
+	Limit  int
+	Cursor string
+	// Values includes values of the keys in the result.
+	Values bool
+}
+
+type QueryItem struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// QueryResult contains matching keys ordered by indexed value, non
+// empty Cursor continues the query.
+type QueryResult struct {
+	Items  []QueryItem `json:"items"`
+	Cursor string      `json:"cursor,omitempty"`
+}
+
+func (c *Client) indexesURL() string {
+	if c.Namespace == "" {
+		return fmt.Sprintf("%s/indexes", c.Endpoint)
+	}
+	return fmt.Sprintf("%s/ns/%s/indexes", c.Endpoint, url.PathEscape(c.Namespace))
+}
+
+func (c *Client) indexURL(name string) string {
+	return fmt.Sprintf("%s/%s", c.indexesURL(), url.PathEscape(name))
+}
+
+// CreateIndex indexes values at json pointer path, fails with
+// ErrConflict if index exists.
+func (c *Client) CreateIndex(ctx context.Context, name string, path string) error {
+	b, err := json.Marshal(struct {
+		Path string `json:"path"`
+	}{path})
+	if err != nil {
+		return fmt.Errorf("create index: encode request: %v", err)
+	}
+	return c.call(ctx, "create index", http.MethodPut, c.indexURL(name), bytes.NewReader(b), nil)
+}
+
+func (c *Client) DropIndex(ctx context.Context, name string) error {
+	return c.call(ctx, "drop index", http.MethodDelete, c.indexURL(name), nil, nil)
+}
+
+func (c *Client) Indexes(ctx context.Context) ([]IndexInfo, error) {
+	var infos []IndexInfo
+	err := c.call(ctx, "indexes", http.MethodGet, c.indexesURL(), nil, &infos)
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// Query returns keys of the index matching q.
+func (c *Client) Query(ctx context.Context, name string, q Query) (*QueryResult, error) {
+	params := url.Values{}
+	for _, p := range []struct {
+		name  string
+		value interface{}
+	}{{"eq", q.Eq}, {"gt", q.Gt}, {"gte", q.Gte}, {"lt", q.Lt}, {"lte", q.Lte}} {
+		if p.value == nil {
+			continue
+		}
+		b, err := json.Marshal(p.value)
+		if err != nil {
+			return nil, fmt.Errorf("query: encode %s: %v", p.name, err)
+		}
+		params.Set(p.name, string(b))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		params.Set("cursor", q.Cursor)
+	}
+	if q.Values {
+		params.Set("values", "true")
+	}
+	var result QueryResult
+	err := c.call(ctx, "query", http.MethodGet, c.indexURL(name)+"?"+params.Encode(), nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
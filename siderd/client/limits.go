@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// BigKey is the key with the size of its value in bytes.
+type BigKey struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+}
+
+// BigKeys returns at most count largest keys of namespace ordered by
+// size, empty namespace means all namespaces.
+func (c *Client) BigKeys(ctx context.Context, namespace string, count int) ([]BigKey, error) {
+	params := url.Values{}
+	params.Set("count", strconv.Itoa(count))
+	if namespace != "" {
+		params.Set("ns", namespace)
+	}
+	var keys []BigKey
+	err := c.call(ctx, "big keys", http.MethodGet, fmt.Sprintf("%s/admin/bigkeys?%s", c.Endpoint, params.Encode()), nil, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// maxWait is maximal wait for the lock or message in one request.
+	maxWait = time.Minute
+	// defaultLeaseTTL is lease ttl of the server used when ttl is zero.
+	defaultLeaseTTL = 30 * time.Second
+)
+
+// Lease is a held lock, Owner token is required to renew and release
+// it. Fence grows with every acquisition of any lock and can be passed
+// to storage systems to reject writes of stale lock holders.
+type Lease struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	Fence uint64 `json:"fence"`
+	TTL   string `json:"ttl"`
+}
+
+func (c *Client) lockURL(name string) string {
+	if c.Namespace == "" {
+		return fmt.Sprintf("%s/locks/%s", c.Endpoint, url.PathEscape(name))
+	}
+	return fmt.Sprintf("%s/ns/%s/locks/%s", c.Endpoint, url.PathEscape(c.Namespace), url.PathEscape(name))
+}
+
+// Lock acquires the lock for ttl waiting at most wait for it to be
+// released, fails with ErrConflict if lock is held by another owner.
+// Zero ttl means default lease ttl of the server.
+func (c *Client) Lock(ctx context.Context, name string, ttl time.Duration, wait time.Duration) (*Lease, error) {
+	u := fmt.Sprintf("%s?wait=%v", c.lockURL(name), wait)
+	if ttl > 0 {
+		u = fmt.Sprintf("%s&ttl=%v", u, ttl)
+	}
+	var l Lease
+	err := c.call(ctx, "lock", http.MethodPost, u, nil, &l)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Renew extends the lease for ttl, fails with ErrPreconditionFailed if
+// lease has expired or lock was taken by another owner.
+func (c *Client) Renew(ctx context.Context, l *Lease, ttl time.Duration) error {
+	u := fmt.Sprintf("%s/renew?owner=%s", c.lockURL(l.Name), url.QueryEscape(l.Owner))
+	if ttl > 0 {
+		u = fmt.Sprintf("%s&ttl=%v", u, ttl)
+	}
+	return c.call(ctx, "renew", http.MethodPost, u, nil, l)
+}
+
+// Unlock releases the lock, fails with ErrPreconditionFailed if lease
+// has expired or lock was taken by another owner.
+func (c *Client) Unlock(ctx context.Context, l *Lease) error {
+	u := fmt.Sprintf("%s?owner=%s", c.lockURL(l.Name), url.QueryEscape(l.Owner))
+	return c.call(ctx, "unlock", http.MethodDelete, u, nil, nil)
+}
+
+// pollWait returns time to wait in one request fitting it into ctx
+// deadline and request timeout.
+func (c *Client) pollWait(ctx context.Context) time.Duration {
+	wait := maxWait
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		wait = time.Until(deadline)
+	}
+	if t := c.Timeout / 2; t > 0 && t < wait {
+		wait = t
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// Mutex is a distributed lock renewed automatically while it is held.
+type Mutex struct {
+	client *Client
+	name   string
+	ttl    time.Duration
+
+	lock  sync.Mutex
+	lease *Lease
+	stop  chan struct{}
+	done  chan struct{}
+	lost  chan struct{}
+}
+
+// NewMutex returns mutex with lease ttl, lease is renewed every third
+// of ttl. Zero ttl means default lease ttl of the server.
+func (c *Client) NewMutex(name string, ttl time.Duration) *Mutex {
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+	return &Mutex{client: c, name: name, ttl: ttl}
+}
+
+// Lock waits for the lock until it is acquired or ctx is done.
+func (m *Mutex) Lock(ctx context.Context) error {
+	for {
+		err := m.acquire(ctx, m.client.pollWait(ctx))
+		switch {
+		case err == nil:
+			return nil
+		case !errors.Is(err, ErrConflict):
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		}
+	}
+}
+
+// TryLock acquires the lock without waiting, fails with ErrConflict if
+// lock is held.
+func (m *Mutex) TryLock(ctx context.Context) error {
+	return m.acquire(ctx, 0)
+}
+
+func (m *Mutex) acquire(ctx context.Context, wait time.Duration) error {
+	l, err := m.client.Lock(ctx, m.name, m.ttl, wait)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.lease = l
+	m.stop, m.done, m.lost = make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go m.renew(*l, m.stop, m.done, m.lost)
+	return nil
+}
+
+func (m *Mutex) renew(l Lease, stop chan struct{}, done chan struct{}, lost chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), m.ttl/3)
+			err := m.client.Renew(ctx, &l, m.ttl)
+			cancel()
+			if errors.Is(err, ErrPreconditionFailed) {
+				close(lost)
+				return
+			}
+		}
+	}
+}
+
+// Unlock stops renewal and releases the lock.
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.lock.Lock()
+	l, stop, done := m.lease, m.stop, m.done
+	m.lease = nil
+	m.lock.Unlock()
+	if l == nil {
+		return fmt.Errorf("unlock: mutex [%s] is not locked", m.name)
+	}
+	close(stop)
+	<-done
+	return m.client.Unlock(ctx, l)
+}
+
+// Fence returns fencing token of held lock, zero if mutex is not locked.
+func (m *Mutex) Fence() uint64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.lease == nil {
+		return 0
+	}
+	return m.lease.Fence
+}
+
+// Lost returns channel closed when lease could not be renewed because
+// it expired, work protected by the mutex must be stopped then.
+func (m *Mutex) Lost() <-chan struct{} {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.lost
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Stats describes namespace size and operation counters.
+type Stats struct {
+	Name      string `json:"name"`
+	Keys      int    `json:"keys"`
+	Memory    int64  `json:"memory"`
+	MaxMemory int64  `json:"max_memory"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Sets      uint64 `json:"sets"`
+	Dels      uint64 `json:"dels"`
+	Expired   uint64 `json:"expired"`
+
+	// Compressed is number of compressed values, CompressionRatio is
+	// their original size divided by compressed size.
+	Compressed       int     `json:"compressed"`
+	CompressionRatio float64 `json:"compression_ratio"`
+}
+
+// Scoped returns a copy of the client operating on keys in namespace.
+func (c *Client) Scoped(namespace string) *Client {
+	cl := *c
+	cl.Namespace = namespace
+	return &cl
+}
+
+func (c *Client) Namespaces(ctx context.Context) ([]string, error) {
+	var names []string
+	err := c.call(ctx, "namespaces", http.MethodGet, fmt.Sprintf("%s/ns", c.Endpoint), nil, &names)
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// CreateNamespace creates namespace, zero maxMemory means no memory limit.
+func (c *Client) CreateNamespace(ctx context.Context, name string, maxMemory int64) error {
+	u := fmt.Sprintf("%s/ns/%s", c.Endpoint, url.PathEscape(name))
+	if maxMemory > 0 {
+		u = fmt.Sprintf("%s?max-memory=%d", u, maxMemory)
+	}
+	return c.call(ctx, "create namespace", http.MethodPost, u, nil, nil)
+}
+
+func (c *Client) DropNamespace(ctx context.Context, name string) error {
+	return c.call(ctx, "drop namespace", http.MethodDelete, fmt.Sprintf("%s/ns/%s", c.Endpoint, url.PathEscape(name)), nil, nil)
+}
+
+func (c *Client) Stats(ctx context.Context, name string) (*Stats, error) {
+	var stats Stats
+	err := c.call(ctx, "stats", http.MethodGet, fmt.Sprintf("%s/ns/%s", c.Endpoint, url.PathEscape(name)), nil, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Flush deletes all keys in client namespace.
+func (c *Client) Flush(ctx context.Context) error {
+	return c.call(ctx, "flush", http.MethodDelete, c.keysURL(), nil, nil)
+}
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	minResubscribe = 100 * time.Millisecond
+	maxResubscribe = 5 * time.Second
+)
+
+// NearCacheStats describes near cache efficiency.
+type NearCacheStats struct {
+	Size          int    `json:"size"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+type nearEntry struct {
+	key     string
+	value   json.RawMessage
+	expires time.Time
+}
+
+// fetch tracks reads of the key in progress, version is changed when
+// key is invalidated so that stale value is not cached.
+type fetch struct {
+	refs    int
+	version uint64
+}
+
+// NearCacheClient contains operations used by NearCache, key changes
+// are watched with Events.
+type NearCacheClient interface {
+	Interface
+	FlushAll(ctx context.Context) error
+	Events(ctx context.Context, pattern string) (<-chan Event, error)
+}
+
+// NearCache is a client keeping recently read values in process memory.
+// Cached values are invalidated by key change events from the server,
+// values are not cached while event stream is not connected.
+type NearCache struct {
+	client NearCacheClient
+	size   int
+	ttl    time.Duration
+
+	lock      sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List
+	fetches   map[string]*fetch
+	connected bool
+	stats     NearCacheStats
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewNearCache wraps client with cache of at most size values kept for
+// at most ttl. Zero size means no size limit and zero ttl means values
+// are kept until invalidated. Close must be called to stop watching
+// events.
+func NewNearCache(c NearCacheClient, size int, ttl time.Duration) *NearCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	nc := &NearCache{
+		client:  c,
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		fetches: make(map[string]*fetch),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go nc.watch(ctx)
+	return nc
+}
+
+var _ Interface = (*NearCache)(nil)
+
+// Close stops watching events and drops cached values.
+func (nc *NearCache) Close() {
+	nc.cancel()
+	<-nc.done
+}
+
+func (nc *NearCache) watch(ctx context.Context) {
+	defer close(nc.done)
+	wait := minResubscribe
+	for {
+		events, err := nc.client.Events(ctx, "")
+		if err == nil {
+			wait = minResubscribe
+			nc.setConnected(true)
+			for e := range events {
+				nc.invalidate(e.Key)
+			}
+			nc.setConnected(false)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err != nil && wait < maxResubscribe {
+			wait *= 2
+		}
+	}
+}
+
+func (nc *NearCache) setConnected(connected bool) {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	nc.connected = connected
+	nc.clear()
+}
+
+// clear drops all values, must be called with lock held.
+func (nc *NearCache) clear() {
+	nc.entries = make(map[string]*list.Element)
+	nc.lru.Init()
+	for _, f := range nc.fetches {
+		f.version++
+	}
+}
+
+func (nc *NearCache) invalidate(keys ...string) {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	for _, key := range keys {
+		if el, ok := nc.entries[key]; ok {
+			nc.lru.Remove(el)
+			delete(nc.entries, key)
+			atomic.AddUint64(&nc.stats.Invalidations, 1)
+		}
+		if f, ok := nc.fetches[key]; ok {
+			f.version++
+		}
+	}
+}
+
+func (nc *NearCache) lookup(key string) (json.RawMessage, bool) {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	el, ok := nc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*nearEntry)
+	if nc.ttl > 0 && time.Now().After(e.expires) {
+		nc.lru.Remove(el)
+		delete(nc.entries, key)
+		return nil, false
+	}
+	nc.lru.MoveToFront(el)
+	return e.value, true
+}
+
+func (nc *NearCache) begin(key string) (*fetch, uint64) {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	f, ok := nc.fetches[key]
+	if !ok {
+		f = &fetch{}
+		nc.fetches[key] = f
+	}
+	f.refs++
+	return f, f.version
+}
+
+// end stores fetched value unless key was invalidated during fetch.
+func (nc *NearCache) end(key string, f *fetch, version uint64, value json.RawMessage) {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	f.refs--
+	if f.refs == 0 {
+		delete(nc.fetches, key)
+	}
+	if value == nil || !nc.connected || f.version != version {
+		return
+	}
+	e := &nearEntry{key: key, value: value, expires: time.Now().Add(nc.ttl)}
+	if el, ok := nc.entries[key]; ok {
+		el.Value = e
+		nc.lru.MoveToFront(el)
+		return
+	}
+	nc.entries[key] = nc.lru.PushFront(e)
+	for nc.size > 0 && nc.lru.Len() > nc.size {
+		el := nc.lru.Back()
+		nc.lru.Remove(el)
+		delete(nc.entries, el.Value.(*nearEntry).key)
+		atomic.AddUint64(&nc.stats.Evictions, 1)
+	}
+}
+
+// GetInto decodes value of the key into v reading it from the server
+// only if it is not cached.
+func (nc *NearCache) GetInto(ctx context.Context, key string, v interface{}) error {
+	if value, ok := nc.lookup(key); ok {
+		atomic.AddUint64(&nc.stats.Hits, 1)
+		return json.Unmarshal(value, v)
+	}
+	atomic.AddUint64(&nc.stats.Misses, 1)
+	f, version := nc.begin(key)
+	var value json.RawMessage
+	err := nc.client.GetInto(ctx, key, &value)
+	if err != nil {
+		nc.end(key, f, version, nil)
+		return err
+	}
+	nc.end(key, f, version, value)
+	return json.Unmarshal(value, v)
+}
+
+func (nc *NearCache) Keys(ctx context.Context) ([]string, error) {
+	return nc.client.Keys(ctx)
+}
+
+func (nc *NearCache) Exists(ctx context.Context, key string) (bool, error) {
+	return nc.client.Exists(ctx, key)
+}
+
+func (nc *NearCache) Get(ctx context.Context, key string) (interface{}, error) {
+	var value interface{}
+	err := nc.GetInto(ctx, key, &value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (nc *NearCache) Set(ctx context.Context, key string, body io.Reader, ttl time.Duration) error {
+	defer nc.invalidate(key)
+	return nc.client.Set(ctx, key, body, ttl)
+}
+
+func (nc *NearCache) Put(ctx context.Context, key string, body io.Reader, ttl time.Duration) error {
+	defer nc.invalidate(key)
+	return nc.client.Put(ctx, key, body, ttl)
+}
+
+func (nc *NearCache) Del(ctx context.Context, key string) error {
+	defer nc.invalidate(key)
+	return nc.client.Del(ctx, key)
+}
+
+func (nc *NearCache) Rename(ctx context.Context, src string, dst string, ttl time.Duration) error {
+	defer nc.invalidate(src, dst)
+	return nc.client.Rename(ctx, src, dst, ttl)
+}
+
+func (nc *NearCache) Copy(ctx context.Context, src string, dst string, ttl time.Duration) error {
+	defer nc.invalidate(dst)
+	return nc.client.Copy(ctx, src, dst, ttl)
+}
+
+func (nc *NearCache) Flush(ctx context.Context) error {
+	defer nc.reset()
+	return nc.client.Flush(ctx)
+}
+
+func (nc *NearCache) FlushAll(ctx context.Context) error {
+	defer nc.reset()
+	return nc.client.FlushAll(ctx)
+}
+
+func (nc *NearCache) reset() {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	nc.clear()
+}
+
+// CacheStats returns near cache counters.
+func (nc *NearCache) CacheStats() NearCacheStats {
+	nc.lock.Lock()
+	size := nc.lru.Len()
+	nc.lock.Unlock()
+	return NearCacheStats{
+		Size:          size,
+		Hits:          atomic.LoadUint64(&nc.stats.Hits),
+		Misses:        atomic.LoadUint64(&nc.stats.Misses),
+		Evictions:     atomic.LoadUint64(&nc.stats.Evictions),
+		Invalidations: atomic.LoadUint64(&nc.stats.Invalidations),
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures Client created with NewClient.
+type Option func(*Client)
+
+// WithHTTPClient sets HTTP client used to send requests, e.g. with
+// custom transport.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = hc
+	}
+}
+
+// WithTimeout limits duration of each request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.Timeout = timeout
+	}
+}
+
+// WithHeader adds header to every request.
+func WithHeader(key string, value string) Option {
+	return func(c *Client) {
+		if c.Header == nil {
+			c.Header = make(http.Header)
+		}
+		c.Header.Add(key, value)
+	}
+}
+
+// WithToken sets authentication token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.Token = token
+	}
+}
+
+// WithUserAgent sets User-Agent header of every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.UserAgent = ua
+	}
+}
+
+// WithNamespace scopes key operations to namespace.
+func WithNamespace(namespace string) Option {
+	return func(c *Client) {
+		c.Namespace = namespace
+	}
+}
+
+// WithRetryPolicy sets retry policy of idempotent requests.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.Retry = p
+	}
+}
+
+// WithRateLimitRetries sets number of retries of rate limited requests.
+func WithRateLimitRetries(n int) Option {
+	return func(c *Client) {
+		c.RateLimitRetries = n
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Message is a queue message reserved by consumer, Receipt is required
+// to acknowledge it and is valid until visibility timeout expires.
+type Message struct {
+	ID       string          `json:"id"`
+	Receipt  string          `json:"receipt"`
+	Body     json.RawMessage `json:"body"`
+	Attempts int             `json:"attempts"`
+}
+
+// QueueStats describes queue size and dead letter settings.
+type QueueStats struct {
+	Name        string `json:"name"`
+	Ready       int    `json:"ready"`
+	Reserved    int    `json:"reserved"`
+	DeadLetter  string `json:"dead_letter"`
+	MaxAttempts int    `json:"max_attempts"`
+}
+
+func (c *Client) queueURL(queue string) string {
+	if c.Namespace == "" {
+		return fmt.Sprintf("%s/queues/%s", c.Endpoint, url.PathEscape(queue))
+	}
+	return fmt.Sprintf("%s/ns/%s/queues/%s", c.Endpoint, url.PathEscape(c.Namespace), url.PathEscape(queue))
+}
+
+// Push appends json message to the queue and returns message id.
+func (c *Client) Push(ctx context.Context, queue string, body io.Reader) (string, error) {
+	var result struct {
+		ID string `json:"id"`
+	}
+	err := c.call(ctx, "push", http.MethodPost, c.queueURL(queue), body, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// Pop reserves first message of the queue for visibility timeout
+// waiting at most wait for it, nil message is returned if queue is
+// empty. Zero visibility means server default.
+func (c *Client) Pop(ctx context.Context, queue string, visibility time.Duration, wait time.Duration) (*Message, error) {
+	u := fmt.Sprintf("%s/pop?wait=%v", c.queueURL(queue), wait)
+	if visibility > 0 {
+		u = fmt.Sprintf("%s&visibility=%v", u, visibility)
+	}
+	resp, err := c.send(ctx, "pop", http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	var m Message
+	err = json.NewDecoder(resp.Body).Decode(&m)
+	if err != nil {
+		return nil, fmt.Errorf("pop: decode response: %v", err)
+	}
+	return &m, nil
+}
+
+// Receive waits for message until it is reserved or ctx is done.
+func (c *Client) Receive(ctx context.Context, queue string, visibility time.Duration) (*Message, error) {
+	for {
+		m, err := c.Pop(ctx, queue, visibility, c.pollWait(ctx))
+		switch {
+		case m != nil:
+			return m, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			return nil, err
+		}
+	}
+}
+
+// Ack removes processed message from the queue, fails with
+// ErrPreconditionFailed if visibility timeout has expired.
+func (c *Client) Ack(ctx context.Context, queue string, receipt string) error {
+	u := fmt.Sprintf("%s/ack?receipt=%s", c.queueURL(queue), url.QueryEscape(receipt))
+	return c.call(ctx, "ack", http.MethodPost, u, nil, nil)
+}
+
+// Nack returns message to the queue to be delivered again.
+func (c *Client) Nack(ctx context.Context, queue string, receipt string) error {
+	u := fmt.Sprintf("%s/nack?receipt=%s", c.queueURL(queue), url.QueryEscape(receipt))
+	return c.call(ctx, "nack", http.MethodPost, u, nil, nil)
+}
+
+// ConfigureQueue moves messages delivered maxAttempts times without
+// acknowledgement to deadLetter queue, empty deadLetter disables it.
+func (c *Client) ConfigureQueue(ctx context.Context, queue string, deadLetter string, maxAttempts int) error {
+	u := c.queueURL(queue)
+	if deadLetter != "" {
+		u = fmt.Sprintf("%s?dead_letter=%s&max_attempts=%d", u, url.QueryEscape(deadLetter), maxAttempts)
+	}
+	return c.call(ctx, "configure queue", http.MethodPut, u, nil, nil)
+}
+
+func (c *Client) QueueStats(ctx context.Context, queue string) (*QueueStats, error) {
+	var stats QueueStats
+	err := c.call(ctx, "queue stats", http.MethodGet, c.queueURL(queue), nil, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *Client) DropQueue(ctx context.Context, queue string) error {
+	return c.call(ctx, "drop queue", http.MethodDelete, c.queueURL(queue), nil, nil)
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// SetBytes stores raw value of the key with content type failing with
+// ErrConflict if key exists, empty or json content type stores json
+// value like Set.
+func (c *Client) SetBytes(ctx context.Context, key string, data []byte, contentType string, ttl time.Duration) error {
+	r, err := http.NewRequest(http.MethodPost, c.ttlURL(key, ttl), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("new request: %v", err)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return fmt.Errorf("set bytes: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("set bytes", resp)
+	}
+	return nil
+}
+
+// GetBytes returns value of the key as is with its content type, json
+// values are returned with application/json type.
+func (c *Client) GetBytes(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := c.send(ctx, "get bytes", http.MethodGet, c.keyURL(key), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("get bytes: %v", err)
+	}
+	return b, resp.Header.Get("Content-Type"), nil
+}
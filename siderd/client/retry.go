@@ -0,0 +1,53 @@
+package client
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy describes how idempotent requests are repeated after
+// network errors and 502, 503 and 504 responses. Delay before retry
+// grows exponentially from MinBackoff up to MaxBackoff, actual delay
+// is randomly chosen between half and full backoff.
+type RetryPolicy struct {
+	// Attempts is a total number of attempts, zero or one disables
+	// retries.
+	Attempts   int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is reasonable policy for services calling sider
+// over network.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 4, MinBackoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 0; i < attempt && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func unavailable(code int) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
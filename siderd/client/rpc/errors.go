@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// codeErrors are client errors matching Error by status code so that
+// errors.Is works the same way with both clients.
+var codeErrors = map[codes.Code]error{
+	codes.NotFound:           client.ErrNotFound,
+	codes.AlreadyExists:      client.ErrConflict,
+	codes.FailedPrecondition: client.ErrConflict,
+	codes.Unauthenticated:    client.ErrUnauthorized,
+	codes.PermissionDenied:   client.ErrForbidden,
+}
+
+// Error is returned when server responds with unsuccessful status, use
+// errors.As to get status code and server message.
+type Error struct {
+	Op      string
+	Code    codes.Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	return codeErrors[e.Code] == target
+}
+
+// callError converts status error of the call to Error.
+func callError(op string, err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return &Error{Op: op, Code: s.Code(), Message: s.Message()}
+}
@@ -0,0 +1,191 @@
+// Package rpc implements sider client over gRPC api with the same
+// methods as rest api client.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aandryashin/sider/siderd/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io"
+	"time"
+)
+
+type Client struct {
+	// Namespace scopes key operations, empty means default namespace.
+	Namespace string
+	Token     string
+
+	sider api.SiderClient
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{sider: api.NewSiderClient(conn)}
+}
+
+func (c *Client) context(ctx context.Context) context.Context {
+	if c.Token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.Token)
+}
+
+func (c *Client) Keys(ctx context.Context) ([]string, error) {
+	resp, err := c.sider.Keys(c.context(ctx), &api.KeysRequest{Namespace: c.Namespace})
+	if err != nil {
+		return nil, callError("keys", err)
+	}
+	keys := resp.Keys
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys, nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (interface{}, error) {
+	resp, err := c.sider.Get(c.context(ctx), &api.GetRequest{Namespace: c.Namespace, Key: key})
+	if err != nil {
+		return nil, callError("get", err)
+	}
+	return resp.Value.AsInterface(), nil
+}
+
+func (c *Client) Set(ctx context.Context, key string, body io.Reader, ttl time.Duration) error {
+	req, err := c.setRequest(key, body, ttl)
+	if err != nil {
+		return err
+	}
+	_, err = c.sider.Set(c.context(ctx), req)
+	if err != nil {
+		return callError("set", err)
+	}
+	return nil
+}
+
+func (c *Client) setRequest(key string, body io.Reader, ttl time.Duration) (*api.SetRequest, error) {
+	var data interface{}
+	err := json.NewDecoder(body).Decode(&data)
+	if err != nil {
+		return nil, fmt.Errorf("decode value: %v", err)
+	}
+	v, err := structpb.NewValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("convert value: %v", err)
+	}
+	req := &api.SetRequest{Namespace: c.Namespace, Key: key, Value: v}
+	if ttl != 0 {
+		req.Ttl = durationpb.New(ttl)
+	}
+	return req, nil
+}
+
+func (c *Client) Del(ctx context.Context, key string) error {
+	_, err := c.sider.Del(c.context(ctx), &api.DelRequest{Namespace: c.Namespace, Key: key})
+	if err != nil {
+		return callError("del", err)
+	}
+	return nil
+}
+
+// Batch collects operations to be sent in one call.
+type Batch struct {
+	c   *Client
+	ops []*api.Operation
+	err error
+}
+
+// Result of batch operation, Value is set for get operations.
+type Result struct {
+	Value interface{}
+	Err   error
+}
+
+func (c *Client) Batch() *Batch {
+	return &Batch{c: c}
+}
+
+func (b *Batch) Get(key string) *Batch {
+	b.ops = append(b.ops, &api.Operation{Op: &api.Operation_Get{Get: &api.GetRequest{Namespace: b.c.Namespace, Key: key}}})
+	return b
+}
+
+func (b *Batch) Set(key string, body io.Reader, ttl time.Duration) *Batch {
+	req, err := b.c.setRequest(key, body, ttl)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	b.ops = append(b.ops, &api.Operation{Op: &api.Operation_Set{Set: req}})
+	return b
+}
+
+func (b *Batch) Del(key string) *Batch {
+	b.ops = append(b.ops, &api.Operation{Op: &api.Operation_Del{Del: &api.DelRequest{Namespace: b.c.Namespace, Key: key}}})
+	return b
+}
+
+// Exec sends batch and returns results in order of operations.
+func (b *Batch) Exec(ctx context.Context) ([]Result, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	resp, err := b.c.sider.Batch(b.c.context(ctx), &api.BatchRequest{Operations: b.ops})
+	if err != nil {
+		return nil, callError("batch", err)
+	}
+	results := make([]Result, len(resp.Results))
+	for i, r := range resp.Results {
+		switch v := r.Result.(type) {
+		case *api.Result_Get:
+			results[i].Value = v.Get.Value.AsInterface()
+		case *api.Result_Error:
+			results[i].Err = fmt.Errorf("%s", v.Error)
+		}
+	}
+	return results, nil
+}
+
+// Event describes key change, Type is one of "set", "del" or "expire".
+type Event struct {
+	Type      string
+	Namespace string
+	Key       string
+}
+
+var eventTypes = map[api.Event_Type]string{
+	api.Event_SET:    "set",
+	api.Event_DEL:    "del",
+	api.Event_EXPIRE: "expire",
+}
+
+// Watch subscribes to changes of keys matching glob pattern, returned
+// channel is closed when ctx is cancelled or subscription fails.
+func (c *Client) Watch(ctx context.Context, pattern string) (<-chan Event, error) {
+	stream, err := c.sider.Watch(c.context(ctx), &api.WatchRequest{Namespace: c.Namespace, Pattern: pattern})
+	if err != nil {
+		return nil, callError("watch", err)
+	}
+	_, err = stream.Header()
+	if err != nil {
+		return nil, callError("watch", err)
+	}
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for {
+			e, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- Event{Type: eventTypes[e.Type], Namespace: e.Namespace, Key: e.Key}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Schema is JSON Schema validating values of the keys matching glob
+// Pattern in Namespace, empty Namespace means all namespaces.
+type Schema struct {
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace,omitempty"`
+	Pattern   string          `json:"pattern"`
+	Schema    json.RawMessage `json:"schema"`
+}
+
+func (c *Client) schemaURL(name string) string {
+	return fmt.Sprintf("%s/admin/schemas/%s", c.Endpoint, url.PathEscape(name))
+}
+
+// PutSchema registers schema or replaces schema with the same name,
+// values stored before are not validated.
+func (c *Client) PutSchema(ctx context.Context, s *Schema) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("put schema: encode request: %v", err)
+	}
+	return c.call(ctx, "put schema", http.MethodPut, c.schemaURL(s.Name), bytes.NewReader(b), nil)
+}
+
+func (c *Client) Schema(ctx context.Context, name string) (*Schema, error) {
+	var s Schema
+	err := c.call(ctx, "schema", http.MethodGet, c.schemaURL(name), nil, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (c *Client) Schemas(ctx context.Context) ([]Schema, error) {
+	var schemas []Schema
+	err := c.call(ctx, "schemas", http.MethodGet, fmt.Sprintf("%s/admin/schemas", c.Endpoint), nil, &schemas)
+	if err != nil {
+		return nil, err
+	}
+	return schemas, nil
+}
+
+func (c *Client) DeleteSchema(ctx context.Context, name string) error {
+	return c.call(ctx, "delete schema", http.MethodDelete, c.schemaURL(name), nil, nil)
+}
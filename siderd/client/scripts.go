@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type evalRequest struct {
+	Script string        `json:"script,omitempty"`
+	SHA    string        `json:"sha,omitempty"`
+	Keys   []string      `json:"keys"`
+	Args   []interface{} `json:"args"`
+}
+
+func (c *Client) scriptsURL(action string) string {
+	if c.Namespace == "" {
+		return fmt.Sprintf("%s/%s", c.Endpoint, action)
+	}
+	return fmt.Sprintf("%s/ns/%s/%s", c.Endpoint, url.PathEscape(c.Namespace), action)
+}
+
+// Eval executes lua script atomically and decodes its result into v if
+// v is not nil. Script can access only given keys, args are encoded as
+// json. Script is referenced by sha and sent to server only if server
+// does not have it cached.
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args []interface{}, v interface{}) error {
+	sum := sha1.Sum([]byte(script))
+	req := evalRequest{SHA: hex.EncodeToString(sum[:]), Keys: keys, Args: args}
+	err := c.eval(ctx, req, v)
+	if errors.Is(err, ErrNotFound) {
+		req.Script, req.SHA = script, ""
+		err = c.eval(ctx, req, v)
+	}
+	return err
+}
+
+// EvalSHA executes script previously loaded with LoadScript.
+func (c *Client) EvalSHA(ctx context.Context, sha string, keys []string, args []interface{}, v interface{}) error {
+	return c.eval(ctx, evalRequest{SHA: sha, Keys: keys, Args: args}, v)
+}
+
+func (c *Client) eval(ctx context.Context, req evalRequest, v interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("eval: encode request: %v", err)
+	}
+	return c.call(ctx, "eval", http.MethodPost, c.scriptsURL("eval"), bytes.NewReader(b), v)
+}
+
+// LoadScript compiles and caches script on the server returning its sha.
+func (c *Client) LoadScript(ctx context.Context, script string) (string, error) {
+	var result struct {
+		SHA string `json:"sha"`
+	}
+	err := c.call(ctx, "load script", http.MethodPost, c.scriptsURL("scripts"), strings.NewReader(script), &result)
+	if err != nil {
+		return "", err
+	}
+	return result.SHA, nil
+}
+
+// FlushScripts removes cached scripts of all namespaces.
+func (c *Client) FlushScripts(ctx context.Context) error {
+	return c.call(ctx, "flush scripts", http.MethodDelete, fmt.Sprintf("%s/admin/scripts", c.Endpoint), nil, nil)
+}
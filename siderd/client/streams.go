@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// StreamEntry is an entry of append-only stream, ids are assigned by the
+// server as <milliseconds>-<sequence> and grow monotonically.
+type StreamEntry struct {
+	ID    string          `json:"id"`
+	Value json.RawMessage `json:"value"`
+}
+
+// StreamInfo describes stream length and consumer groups.
+type StreamInfo struct {
+	Key     string `json:"key"`
+	Length  int    `json:"length"`
+	FirstID string `json:"first_id"`
+	LastID  string `json:"last_id"`
+	Groups  []struct {
+		Name          string `json:"name"`
+		LastDelivered string `json:"last_delivered"`
+		Pending       int    `json:"pending"`
+	} `json:"groups"`
+}
+
+// PendingEntry is an entry delivered to consumer of the group and not
+// acknowledged yet.
+type PendingEntry struct {
+	ID         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	Idle       string `json:"idle"`
+	Deliveries int    `json:"deliveries"`
+}
+
+// Stream is an append-only log stored under the key.
+type Stream struct {
+	client *Client
+	key    string
+}
+
+// Stream returns stream stored under the key in client namespace.
+func (c *Client) Stream(key string) *Stream {
+	return &Stream{client: c, key: key}
+}
+
+func (s *Stream) url(action string, params url.Values) string {
+	u := fmt.Sprintf("%s/streams/%s", s.client.Endpoint, url.PathEscape(s.key))
+	if s.client.Namespace != "" {
+		u = fmt.Sprintf("%s/ns/%s/streams/%s", s.client.Endpoint, url.PathEscape(s.client.Namespace), url.PathEscape(s.key))
+	}
+	if action != "" {
+		u += "/" + action
+	}
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+// Append adds json entry to the stream and returns its id, positive
+// maxLen trims oldest entries keeping at most maxLen ones.
+func (s *Stream) Append(ctx context.Context, body io.Reader, maxLen int) (string, error) {
+	params := url.Values{}
+	if maxLen > 0 {
+		params.Set("maxlen", strconv.Itoa(maxLen))
+	}
+	var result struct {
+		ID string `json:"id"`
+	}
+	err := s.client.call(ctx, "append", http.MethodPost, s.url("", params), body, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// Range returns at most count entries with ids from start to end
+// inclusive, empty start and end mean beginning and end of the stream.
+func (s *Stream) Range(ctx context.Context, start string, end string, count int) ([]StreamEntry, error) {
+	params := url.Values{}
+	if start != "" {
+		params.Set("start", start)
+	}
+	if end != "" {
+		params.Set("end", end)
+	}
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+	var entries []StreamEntry
+	err := s.client.call(ctx, "range", http.MethodGet, s.url("", params), nil, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Read returns at most count entries appended after given id waiting at
+// most wait for them, empty list is returned if there are none.
+func (s *Stream) Read(ctx context.Context, after string, count int, wait time.Duration) ([]StreamEntry, error) {
+	params := url.Values{"after": {after}, "wait": {wait.String()}}
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+	var entries []StreamEntry
+	err := s.client.call(ctx, "read", http.MethodGet, s.url("", params), nil, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Trim removes oldest entries keeping at most maxLen ones and ones not
+// older than maxAge, zero values disable limit. It returns number of
+// removed entries.
+func (s *Stream) Trim(ctx context.Context, maxLen int, maxAge time.Duration) (int, error) {
+	params := url.Values{}
+	if maxLen > 0 {
+		params.Set("maxlen", strconv.Itoa(maxLen))
+	}
+	if maxAge > 0 {
+		params.Set("maxage", maxAge.String())
+	}
+	var result struct {
+		Trimmed int `json:"trimmed"`
+	}
+	err := s.client.call(ctx, "trim", http.MethodPost, s.url("trim", params), nil, &result)
+	if err != nil {
+		return 0, err
+	}
+	return result.Trimmed, nil
+}
+
+func (s *Stream) Info(ctx context.Context) (*StreamInfo, error) {
+	var info StreamInfo
+	err := s.client.call(ctx, "stream info", http.MethodGet, s.url("info", nil), nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (s *Stream) Drop(ctx context.Context) error {
+	return s.client.call(ctx, "drop stream", http.MethodDelete, s.url("", nil), nil, nil)
+}
+
+// CreateGroup creates consumer group delivering entries appended after
+// start id, "0" delivers all entries and empty start delivers only new
+// ones. Stream is created if it does not exist.
+func (s *Stream) CreateGroup(ctx context.Context, group string, start string) error {
+	params := url.Values{"group": {group}}
+	if start != "" {
+		params.Set("start", start)
+	}
+	return s.client.call(ctx, "create group", http.MethodPost, s.url("group", params), nil, nil)
+}
+
+func (s *Stream) DropGroup(ctx context.Context, group string) error {
+	return s.client.call(ctx, "drop group", http.MethodDelete, s.url("group", url.Values{"group": {group}}), nil, nil)
+}
+
+// ReadGroup delivers at most count entries not delivered to the group
+// yet to consumer waiting at most wait for them. Delivered entries are
+// pending until acknowledged.
+func (s *Stream) ReadGroup(ctx context.Context, group string, consumer string, count int, wait time.Duration) ([]StreamEntry, error) {
+	params := url.Values{"group": {group}, "consumer": {consumer}, "wait": {wait.String()}}
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+	var entries []StreamEntry
+	err := s.client.call(ctx, "read group", http.MethodPost, s.url("read", params), nil, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Ack acknowledges pending entries of the group and returns number of
+// acknowledged ones.
+func (s *Stream) Ack(ctx context.Context, group string, ids ...string) (int, error) {
+	params := url.Values{"group": {group}, "id": ids}
+	var result struct {
+		Acked int `json:"acked"`
+	}
+	err := s.client.call(ctx, "ack", http.MethodPost, s.url("ack", params), nil, &result)
+	if err != nil {
+		return 0, err
+	}
+	return result.Acked, nil
+}
+
+// Claim transfers at most count entries pending longer than minIdle to
+// consumer, it is used to process entries of failed consumers.
+func (s *Stream) Claim(ctx context.Context, group string, consumer string, minIdle time.Duration, count int) ([]StreamEntry, error) {
+	params := url.Values{"group": {group}, "consumer": {consumer}, "min_idle": {minIdle.String()}}
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+	var entries []StreamEntry
+	err := s.client.call(ctx, "claim", http.MethodPost, s.url("claim", params), nil, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *Stream) Pending(ctx context.Context, group string) ([]PendingEntry, error) {
+	var pending []PendingEntry
+	err := s.client.call(ctx, "pending", http.MethodGet, s.url("pending", url.Values{"group": {group}}), nil, &pending)
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Codec converts values to json documents stored in sider and back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(buf.Bytes())
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	var b []byte
+	err := json.Unmarshal(data, &b)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+var (
+	// JSONCodec stores values as json documents readable by any client.
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec stores gob encoded values as base64 json strings, it
+	// keeps Go types not representable in json but is readable by Go
+	// clients only.
+	GobCodec Codec = gobCodec{}
+)
+
+// GetAs decodes value of the key into a value of type T.
+func GetAs[T any](ctx context.Context, c BucketClient, key string) (T, error) {
+	var v T
+	err := c.GetInto(ctx, key, &v)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// SetValue stores json representation of v failing with ErrConflict if
+// key exists.
+func SetValue[T any](ctx context.Context, c BucketClient, key string, v T, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("set: encode value: %v", err)
+	}
+	return c.Set(ctx, key, bytes.NewReader(b), ttl)
+}
+
+// PutValue stores json representation of v replacing existing value.
+func PutValue[T any](ctx context.Context, c BucketClient, key string, v T, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("put: encode value: %v", err)
+	}
+	return c.Put(ctx, key, bytes.NewReader(b), ttl)
+}
+
+type bucketOptions struct {
+	ttl   time.Duration
+	codec Codec
+}
+
+// BucketOption configures Bucket created with NewBucket.
+type BucketOption func(*bucketOptions)
+
+// WithDefaultTTL sets time to live of values stored with Bucket.Set and
+// Bucket.Add.
+func WithDefaultTTL(ttl time.Duration) BucketOption {
+	return func(o *bucketOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithCodec sets codec of bucket values, JSONCodec is used by default.
+func WithCodec(codec Codec) BucketOption {
+	return func(o *bucketOptions) {
+		o.codec = codec
+	}
+}
+
+// BucketClient contains operations used by Bucket and typed helpers.
+type BucketClient interface {
+	Keys(ctx context.Context) ([]string, error)
+	GetInto(ctx context.Context, key string, v interface{}) error
+	Set(ctx context.Context, key string, body io.Reader, ttl time.Duration) error
+	Put(ctx context.Context, key string, body io.Reader, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// Bucket stores values of type T under keys sharing common prefix.
+type Bucket[T any] struct {
+	client BucketClient
+	prefix string
+	bucketOptions
+}
+
+func NewBucket[T any](c BucketClient, prefix string, opts ...BucketOption) *Bucket[T] {
+	b := &Bucket[T]{client: c, prefix: prefix, bucketOptions: bucketOptions{codec: JSONCodec}}
+	for _, opt := range opts {
+		opt(&b.bucketOptions)
+	}
+	return b
+}
+
+func (b *Bucket[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero, v T
+	var raw json.RawMessage
+	err := b.client.GetInto(ctx, b.prefix+key, &raw)
+	if err != nil {
+		return zero, err
+	}
+	err = b.codec.Unmarshal(raw, &v)
+	if err != nil {
+		return zero, fmt.Errorf("get: decode value: %v", err)
+	}
+	return v, nil
+}
+
+// Set stores value replacing existing one with default time to live.
+func (b *Bucket[T]) Set(ctx context.Context, key string, v T) error {
+	return b.SetTTL(ctx, key, v, b.ttl)
+}
+
+// SetTTL stores value replacing existing one, zero ttl means value does
+// not expire.
+func (b *Bucket[T]) SetTTL(ctx context.Context, key string, v T, ttl time.Duration) error {
+	data, err := b.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("put: encode value: %v", err)
+	}
+	return b.client.Put(ctx, b.prefix+key, bytes.NewReader(data), ttl)
+}
+
+// Add stores value with default time to live failing with ErrConflict
+// if key exists.
+func (b *Bucket[T]) Add(ctx context.Context, key string, v T) error {
+	data, err := b.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("set: encode value: %v", err)
+	}
+	return b.client.Set(ctx, b.prefix+key, bytes.NewReader(data), b.ttl)
+}
+
+func (b *Bucket[T]) Del(ctx context.Context, key string) error {
+	return b.client.Del(ctx, b.prefix+key)
+}
+
+func (b *Bucket[T]) Exists(ctx context.Context, key string) (bool, error) {
+	return b.client.Exists(ctx, b.prefix+key)
+}
+
+// Keys returns keys of the bucket without prefix.
+func (b *Bucket[T]) Keys(ctx context.Context) ([]string, error) {
+	keys, err := b.client.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, k := range keys {
+		if strings.HasPrefix(k, b.prefix) {
+			list = append(list, strings.TrimPrefix(k, b.prefix))
+		}
+	}
+	return list, nil
+}
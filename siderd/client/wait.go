@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Wait decodes value of the key into v once its version differs from
+// given one waiting for it until ctx is done, empty version waits until
+// key exists. It returns version of decoded value, ErrNotFound means key
+// was deleted.
+func (c *Client) Wait(ctx context.Context, key string, version string, v interface{}) (string, error) {
+	for {
+		u := fmt.Sprintf("%s?wait=%v", c.keyURL(key), c.pollWait(ctx))
+		r, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return "", fmt.Errorf("new request: %v", err)
+		}
+		if version != "" {
+			r.Header.Set("If-None-Match", strconv.Quote(version))
+		}
+		resp, err := c.do(ctx, r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("wait: %v", err)
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			defer resp.Body.Close()
+			err = json.NewDecoder(resp.Body).Decode(v)
+			if err != nil {
+				return "", fmt.Errorf("wait: decode response: %v", err)
+			}
+			etag, _ := strconv.Unquote(resp.Header.Get("ETag"))
+			return etag, nil
+		case resp.StatusCode == http.StatusNotModified,
+			resp.StatusCode == http.StatusNotFound && version == "":
+			resp.Body.Close()
+		default:
+			defer resp.Body.Close()
+			return "", responseError("wait", resp)
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+}
+
+// ListPush appends json value to the list stored under the key creating
+// the list if key does not exist, it returns new length of the list.
+func (c *Client) ListPush(ctx context.Context, key string, body io.Reader) (int, error) {
+	var result struct {
+		Length int `json:"length"`
+	}
+	err := c.call(ctx, "list push", http.MethodPost, c.keyURL(key)+"/push", body, &result)
+	if err != nil {
+		return 0, err
+	}
+	return result.Length, nil
+}
+
+// ListPop removes first element of the list stored under the key and
+// decodes it into v waiting at most wait for it, false is returned if
+// list is empty or missing.
+func (c *Client) ListPop(ctx context.Context, key string, wait time.Duration, v interface{}) (bool, error) {
+	u := fmt.Sprintf("%s/pop?wait=%v", c.keyURL(key), wait)
+	resp, err := c.send(ctx, "list pop", http.MethodPost, u, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return false, nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return false, fmt.Errorf("list pop: decode response: %v", err)
+	}
+	return true, nil
+}
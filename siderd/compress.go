@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	compressThreshold int64
+	compressLevel     int
+)
+
+// compressed is gzip representation of json or raw value.
+type compressed struct {
+	data []byte
+	// size is length of uncompressed value.
+	size        int64
+	raw         bool
+	contentType string
+}
+
+// value returns value of the node decompressing it if needed.
+func (n *node) value() interface{} {
+	c, ok := n.data.(*compressed)
+	if !ok {
+		return n.data
+	}
+	b, err := gunzip(c.data)
+	if err != nil {
+		return nil
+	}
+	if c.raw {
+		return &raw{contentType: c.contentType, data: b}
+	}
+	var v interface{}
+	json.Unmarshal(b, &v)
+	return v
+}
+
+// compress replaces value of the node larger than compression threshold
+// with its gzip representation if it is smaller.
+func compress(key string, n *node) {
+	if compressThreshold <= 0 || n.size-int64(len(key)) <= compressThreshold {
+		return
+	}
+	c := &compressed{contentType: jsonContentType}
+	var b []byte
+	switch d := n.data.(type) {
+	case *compressed:
+		return
+	case *raw:
+		c.raw, c.contentType, b = true, d.contentType, d.data
+	default:
+		var err error
+		b, err = json.Marshal(d)
+		if err != nil {
+			return
+		}
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, compressLevel)
+	if err != nil {
+		return
+	}
+	w.Write(b)
+	w.Close()
+	if buf.Len() >= len(b) {
+		return
+	}
+	c.data, c.size = buf.Bytes(), int64(len(b))
+	n.data = c
+	n.size = int64(len(key) + len(c.data))
+	if c.raw {
+		n.size += int64(len(c.contentType))
+	}
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, e := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.Split(e, ";")[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeValue replies with value of the node, compressed values are sent
+// as is to clients accepting gzip.
+func writeValue(w http.ResponseWriter, r *http.Request, n *node) {
+	w.Header().Set("Vary", "Accept-Encoding")
+	if c, ok := n.data.(*compressed); ok && acceptsGzip(r) {
+		w.Header().Set("Content-Type", c.contentType)
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(c.data)
+		return
+	}
+	switch d := n.value().(type) {
+	case *raw:
+		w.Header().Set("Content-Type", d.contentType)
+		w.Write(d.data)
+	default:
+		w.Header().Set("Content-Type", jsonContentType)
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// contentEncodingHandler decompresses gzip encoded request bodies, value
+// limits apply to decompressed values.
+func contentEncodingHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Content-Encoding") {
+		case "", "identity":
+		case "gzip":
+			body, err := gzip.NewReader(r.Body)
+			if err != nil {
+				httpError(w, fmt.Sprintf("Decompress request: %v", err), http.StatusBadRequest)
+				return
+			}
+			defer body.Close()
+			r.Body = body
+			r.Header.Del("Content-Encoding")
+		default:
+			httpError(w, fmt.Sprintf("Unsupported content encoding [%s].", r.Header.Get("Content-Encoding")), http.StatusUnsupportedMediaType)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	ctx := context.Background()
+	name := uuid.New()
+	admin := client.NewClient(server.URL)
+	if err := admin.CreateNamespace(ctx, name, 0); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer admin.DropNamespace(ctx, name)
+	cl := client.NewClient(server.URL, client.WithNamespace(name))
+
+	defer func(n int64) { compressThreshold = n }(compressThreshold)
+	compressThreshold = 100
+
+	value := `{"status": "ok", "items": ["` + strings.Repeat("item", 100) + `"]}`
+	if err := cl.Set(ctx, "json", strings.NewReader(value), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	data := bytes.Repeat([]byte{0, 1, 2, 3}, 100)
+	if err := cl.SetBytes(ctx, "raw", data, "application/octet-stream", 0); err != nil {
+		t.Fatalf("set bytes: %v", err)
+	}
+	cl.Set(ctx, "small", strings.NewReader(`"small"`), 0)
+	stats, err := admin.Stats(ctx, name)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Compressed != 2 || stats.CompressionRatio <= 1 || stats.Memory > 300 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	v, err := cl.Get(ctx, "json")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !reflect.DeepEqual(v, map[string]interface{}{"status": "ok", "items": []interface{}{strings.Repeat("item", 100)}}) {
+		t.Fatalf("unexpected value: %v", v)
+	}
+	b, ct, err := cl.GetBytes(ctx, "raw")
+	if err != nil || !bytes.Equal(b, data) || ct != "application/octet-stream" {
+		t.Fatalf("unexpected value: %v %s %v", b, ct, err)
+	}
+	if err := cl.CreateIndex(ctx, "status", "/status"); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	result, err := cl.Query(ctx, "status", client.Query{Eq: "ok"})
+	if err != nil || len(result.Items) != 1 || result.Items[0].Key != "json" {
+		t.Fatalf("unexpected query result: %+v %v", result, err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/ns/"+name+"/keys/raw", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("value is not compressed: %v", resp.Header)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if b, _ := ioutil.ReadAll(zr); !bytes.Equal(b, data) {
+		t.Fatalf("unexpected value: %v", b)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"a": 1}`))
+	zw.Close()
+	req, _ = http.NewRequest(http.MethodPost, server.URL+"/ns/"+name+"/keys/gzip", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("set gzip encoded value: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if v, err := cl.Get(ctx, "gzip"); err != nil || !reflect.DeepEqual(v, map[string]interface{}{"a": 1.0}) {
+		t.Fatalf("unexpected value: %v %v", v, err)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	typeJSON   = "json"
+	typeRaw    = "raw"
+	typeQueue  = "queue"
+	typeStream = "stream"
+	typeIndex  = "index"
+	// typeNamespace record holds namespace definition and precedes
+	// records of the namespace.
+	typeNamespace = "namespace"
+	// typeSchema records follow all namespaces so that restored keys
+	// are not validated, like existing keys are not validated when
+	// schema is registered.
+	typeSchema = "schema"
+	// typeFence record holds fence counter of locks.
+	typeFence = "fence"
+)
+
+const (
+	restoreSkip      = "skip"
+	restoreOverwrite = "overwrite"
+	restoreFail      = "fail"
+)
+
+type record struct {
+	Namespace string          `json:"namespace"`
+	Key       string          `json:"key"`
+	Type      string          `json:"type"`
+	TTL       string          `json:"ttl,omitempty"`
+	Value     json.RawMessage `json:"value"`
+}
+
+type namespaceRecord struct {
+	MaxMemory int64 `json:"max_memory,omitempty"`
+}
+
+type restoreResult struct {
+	Restored int `json:"restored"`
+	Skipped  int `json:"skipped"`
+}
+
+func (ns *namespace) dump(ctx context.Context, enc *json.Encoder) error {
+	def, _ := json.Marshal(namespaceRecord{MaxMemory: atomic.LoadInt64(&ns.maxMemory)})
+	err := enc.Encode(record{Namespace: ns.name, Type: typeNamespace, Value: def})
+	if err != nil {
+		return err
+	}
+	keys, err := ns.keys(ctx, func(string) bool { return true })
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		n, ok := ns.peek(key)
+		if !ok {
+			continue
+		}
+		rec := record{Namespace: ns.name, Key: key, Type: typeJSON}
+		if ttl := n.remaining(); ttl != 0 {
+			rec.TTL = ttl.String()
+		}
+		data := n.value()
+		if d, ok := data.(*raw); ok {
+			rec.Type = typeRaw
+			rec.Value, err = json.Marshal(rawRecord{ContentType: d.contentType, Data: d.data})
+		} else {
+			rec.Value, err = json.Marshal(data)
+		}
+		if err != nil {
+			return fmt.Errorf("marshal [%s]: %v", key, err)
+		}
+		err = enc.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+	names, queues := ns.queueRecords()
+	for _, name := range names {
+		rec := record{Namespace: ns.name, Key: name, Type: typeQueue}
+		rec.Value, err = json.Marshal(queues[name])
+		if err != nil {
+			return fmt.Errorf("marshal queue [%s]: %v", name, err)
+		}
+		err = enc.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+	keys, streams := ns.streamRecords()
+	for _, key := range keys {
+		rec := record{Namespace: ns.name, Key: key, Type: typeStream}
+		rec.Value, err = json.Marshal(streams[key])
+		if err != nil {
+			return fmt.Errorf("marshal stream [%s]: %v", key, err)
+		}
+		err = enc.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+	names, indexes := ns.indexRecords()
+	for _, name := range names {
+		rec := record{Namespace: ns.name, Key: name, Type: typeIndex}
+		rec.Value, err = json.Marshal(indexes[name])
+		if err != nil {
+			return fmt.Errorf("marshal index [%s]: %v", name, err)
+		}
+		err = enc.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	var out io.Writer = w
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		defer zw.Close()
+		out = zw
+	}
+	enc := json.NewEncoder(out)
+	fence, _ := json.Marshal(atomic.LoadUint64(&fenceCounter))
+	if err := enc.Encode(record{Key: typeFence, Type: typeFence, Value: fence}); err != nil {
+		log.Printf("Dump: %v\n", err)
+		return
+	}
+	for _, name := range namespaceNames() {
+		ns, ok := lookupNamespace(name)
+		if !ok {
+			continue
+		}
+		if err := ns.dump(r.Context(), enc); err != nil {
+			log.Printf("Dump: [%s]: %v\n", name, err)
+			return
+		}
+	}
+	schemaRegistryLock.RLock()
+	schemas := sortedSchemas
+	schemaRegistryLock.RUnlock()
+	for _, ks := range schemas {
+		rec := record{Key: ks.Name, Type: typeSchema}
+		rec.Value, _ = json.Marshal(ks)
+		if err := enc.Encode(rec); err != nil {
+			log.Printf("Dump: schema [%s]: %v\n", ks.Name, err)
+			return
+		}
+	}
+}
+
+func restore(w http.ResponseWriter, r *http.Request) {
+	mode := r.FormValue("mode")
+	var setmode setMode
+	switch mode {
+	case "", restoreSkip, restoreFail:
+		setmode = setNew
+	case restoreOverwrite:
+		setmode = setAlways
+	default:
+		httpError(w, fmt.Sprintf("Unknown restore mode [%s].", mode), http.StatusBadRequest)
+		return
+	}
+	var result restoreResult
+	dec := json.NewDecoder(r.Body)
+	for line := 1; ; line++ {
+		var rec record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			httpError(w, fmt.Sprintf("Parse record %d: %v", line, err), http.StatusBadRequest)
+			return
+		}
+		if rec.Type == typeNamespace {
+			if err := restoreNamespace(&rec, setmode); err != nil {
+				httpError(w, fmt.Sprintf("Record %d: %v", line, err), http.StatusBadRequest)
+				return
+			}
+			continue
+		}
+		if rec.Type == typeFence {
+			if err := restoreFence(rec.Value); err != nil {
+				httpError(w, fmt.Sprintf("Record %d: %v", line, err), http.StatusBadRequest)
+				return
+			}
+			continue
+		}
+		var code int
+		if rec.Type == typeSchema {
+			code, err = restoreSchema(&rec, setmode)
+		} else {
+			code, err = restoreRecord(&rec, setmode)
+		}
+		switch {
+		case err == errExists && mode != restoreFail:
+			result.Skipped++
+		case err == errExists:
+			httpError(w, fmt.Sprintf("Record %d: key [%s] already exists in namespace [%s].", line, rec.Key, rec.Namespace), http.StatusConflict)
+			return
+		case err != nil:
+			httpError(w, fmt.Sprintf("Record %d: %v", line, err), code)
+			return
+		default:
+			result.Restored++
+		}
+	}
+	log.Printf("Restored: [%d], skipped: [%d].\n", result.Restored, result.Skipped)
+	json.NewEncoder(w).Encode(result)
+}
+
+// restoreNamespace creates missing namespace from its record, memory
+// limit of existing namespace is changed only with setAlways mode.
+func restoreNamespace(rec *record, mode setMode) error {
+	if !namespaceName.MatchString(rec.Namespace) {
+		return fmt.Errorf("bad namespace name [%s]", rec.Namespace)
+	}
+	var def namespaceRecord
+	if err := json.Unmarshal(rec.Value, &def); err != nil {
+		return fmt.Errorf("parse value: %v", err)
+	}
+	if def.MaxMemory < 0 {
+		return fmt.Errorf("negative memory limit")
+	}
+	_, err := createNamespace(rec.Namespace, def.MaxMemory)
+	if err != errExists {
+		return err
+	}
+	if ns, ok := lookupNamespace(rec.Namespace); ok && mode == setAlways {
+		atomic.StoreInt64(&ns.maxMemory, def.MaxMemory)
+	}
+	return nil
+}
+
+func restoreRecord(rec *record, mode setMode) (int, error) {
+	if rec.Key == "" {
+		return http.StatusBadRequest, fmt.Errorf("empty key")
+	}
+	switch rec.Type {
+	case typeJSON, typeRaw, typeQueue, typeStream, typeIndex:
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unsupported type [%s]", rec.Type)
+	}
+	if rec.Namespace == "" {
+		rec.Namespace = defaultNamespace
+	}
+	if !namespaceName.MatchString(rec.Namespace) {
+		return http.StatusBadRequest, fmt.Errorf("bad namespace name [%s]", rec.Namespace)
+	}
+	var ttl time.Duration
+	if rec.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(rec.TTL)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("parse ttl: %v", err)
+		}
+		if ttl <= 0 {
+			return http.StatusBadRequest, fmt.Errorf("zero or negative ttl")
+		}
+	}
+	var data interface{}
+	var blob rawRecord
+	var queue queueRecord
+	var stream streamRecord
+	var idx indexRecord
+	var err error
+	switch rec.Type {
+	case typeQueue:
+		err = json.Unmarshal(rec.Value, &queue)
+	case typeStream:
+		err = json.Unmarshal(rec.Value, &stream)
+	case typeIndex:
+		err = json.Unmarshal(rec.Value, &idx)
+	case typeRaw:
+		err = json.Unmarshal(rec.Value, &blob)
+	default:
+		err = json.Unmarshal(rec.Value, &data)
+	}
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("parse value: %v", err)
+	}
+	ns, ok := lookupNamespace(rec.Namespace)
+	if !ok {
+		ns, err = createNamespace(rec.Namespace, 0)
+		if err == errExists {
+			ns, _ = lookupNamespace(rec.Namespace)
+		}
+	}
+	switch rec.Type {
+	case typeQueue:
+		err = ns.restoreQueue(rec.Key, queue, mode)
+		if err == errMemoryLimit {
+			return http.StatusInsufficientStorage, fmt.Errorf("namespace [%s] memory limit exceeded", ns.name)
+		}
+		return http.StatusConflict, err
+	case typeStream:
+		err = ns.restoreStream(rec.Key, stream, mode)
+		if err == errMemoryLimit {
+			return http.StatusInsufficientStorage, fmt.Errorf("namespace [%s] memory limit exceeded", ns.name)
+		}
+		return http.StatusConflict, err
+	case typeIndex:
+		err = ns.restoreIndex(rec.Key, idx, mode)
+		if err == errBadPointer {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusConflict, err
+	}
+	size := int64(len(rec.Value))
+	if rec.Type == typeRaw {
+		data = &raw{contentType: blob.ContentType, data: blob.Data}
+		size = int64(len(blob.Data) + len(blob.ContentType))
+	}
+	err = ns.set(rec.Key, data, size, ttl, mode)
+	if _, ok := err.(*validationError); ok {
+		return http.StatusUnprocessableEntity, err
+	}
+	switch err {
+	case errKeyTooLong, errValueTooLarge:
+		return http.StatusRequestEntityTooLarge, err
+	case errMemoryLimit:
+		return http.StatusInsufficientStorage, fmt.Errorf("namespace [%s] memory limit exceeded", ns.name)
+	default:
+		return http.StatusConflict, err
+	}
+}
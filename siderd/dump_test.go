@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpRestore(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	name := uuid.New()
+	err := cl.CreateNamespace(context.Background(), name, 1000)
+	if err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer cl.DropNamespace(context.Background(), name)
+
+	key, expiring := uuid.New(), uuid.New()
+	err = cl.Set(context.Background(), key, bytes.NewReader([]byte(`["one"]`)), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	defer cleanup(key)
+	err = cl.Scoped(name).Set(context.Background(), expiring, bytes.NewReader([]byte(`{}`)), time.Minute)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = cl.Dump(context.Background(), &buf)
+	if err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	dumped := buf.String()
+
+	records := make(map[string]record)
+	scanner := bufio.NewScanner(strings.NewReader(dumped))
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("parse record: %v", err)
+		}
+		if rec.Type == typeNamespace && rec.Namespace == name && string(rec.Value) != `{"max_memory":1000}` {
+			t.Fatalf("unexpected namespace record: %s", rec.Value)
+		}
+		if rec.Type == typeFence || rec.Type == typeNamespace {
+			continue
+		}
+		records[rec.Key] = rec
+	}
+	if rec := records[key]; rec.Namespace != defaultNamespace || rec.TTL != "" || string(rec.Value) != `["one"]` {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	if rec := records[expiring]; rec.Namespace != name || rec.TTL == "" || rec.Type != typeJSON {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	err = cl.FlushAll(context.Background())
+	if err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	err = cl.DropNamespace(context.Background(), name)
+	if err != nil {
+		t.Fatalf("drop namespace: %v", err)
+	}
+
+	result, err := cl.Restore(context.Background(), strings.NewReader(dumped), client.RestoreFail)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if result.Restored != len(records) {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+	if !stored(key) {
+		t.Fatalf("key is not restored")
+	}
+	ns, _ := lookupNamespace(name)
+	if n, ok := ns.peek(expiring); !ok || n.done == nil {
+		t.Fatalf("expiring key is not restored")
+	}
+	if ns.maxMemory != 1000 {
+		t.Fatalf("memory limit is not restored: %d", ns.maxMemory)
+	}
+
+	_, err = cl.Restore(context.Background(), strings.NewReader(dumped), client.RestoreFail)
+	if err == nil {
+		t.Fatalf("restore over existing keys")
+	}
+	result, err = cl.Restore(context.Background(), strings.NewReader(dumped), client.RestoreSkip)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if result.Skipped != len(records) {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+	result, err = cl.Restore(context.Background(), strings.NewReader(dumped), client.RestoreOverwrite)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if result.Restored != len(records) {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+}
+
+func TestRestoreMalformed(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	for _, s := range []string{
+		`{`,
+		`{"key": "", "type": "json", "value": {}}`,
+		`{"key": "k", "type": "unknown", "value": {}}`,
+		`{"key": "k", "type": "json", "ttl": "-1s", "value": {}}`,
+		`{"namespace": "a/b", "key": "k", "type": "json", "value": {}}`,
+	} {
+		_, err := cl.Restore(context.Background(), strings.NewReader(s), client.RestoreFail)
+		if err == nil {
+			t.Fatalf("malformed record restored: %s", s)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+)
+
+const (
+	eventSet    = "set"
+	eventDel    = "del"
+	eventExpire = "expire"
+)
+
+const subscriberBuffer = 1024
+
+type event struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+// hub broadcasts key change events to subscribers, slow subscriber is
+// unsubscribed and its channel is closed when buffer is full, so
+// subscribers can tell lost events from end of stream.
+type eventHub struct {
+	lock        sync.RWMutex
+	subscribers map[chan event]struct{}
+}
+
+var hub = &eventHub{subscribers: make(map[chan event]struct{})}
+
+func (h *eventHub) subscribe() chan event {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ch := make(chan event, subscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends event with read lock held so that changes in different
+// shards are published concurrently.
+func (h *eventHub) publish(e event) {
+	var slow []chan event
+	h.lock.RLock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			slow = append(slow, ch)
+		}
+	}
+	h.lock.RUnlock()
+	for _, ch := range slow {
+		h.unsubscribe(ch)
+	}
+}
+
+// events streams key change events of the namespace as newline
+// delimited json, stream ends when subscriber is too slow so that
+// clients can drop cached state and resubscribe.
+func events(w http.ResponseWriter, r *http.Request) {
+	pattern := r.FormValue("pattern")
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		httpError(w, fmt.Sprintf("Bad pattern [%s].", pattern), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, "Streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
+	ns := namespaceOf(r)
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				log.Printf("Events: [%s]: subscriber is too slow.\n", r.RemoteAddr)
+				return
+			}
+			if e.Namespace != ns.name || !allowedIn(r.Context(), opRead, e.Namespace, e.Key) {
+				continue
+			}
+			if ok, _ := path.Match(pattern, e.Key); !ok {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
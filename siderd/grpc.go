@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aandryashin/sider/siderd/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"path"
+	"time"
+)
+
+var grpcListen string
+
+var grpcOperations = map[string]string{
+	api.Sider_Keys_FullMethodName:  opRead,
+	api.Sider_Get_FullMethodName:   opRead,
+	api.Sider_Set_FullMethodName:   opWrite,
+	api.Sider_Del_FullMethodName:   opDelete,
+	api.Sider_Batch_FullMethodName: opWrite,
+	api.Sider_Watch_FullMethodName: opRead,
+}
+
+var grpcEventTypes = map[string]api.Event_Type{
+	eventSet:    api.Event_SET,
+	eventDel:    api.Event_DEL,
+	eventExpire: api.Event_EXPIRE,
+}
+
+type grpcServer struct {
+	api.UnimplementedSiderServer
+}
+
+func newGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(grpcUnaryInterceptor),
+		grpc.StreamInterceptor(grpcStreamInterceptor))
+	s := grpc.NewServer(opts...)
+	api.RegisterSiderServer(s, &grpcServer{})
+	return s
+}
+
+// grpcContext authenticates call and applies rate limits like
+// authHandler and rateLimitHandler do for rest api.
+func grpcContext(ctx context.Context, method string) (context.Context, error) {
+	var t string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if h := md.Get("authorization"); len(h) > 0 {
+			t = bearer(h[0])
+		}
+	}
+	if l, ok := limiters[grpcOperations[method]]; ok {
+		id := "token:" + t
+		if _, ok := users[t]; !ok {
+			id = "addr:"
+			if p, ok := peer.FromContext(ctx); ok {
+				host, _, err := net.SplitHostPort(p.Addr.String())
+				if err != nil {
+					host = p.Addr.String()
+				}
+				id += host
+			}
+		}
+		if ok, wait := l.take(id, time.Now()); !ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %v", wait)
+		}
+	}
+	if users == nil {
+		return ctx, nil
+	}
+	u, ok := users[t]
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing token")
+	}
+	return context.WithValue(ctx, userKey{}, u), nil
+}
+
+func grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcContext(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcContext(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ss, ctx})
+}
+
+func grpcNamespace(ctx context.Context, op string, name string, key string) (*namespace, error) {
+	if name == "" {
+		name = defaultNamespace
+	}
+	if !allowedIn(ctx, op, name, key) {
+		return nil, status.Error(codes.PermissionDenied, "operation is not allowed")
+	}
+	ns, ok := lookupNamespace(name)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "namespace [%s] not found", name)
+	}
+	return ns, nil
+}
+
+func (s *grpcServer) Keys(ctx context.Context, req *api.KeysRequest) (*api.KeysResponse, error) {
+	ns, err := grpcNamespace(ctx, opRead, req.Namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ns.keys(ctx, func(k string) bool {
+		return allowedIn(ctx, opRead, ns.name, k)
+	})
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &api.KeysResponse{Keys: keys}, nil
+}
+
+func (s *grpcServer) Get(ctx context.Context, req *api.GetRequest) (*api.GetResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty key")
+	}
+	ns, err := grpcNamespace(ctx, opRead, req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := ns.get(req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "key [%s] not found", req.Key)
+	}
+	data := n.value()
+	if _, ok := data.(*raw); ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "value of key [%s] is not json", req.Key)
+	}
+	v, err := structpb.NewValue(data)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "convert value: %v", err)
+	}
+	return &api.GetResponse{Value: v}, nil
+}
+
+func (s *grpcServer) Set(ctx context.Context, req *api.SetRequest) (*api.SetResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty key")
+	}
+	var ttl time.Duration
+	if req.Ttl != nil {
+		ttl = req.Ttl.AsDuration()
+		if ttl <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "zero or negative ttl")
+		}
+	}
+	ns, err := grpcNamespace(ctx, opWrite, req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	data := req.Value.AsInterface()
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "marshal value: %v", err)
+	}
+	if err := checkValue(b); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "value of key [%s]: %v", req.Key, err)
+	}
+	switch err := ns.set(req.Key, data, int64(len(b)), ttl, setNew); err {
+	case nil:
+	case errExists:
+		return nil, status.Errorf(codes.AlreadyExists, "key [%s] already exists", req.Key)
+	case errMemoryLimit:
+		return nil, status.Errorf(codes.ResourceExhausted, "namespace [%s] memory limit exceeded", ns.name)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "value of key [%s]: %v", req.Key, err)
+	}
+	return &api.SetResponse{}, nil
+}
+
+func (s *grpcServer) Del(ctx context.Context, req *api.DelRequest) (*api.DelResponse, error) {
+	ns, err := grpcNamespace(ctx, opDelete, req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &api.DelResponse{Deleted: ns.del(req.Key)}, nil
+}
+
+func (s *grpcServer) Batch(ctx context.Context, req *api.BatchRequest) (*api.BatchResponse, error) {
+	results := make([]*api.Result, 0, len(req.Operations))
+	for _, op := range req.Operations {
+		var result api.Result
+		var err error
+		switch o := op.Op.(type) {
+		case *api.Operation_Get:
+			var resp *api.GetResponse
+			resp, err = s.Get(ctx, o.Get)
+			result.Result = &api.Result_Get{Get: resp}
+		case *api.Operation_Set:
+			var resp *api.SetResponse
+			resp, err = s.Set(ctx, o.Set)
+			result.Result = &api.Result_Set{Set: resp}
+		case *api.Operation_Del:
+			var resp *api.DelResponse
+			resp, err = s.Del(ctx, o.Del)
+			result.Result = &api.Result_Del{Del: resp}
+		default:
+			err = status.Error(codes.InvalidArgument, "empty operation")
+		}
+		if err != nil {
+			result.Result = &api.Result_Error{Error: status.Convert(err).Message()}
+		}
+		results = append(results, &result)
+	}
+	return &api.BatchResponse{Results: results}, nil
+}
+
+func (s *grpcServer) Watch(req *api.WatchRequest, stream api.Sider_WatchServer) error {
+	ctx := stream.Context()
+	ns, err := grpcNamespace(ctx, opRead, req.Namespace, "")
+	if err != nil {
+		return err
+	}
+	pattern := req.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad pattern [%s]", pattern)
+	}
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+	err = stream.SendHeader(metadata.MD{})
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-ch:
+			if !ok {
+				return status.Error(codes.DataLoss, "events lost, subscriber is too slow")
+			}
+			if e.Namespace != ns.name || !allowedIn(ctx, opRead, e.Namespace, e.Key) {
+				continue
+			}
+			if ok, _ := path.Match(pattern, e.Key); !ok {
+				continue
+			}
+			err := stream.Send(&api.Event{Type: grpcEventTypes[e.Type], Namespace: e.Namespace, Key: e.Key})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
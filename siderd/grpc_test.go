@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/aandryashin/sider/siderd/client/rpc"
+	"github.com/pborman/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func grpcClient(t *testing.T) (func(), *rpc.Client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := newGRPCServer(grpc.WaitForHandlers(true))
+	go s.Serve(l)
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return func() {
+		conn.Close()
+		s.Stop()
+	}, rpc.NewClient(conn)
+}
+
+func TestGRPC(t *testing.T) {
+	stop, c := grpcClient(t)
+	defer stop()
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	err := c.Set(ctx, key, strings.NewReader(`{"a":[1,"b",true]}`), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	err = c.Set(ctx, key, strings.NewReader(`1`), 0)
+	if !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v, err := c.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	expected := map[string]interface{}{"a": []interface{}{1.0, "b", true}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("unexpected value: %v", v)
+	}
+	n, _ := defaultNS().get(key)
+	if !reflect.DeepEqual(n.data, expected) {
+		t.Fatalf("unexpected stored value: %v", n.data)
+	}
+	keys, err := c.Keys(ctx)
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	found := false
+	for _, k := range keys {
+		found = found || k == key
+	}
+	if !found {
+		t.Fatalf("key [%s] not listed", key)
+	}
+	err = c.Del(ctx, key)
+	if err != nil {
+		t.Fatalf("del: %v", err)
+	}
+	if stored(key) {
+		t.Fatalf("key [%s] was not deleted", key)
+	}
+	_, err = c.Get(ctx, key)
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGRPCLimits(t *testing.T) {
+	stop, c := grpcClient(t)
+	defer stop()
+	ctx := context.Background()
+	defer func(n int) { maxDepth = n }(maxDepth)
+	maxDepth = 2
+	defer func(n int64) { maxValueSize = n }(maxValueSize)
+	maxValueSize = 10
+
+	key := uuid.New()
+	defer cleanup(key)
+	for _, value := range []string{`[[[1]]]`, `"` + strings.Repeat("a", 10) + `"`} {
+		err := c.Set(ctx, key, strings.NewReader(value), 0)
+		var e *rpc.Error
+		if !errors.As(err, &e) || e.Code != codes.InvalidArgument {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if stored(key) {
+		t.Fatalf("value exceeding limits is stored")
+	}
+	if err := c.Set(ctx, key, strings.NewReader(`[[1]]`), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+}
+
+func TestGRPCTTL(t *testing.T) {
+	stop, c := grpcClient(t)
+	defer stop()
+
+	key := uuid.New()
+	defer cleanup(key)
+	err := c.Set(context.Background(), key, strings.NewReader(`"value"`), time.Minute)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	ttl, ok := defaultNS().ttl(key)
+	if !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("unexpected ttl: %v", ttl)
+	}
+}
+
+func TestGRPCBatch(t *testing.T) {
+	stop, c := grpcClient(t)
+	defer stop()
+
+	key := uuid.New()
+	defer cleanup(key)
+	results, err := c.Batch().
+		Set(key, strings.NewReader(`"value"`), 0).
+		Get(key).
+		Set(key, strings.NewReader(`"other"`), 0).
+		Del(key).
+		Get(key).
+		Exec(context.Background())
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if results[0].Err != nil || results[1].Value != "value" {
+		t.Fatalf("unexpected set and get results: %v", results[:2])
+	}
+	if results[2].Err == nil {
+		t.Fatalf("set existing key succeeded in batch")
+	}
+	if results[3].Err != nil || results[4].Err == nil {
+		t.Fatalf("unexpected del and get results: %v", results[3:])
+	}
+}
+
+func TestGRPCWatch(t *testing.T) {
+	stop, c := grpcClient(t)
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prefix := uuid.New()
+	events, err := c.Watch(ctx, prefix+":*")
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	key, other := prefix+":key", uuid.New()
+	defer cleanup(key)
+	defer cleanup(other)
+	defaultNS().set(other, "ignored", 0, 0, setAlways)
+	defaultNS().set(key, "value", 0, 10*time.Millisecond, setAlways)
+
+	for _, expected := range []string{eventSet, eventExpire} {
+		select {
+		case e := <-events:
+			if e.Type != expected || e.Key != key || e.Namespace != defaultNamespace {
+				t.Fatalf("unexpected event: %v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", expected)
+		}
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	defer withUsers(t, testUsers)()
+	stop, c := grpcClient(t)
+	defer stop()
+	ctx := context.Background()
+
+	_, err := c.Get(ctx, "app:key")
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Token = "reader"
+	_, err = c.Get(ctx, "app:key")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = c.Get(ctx, "other")
+	if !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = c.Set(ctx, "app:key", strings.NewReader(`1`), 0)
+	if !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
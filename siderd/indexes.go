@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+	// maxIndexChunk is the number of entries in index chunk after which
+	// it is split in two.
+	maxIndexChunk = 512
+)
+
+var errBadPointer = errors.New("json pointer must be empty or start with /")
+
+// indexValue is indexed number or string, numbers are ordered before
+// strings.
+type indexValue struct {
+	str bool
+	n   float64
+	s   string
+}
+
+func (v indexValue) compare(o indexValue) int {
+	switch {
+	case v.str != o.str && v.str:
+		return 1
+	case v.str != o.str:
+		return -1
+	case v.str:
+		return strings.Compare(v.s, o.s)
+	case v.n < o.n:
+		return -1
+	case v.n > o.n:
+		return 1
+	}
+	return 0
+}
+
+func (v indexValue) MarshalJSON() ([]byte, error) {
+	if v.str {
+		return json.Marshal(v.s)
+	}
+	return json.Marshal(v.n)
+}
+
+func (v *indexValue) UnmarshalJSON(b []byte) error {
+	var data interface{}
+	err := json.Unmarshal(b, &data)
+	if err != nil {
+		return err
+	}
+	iv, ok := toIndexValue(data)
+	if !ok {
+		return fmt.Errorf("not a number or string: %s", b)
+	}
+	*v = iv
+	return nil
+}
+
+func toIndexValue(data interface{}) (indexValue, bool) {
+	switch d := data.(type) {
+	case float64:
+		return indexValue{n: d}, true
+	case string:
+		return indexValue{str: true, s: d}, true
+	}
+	return indexValue{}, false
+}
+
+type indexEntry struct {
+	Value indexValue `json:"v"`
+	Key   string     `json:"k"`
+}
+
+func (e indexEntry) less(o indexEntry) bool {
+	c := e.Value.compare(o.Value)
+	return c < 0 || c == 0 && e.Key < o.Key
+}
+
+// index keeps keys ordered by value found at json pointer path of
+// their values, keys without number or string at the path are not
+// indexed. Entries are kept in sorted chunks so that change of the key
+// moves entries of one chunk only, lock guards entries updated from
+// different shards.
+type index struct {
+	path   string
+	lock   sync.Mutex
+	chunks [][]indexEntry
+	values map[string]indexValue
+}
+
+// indexRecord is index definition in requests and dump.
+type indexRecord struct {
+	Path string `json:"path"`
+}
+
+type indexInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Keys int    `json:"keys"`
+}
+
+// indexQuery selects entries with value between optional bounds.
+type indexQuery struct {
+	from, to         *indexValue
+	fromOpen, toOpen bool
+	after            *indexEntry
+	limit            int
+}
+
+type queryItem struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type queryResult struct {
+	Items  []queryItem `json:"items"`
+	Cursor string      `json:"cursor,omitempty"`
+}
+
+// pointer returns value at json pointer path as defined by RFC 6901.
+func pointer(data interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return data, true
+	}
+	for _, token := range strings.Split(path[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch d := data.(type) {
+		case map[string]interface{}:
+			v, ok := d[token]
+			if !ok {
+				return nil, false
+			}
+			data = v
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(d) || token != strconv.Itoa(i) {
+				return nil, false
+			}
+			data = d[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func validPointer(path string) bool {
+	return path == "" || strings.HasPrefix(path, "/")
+}
+
+func newIndex(path string) *index {
+	return &index{path: path, values: make(map[string]indexValue)}
+}
+
+// search returns chunk and position in the chunk of the first entry
+// not less than e, chunk is len(idx.chunks) if there is no such entry.
+func (idx *index) search(e indexEntry) (int, int) {
+	c := sort.Search(len(idx.chunks), func(i int) bool {
+		chunk := idx.chunks[i]
+		return !chunk[len(chunk)-1].less(e)
+	})
+	if c == len(idx.chunks) {
+		return c, 0
+	}
+	chunk := idx.chunks[c]
+	return c, sort.Search(len(chunk), func(i int) bool {
+		return !chunk[i].less(e)
+	})
+}
+
+func (idx *index) add(key string, data interface{}) {
+	idx.remove(key)
+	v, ok := pointer(data, idx.path)
+	if !ok {
+		return
+	}
+	iv, ok := toIndexValue(v)
+	if !ok {
+		return
+	}
+	e := indexEntry{Value: iv, Key: key}
+	idx.values[key] = iv
+	if len(idx.chunks) == 0 {
+		idx.chunks = [][]indexEntry{{e}}
+		return
+	}
+	c, i := idx.search(e)
+	if c == len(idx.chunks) {
+		c, i = c-1, len(idx.chunks[c-1])
+	}
+	chunk := append(idx.chunks[c], indexEntry{})
+	copy(chunk[i+1:], chunk[i:])
+	chunk[i] = e
+	idx.chunks[c] = chunk
+	if len(chunk) <= maxIndexChunk {
+		return
+	}
+	half := len(chunk) / 2
+	tail := append([]indexEntry(nil), chunk[half:]...)
+	idx.chunks[c] = chunk[:half:half]
+	idx.chunks = append(idx.chunks, nil)
+	copy(idx.chunks[c+2:], idx.chunks[c+1:])
+	idx.chunks[c+1] = tail
+}
+
+func (idx *index) remove(key string) {
+	iv, ok := idx.values[key]
+	if !ok {
+		return
+	}
+	c, i := idx.search(indexEntry{Value: iv, Key: key})
+	chunk := append(idx.chunks[c][:i], idx.chunks[c][i+1:]...)
+	idx.chunks[c] = chunk
+	if len(chunk) == 0 {
+		idx.chunks = append(idx.chunks[:c], idx.chunks[c+1:]...)
+	}
+	delete(idx.values, key)
+}
+
+// query returns entries matching q accepted by filter and entry to
+// continue from if there are more entries.
+func (idx *index) query(q indexQuery, filter func(string) bool) ([]indexEntry, *indexEntry) {
+	var start indexEntry
+	if q.from != nil {
+		start = indexEntry{Value: *q.from}
+	}
+	if q.after != nil && (q.from == nil || start.less(*q.after)) {
+		start = *q.after
+	}
+	var entries []indexEntry
+	k, i := idx.search(start)
+scan:
+	for ; k < len(idx.chunks); k, i = k+1, 0 {
+		for ; i < len(idx.chunks[k]); i++ {
+			e := idx.chunks[k][i]
+			if q.after != nil && !q.after.less(e) {
+				continue
+			}
+			if q.from != nil {
+				c := e.Value.compare(*q.from)
+				if e.Value.str != q.from.str {
+					break scan
+				}
+				if c == 0 && q.fromOpen {
+					continue
+				}
+			}
+			if q.to != nil {
+				c := e.Value.compare(*q.to)
+				if c > 0 || c == 0 && q.toOpen {
+					break scan
+				}
+				if e.Value.str != q.to.str {
+					continue
+				}
+			}
+			if !filter(e.Key) {
+				continue
+			}
+			if len(entries) == q.limit {
+				return entries, &entries[len(entries)-1]
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// createIndex indexes existing keys and maintains index on every
+// change of the keys.
+func (ns *namespace) createIndex(name string, path string) error {
+	unlock := ns.lockAll()
+	defer unlock()
+	ns.indexLock.Lock()
+	defer ns.indexLock.Unlock()
+	if _, ok := ns.indexes[name]; ok {
+		return errExists
+	}
+	idx := newIndex(path)
+	for _, s := range ns.shards {
+		for key, n := range s.storage {
+			idx.add(key, n.value())
+		}
+	}
+	ns.indexes[name] = idx
+	log.Printf("Create index: [%s] on [%s].\n", name, path)
+	return nil
+}
+
+func (ns *namespace) dropIndex(name string) bool {
+	unlock := ns.lockAll()
+	defer unlock()
+	ns.indexLock.Lock()
+	defer ns.indexLock.Unlock()
+	_, ok := ns.indexes[name]
+	delete(ns.indexes, name)
+	return ok
+}
+
+func (ns *namespace) indexInfo() []indexInfo {
+	ns.indexLock.Lock()
+	defer ns.indexLock.Unlock()
+	infos := []indexInfo{}
+	for name, idx := range ns.indexes {
+		idx.lock.Lock()
+		infos = append(infos, indexInfo{Name: name, Path: idx.path, Keys: len(idx.values)})
+		idx.lock.Unlock()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// indexRecords returns sorted index names and their definitions.
+func (ns *namespace) indexRecords() ([]string, map[string]indexRecord) {
+	ns.indexLock.Lock()
+	defer ns.indexLock.Unlock()
+	names := []string{}
+	records := make(map[string]indexRecord)
+	for name, idx := range ns.indexes {
+		names = append(names, name)
+		records[name] = indexRecord{Path: idx.path}
+	}
+	sort.Strings(names)
+	return names, records
+}
+
+// restoreIndex creates index from dump record, existing index is
+// replaced only with setAlways mode.
+func (ns *namespace) restoreIndex(name string, rec indexRecord, mode setMode) error {
+	if !validPointer(rec.Path) {
+		return errBadPointer
+	}
+	err := ns.createIndex(name, rec.Path)
+	if err == errExists && mode == setAlways {
+		ns.dropIndex(name)
+		err = ns.createIndex(name, rec.Path)
+	}
+	return err
+}
+
+// query returns keys of the index matching q and their values if
+// values is set. Values are read after index lookup, keys removed in
+// between are skipped.
+func (ns *namespace) query(name string, q indexQuery, values bool, filter func(string) bool) (*queryResult, error) {
+	ns.indexLock.Lock()
+	idx, ok := ns.indexes[name]
+	ns.indexLock.Unlock()
+	if !ok {
+		return nil, errNotFound
+	}
+	idx.lock.Lock()
+	entries, next := idx.query(q, filter)
+	idx.lock.Unlock()
+	result := &queryResult{Items: []queryItem{}}
+	for _, e := range entries {
+		item := queryItem{Key: e.Key}
+		if values {
+			n, ok := ns.peek(e.Key)
+			if !ok {
+				continue
+			}
+			item.Value = n.value()
+		}
+		result.Items = append(result.Items, item)
+	}
+	if next != nil {
+		b, _ := json.Marshal(next)
+		result.Cursor = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return result, nil
+}
+
+// indexValueParam parses json number or string parameter, value which
+// is not valid json is a string.
+func indexValueParam(r *http.Request, name string) (*indexValue, bool) {
+	s, ok := r.Form[name]
+	if !ok {
+		return nil, true
+	}
+	var data interface{}
+	if json.Unmarshal([]byte(s[0]), &data) != nil {
+		data = s[0]
+	}
+	v, ok := toIndexValue(data)
+	return &v, ok
+}
+
+func queryParams(r *http.Request) (indexQuery, bool) {
+	q := indexQuery{}
+	r.ParseForm()
+	eq, ok1 := indexValueParam(r, "eq")
+	gt, ok2 := indexValueParam(r, "gt")
+	gte, ok3 := indexValueParam(r, "gte")
+	lt, ok4 := indexValueParam(r, "lt")
+	lte, ok5 := indexValueParam(r, "lte")
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 {
+		return q, false
+	}
+	switch {
+	case eq != nil:
+		q.from, q.to = eq, eq
+	default:
+		q.from, q.fromOpen = gte, false
+		if gt != nil {
+			q.from, q.fromOpen = gt, true
+		}
+		q.to, q.toOpen = lte, false
+		if lt != nil {
+			q.to, q.toOpen = lt, true
+		}
+	}
+	var ok bool
+	q.limit, ok = intParam(r, "limit", defaultQueryLimit, maxQueryLimit)
+	if !ok || q.limit == 0 {
+		return q, false
+	}
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return q, false
+		}
+		var after indexEntry
+		if json.Unmarshal(b, &after) != nil {
+			return q, false
+		}
+		q.after = &after
+	}
+	return q, true
+}
+
+func createIndexHandler(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	var req indexRecord
+	if _, ok := decodeValue(w, r, &req); !ok {
+		return
+	}
+	if !validPointer(req.Path) {
+		httpError(w, fmt.Sprintf("Bad path [%s]: %v.", req.Path, errBadPointer), http.StatusBadRequest)
+		return
+	}
+	err := namespaceOf(r).createIndex(name, req.Path)
+	switch {
+	case err == errExists:
+		httpError(w, fmt.Sprintf("Index [%s] already exists.", name), http.StatusConflict)
+	case err != nil:
+		httpError(w, fmt.Sprintf("Create index [%s]: %v.", name, err), http.StatusInternalServerError)
+	}
+}
+
+func dropIndexHandler(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	if !namespaceOf(r).dropIndex(name) {
+		httpError(w, fmt.Sprintf("Index [%s] not found.", name), http.StatusNotFound)
+		return
+	}
+	log.Printf("Drop index: [%s].\n", name)
+}
+
+func listIndexes(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(namespaceOf(r).indexInfo())
+}
+
+// queryHandler returns keys with indexed value equal to eq or within
+// gt, gte, lt and lte bounds ordered by value. Cursor of the response
+// continues the query, values parameter includes values of the keys.
+func queryHandler(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	q, ok := queryParams(r)
+	if !ok {
+		httpError(w, "Bad query parameters.", http.StatusBadRequest)
+		return
+	}
+	values, _ := strconv.ParseBool(r.FormValue("values"))
+	ns := namespaceOf(r)
+	result, err := ns.query(name, q, values, func(k string) bool {
+		return permitted(r, opRead, ns.name, k)
+	})
+	if err == errNotFound {
+		httpError(w, fmt.Sprintf("Index [%s] not found.", name), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"math/rand"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPointer(t *testing.T) {
+	data := map[string]interface{}{
+		"a/b":  1.0,
+		"m~n":  2.0,
+		"list": []interface{}{"x", map[string]interface{}{"y": "z"}},
+	}
+	for path, expected := range map[string]interface{}{
+		"/a~1b":     1.0,
+		"/m~0n":     2.0,
+		"/list/0":   "x",
+		"/list/1/y": "z",
+	} {
+		v, ok := pointer(data, path)
+		if !ok || v != expected {
+			t.Fatalf("unexpected value at [%s]: %v, %v", path, v, ok)
+		}
+	}
+	for _, path := range []string{"/missing", "/list/2", "/list/01", "/list/-1", "/a~1b/c"} {
+		if v, ok := pointer(data, path); ok {
+			t.Fatalf("unexpected value at [%s]: %v", path, v)
+		}
+	}
+}
+
+func TestIndexQuery(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	ns := uuid.New()
+	admin := client.NewClient(server.URL)
+	ctx := context.Background()
+	if err := admin.CreateNamespace(ctx, ns, 0); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer admin.DropNamespace(ctx, ns)
+	cl := client.NewClient(server.URL, client.WithNamespace(ns))
+
+	cl.Set(ctx, "before", strings.NewReader(`{"status": "pending", "priority": 5}`), 0)
+	if err := cl.CreateIndex(ctx, "status", "/status"); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	if err := cl.CreateIndex(ctx, "status", "/other"); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.CreateIndex(ctx, "priority", "/priority"); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		status := "done"
+		if i%2 == 0 {
+			status = "pending"
+		}
+		cl.Set(ctx, fmt.Sprintf("job%d", i), strings.NewReader(fmt.Sprintf(`{"status": %q, "priority": %d}`, status, i)), 0)
+	}
+	cl.Set(ctx, "string", strings.NewReader(`{"priority": "high"}`), 0)
+	cl.Set(ctx, "scalar", strings.NewReader(`1`), 0)
+
+	result, err := cl.Query(ctx, "status", client.Query{Eq: "pending", Values: true})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if keys := queryKeys(result); keys != "before,job0,job2,job4,job6,job8" {
+		t.Fatalf("unexpected keys: %s", keys)
+	}
+	if string(result.Items[0].Value) != `{"priority":5,"status":"pending"}` || result.Cursor != "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	result, err = cl.Query(ctx, "priority", client.Query{Gt: 3, Lte: 7, Limit: 3})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if keys := queryKeys(result); keys != "job4,before,job5" || result.Cursor == "" {
+		t.Fatalf("unexpected first page: %s, %s", keys, result.Cursor)
+	}
+	result, err = cl.Query(ctx, "priority", client.Query{Gt: 3, Lte: 7, Limit: 3, Cursor: result.Cursor})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if keys := queryKeys(result); keys != "job6,job7" || result.Cursor != "" {
+		t.Fatalf("unexpected second page: %s, %s", keys, result.Cursor)
+	}
+	result, _ = cl.Query(ctx, "priority", client.Query{Gte: "a"})
+	if keys := queryKeys(result); keys != "string" {
+		t.Fatalf("numbers match string range: %s", keys)
+	}
+	result, _ = cl.Query(ctx, "priority", client.Query{Lt: 2})
+	if keys := queryKeys(result); keys != "job0,job1" {
+		t.Fatalf("unexpected keys: %s", keys)
+	}
+
+	cl.Put(ctx, "job0", strings.NewReader(`{"status": "done"}`), 0)
+	cl.Del(ctx, "job2")
+	cl.Set(ctx, "job10", strings.NewReader(`{"status": "pending"}`), 10*time.Millisecond)
+	result, _ = cl.Query(ctx, "status", client.Query{Eq: "pending"})
+	if keys := queryKeys(result); keys != "before,job10,job4,job6,job8" {
+		t.Fatalf("index is not updated: %s", keys)
+	}
+	time.Sleep(50 * time.Millisecond)
+	result, _ = cl.Query(ctx, "status", client.Query{Eq: "pending"})
+	if keys := queryKeys(result); keys != "before,job4,job6,job8" {
+		t.Fatalf("expired key is not removed from index: %s", keys)
+	}
+
+	infos, err := cl.Indexes(ctx)
+	if err != nil {
+		t.Fatalf("indexes: %v", err)
+	}
+	if len(infos) != 2 || infos[1].Name != "status" || infos[1].Keys != 10 {
+		t.Fatalf("unexpected indexes: %+v", infos)
+	}
+	if err := cl.DropIndex(ctx, "status"); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	if _, err := cl.Query(ctx, "status", client.Query{}); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestIndexChunks(t *testing.T) {
+	idx := newIndex("/v")
+	var expected []indexEntry
+	for _, i := range rand.New(rand.NewSource(1)).Perm(5 * maxIndexChunk) {
+		key := fmt.Sprintf("key%d", i)
+		idx.add(key, map[string]interface{}{"v": float64(i % 100)})
+		if i%3 == 0 {
+			idx.remove(key)
+			continue
+		}
+		expected = append(expected, indexEntry{Value: indexValue{n: float64(i % 100)}, Key: key})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].less(expected[j])
+	})
+	if len(idx.chunks) < 2 {
+		t.Fatalf("index is not split: %d chunks", len(idx.chunks))
+	}
+	var entries []indexEntry
+	q := indexQuery{limit: 100}
+	for {
+		page, next := idx.query(q, func(string) bool { return true })
+		entries = append(entries, page...)
+		if next == nil {
+			break
+		}
+		q.after = next
+	}
+	if fmt.Sprint(entries) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	from, to := indexValue{n: 10}, indexValue{n: 11}
+	entries, _ = idx.query(indexQuery{from: &from, to: &to, toOpen: true, limit: maxQueryLimit}, func(string) bool { return true })
+	for _, e := range entries {
+		if e.Value.n != 10 {
+			t.Fatalf("unexpected entry: %+v", e)
+		}
+	}
+	if len(entries) == 0 {
+		t.Fatal("no entries found")
+	}
+}
+
+func TestIndexDumpRestore(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	ns := uuid.New()
+	admin := client.NewClient(server.URL)
+	ctx := context.Background()
+	if err := admin.CreateNamespace(ctx, ns, 0); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer admin.DropNamespace(ctx, ns)
+	cl := client.NewClient(server.URL, client.WithNamespace(ns))
+
+	cl.Set(ctx, "job", strings.NewReader(`{"status": "pending"}`), 0)
+	if err := cl.CreateIndex(ctx, "status", "/status"); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := admin.Dump(ctx, &buf); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"key":"status","type":"index","value":{"path":"/status"}`) {
+		t.Fatalf("index is not dumped: %s", buf.String())
+	}
+	dump := buf.String()
+	if _, err := admin.Restore(ctx, strings.NewReader(dump), client.RestoreSkip); err != nil {
+		t.Fatalf("restore existing index: %v", err)
+	}
+	cl.DropIndex(ctx, "status")
+	if _, err := admin.Restore(ctx, strings.NewReader(dump), client.RestoreSkip); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	result, err := cl.Query(ctx, "status", client.Query{Eq: "pending"})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if keys := queryKeys(result); keys != "job" {
+		t.Fatalf("unexpected keys: %s", keys)
+	}
+}
+
+func queryKeys(result *client.QueryResult) string {
+	var keys []string
+	for _, item := range result.Items {
+		keys = append(keys, item.Key)
+	}
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+const (
+	defaultMaxKeyLength = 1024
+	defaultMaxValueSize = 16 << 20
+	defaultMaxDepth     = 64
+
+	defaultBigKeys = 10
+	maxBigKeys     = 1000
+)
+
+var (
+	maxKeyLength int
+	maxValueSize int64
+	maxDepth     int
+
+	errKeyTooLong    = errors.New("key is too long")
+	errValueTooLarge = errors.New("value is too large")
+	errTooDeep       = errors.New("value is nested too deep")
+)
+
+type bigKey struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+}
+
+// checkLimits checks key length and value size, zero limits are not
+// applied.
+func checkLimits(key string, size int64) error {
+	switch {
+	case maxKeyLength > 0 && len(key) > maxKeyLength:
+		return errKeyTooLong
+	case maxValueSize > 0 && size > maxValueSize:
+		return errValueTooLarge
+	}
+	return nil
+}
+
+// valueReader counts bytes of json value read from the request body
+// failing as soon as value exceeds size or nesting depth limits so that
+// large values are never read into memory.
+type valueReader struct {
+	r     io.Reader
+	n     int64
+	depth int
+	str   bool
+	esc   bool
+}
+
+func (v *valueReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.n += int64(n)
+	if maxValueSize > 0 && v.n > maxValueSize {
+		return 0, errValueTooLarge
+	}
+	for _, b := range p[:n] {
+		switch {
+		case v.esc:
+			v.esc = false
+		case v.str && b == '\\':
+			v.esc = true
+		case b == '"':
+			v.str = !v.str
+		case v.str:
+		case b == '{' || b == '[':
+			v.depth++
+			if maxDepth > 0 && v.depth > maxDepth {
+				return 0, errTooDeep
+			}
+		case b == '}' || b == ']':
+			v.depth--
+		}
+	}
+	return n, err
+}
+
+// checkValue checks size and nesting depth of json value received
+// other than in request body, e.g. over gRPC.
+func checkValue(b []byte) error {
+	_, err := io.Copy(ioutil.Discard, &valueReader{r: bytes.NewReader(b)})
+	return err
+}
+
+// decodeValue decodes json value of the request body into v enforcing
+// value limits and returns number of bytes read, it replies with error
+// and returns false if value can not be decoded.
+func decodeValue(w http.ResponseWriter, r *http.Request, v interface{}) (int64, bool) {
+	body := &valueReader{r: r.Body}
+	err := json.NewDecoder(body).Decode(v)
+	switch err {
+	case nil:
+		return body.n, true
+	case errValueTooLarge, errTooDeep:
+		limitExceeded(w, err)
+	default:
+		httpError(w, fmt.Sprintf("Parse request: %v", err), http.StatusBadRequest)
+	}
+	return 0, false
+}
+
+// limitExceeded replies with 413 describing exceeded limit.
+func limitExceeded(w http.ResponseWriter, err error) {
+	var message string
+	switch err {
+	case errKeyTooLong:
+		message = fmt.Sprintf("Key length exceeds limit [%d] bytes.", maxKeyLength)
+	case errValueTooLarge:
+		message = fmt.Sprintf("Value size exceeds limit [%d] bytes.", maxValueSize)
+	case errTooDeep:
+		message = fmt.Sprintf("Value nesting depth exceeds limit [%d].", maxDepth)
+	}
+	httpError(w, message, http.StatusRequestEntityTooLarge)
+}
+
+// bigKeys returns at most count largest keys of the namespace ordered
+// by size.
+func (ns *namespace) bigKeys(count int) []bigKey {
+	keys := []bigKey{}
+	for _, s := range ns.shards {
+		s.lock.RLock()
+		for key, n := range s.storage {
+			if len(keys) == count && n.size <= keys[count-1].Size {
+				continue
+			}
+			i := sort.Search(len(keys), func(i int) bool {
+				return keys[i].Size < n.size
+			})
+			if len(keys) < count {
+				keys = append(keys, bigKey{})
+			}
+			copy(keys[i+1:], keys[i:])
+			keys[i] = bigKey{Namespace: ns.name, Key: key, Size: n.size}
+		}
+		s.lock.RUnlock()
+	}
+	return keys
+}
+
+// bigKeysHandler returns largest keys of all namespaces or of the
+// namespace given with ns parameter.
+func bigKeysHandler(w http.ResponseWriter, r *http.Request) {
+	count, ok := intParam(r, "count", defaultBigKeys, maxBigKeys)
+	if !ok || count == 0 {
+		httpError(w, fmt.Sprintf("Bad count [%s].", r.FormValue("count")), http.StatusBadRequest)
+		return
+	}
+	names := namespaceNames()
+	if name := r.FormValue("ns"); name != "" {
+		names = []string{name}
+	}
+	keys := []bigKey{}
+	for _, name := range names {
+		ns, ok := lookupNamespace(name)
+		if !ok {
+			httpError(w, fmt.Sprintf("Namespace [%s] not found.", name), http.StatusNotFound)
+			return
+		}
+		keys = append(keys, ns.bigKeys(count)...)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].Size > keys[j].Size
+	})
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	json.NewEncoder(w).Encode(keys)
+}
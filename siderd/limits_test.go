@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	ctx := context.Background()
+	name := uuid.New()
+	admin := client.NewClient(server.URL)
+	if err := admin.CreateNamespace(ctx, name, 0); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer admin.DropNamespace(ctx, name)
+	cl := client.NewClient(server.URL, client.WithNamespace(name))
+
+	defer func(n int, s int64, d int) { maxKeyLength, maxValueSize, maxDepth = n, s, d }(maxKeyLength, maxValueSize, maxDepth)
+	maxKeyLength, maxValueSize, maxDepth = 40, 64, 3
+
+	long := strings.Repeat("k", 41)
+	if err := cl.Set(ctx, long, strings.NewReader(`1`), 0); !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key := uuid.New()
+	if err := cl.Set(ctx, key, strings.NewReader(`"`+strings.Repeat("v", 100)+`"`), 0); !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Set(ctx, key, strings.NewReader(`[[[[1]]]]`), 0); !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Set(ctx, key, strings.NewReader(`[[["[[[[\"]]"]]]`), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := cl.ListPush(ctx, key, strings.NewReader(`"`+strings.Repeat("v", 60)+`"`)); !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Copy(ctx, key, long, 0); !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := cl.Eval(ctx, `sider.set(KEYS[1], string.rep("v", 100))`, []string{key}, nil, nil)
+	if !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cl.Set(ctx, "small", strings.NewReader(`1`), 0)
+	cl.Set(ctx, "large", strings.NewReader(`"`+strings.Repeat("v", 30)+`"`), 0)
+	keys, err := admin.BigKeys(ctx, name, 2)
+	if err != nil {
+		t.Fatalf("big keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Key != key || keys[1].Key != "large" {
+		t.Fatalf("unexpected big keys: %+v", keys)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pborman/uuid"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const defaultLeaseTTL = 30 * time.Second
+
+var (
+	errLocked   = errors.New("lock is held by another owner")
+	errNotOwner = errors.New("lock is not held by owner")
+
+	// fenceCounter issues fencing tokens, it is shared by all locks so
+	// that tokens of every lock grow monotonically.
+	fenceCounter uint64
+)
+
+type lease struct {
+	owner   string
+	fence   uint64
+	expires time.Time
+	// released is closed when lease is released to wake up waiters.
+	released chan struct{}
+}
+
+type leaseInfo struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner,omitempty"`
+	Fence uint64 `json:"fence"`
+	TTL   string `json:"ttl"`
+}
+
+func (l *lease) info(name string, owner bool) leaseInfo {
+	info := leaseInfo{Name: name, Fence: l.fence, TTL: time.Until(l.expires).String()}
+	if owner {
+		info.Owner = l.owner
+	}
+	return info
+}
+
+// held returns lease of the lock if it is not expired, must be called
+// with lease lock held.
+func (ns *namespace) held(name string) (*lease, bool) {
+	l, ok := ns.leases[name]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(l.expires) {
+		delete(ns.leases, name)
+		close(l.released)
+		return nil, false
+	}
+	return l, true
+}
+
+// acquire takes the lock for ttl waiting until it is released or
+// expired if ctx allows.
+func (ns *namespace) acquire(ctx context.Context, name string, ttl time.Duration) (*lease, error) {
+	for {
+		ns.leaseLock.Lock()
+		l, ok := ns.held(name)
+		if !ok {
+			l = &lease{
+				owner:    uuid.New(),
+				fence:    atomic.AddUint64(&fenceCounter, 1),
+				expires:  time.Now().Add(ttl),
+				released: make(chan struct{}),
+			}
+			ns.leases[name] = l
+			ns.leaseLock.Unlock()
+			go ns.expireLease(name, l)
+			return l, nil
+		}
+		released, expires := l.released, time.Until(l.expires)
+		ns.leaseLock.Unlock()
+		timer := time.NewTimer(expires)
+		select {
+		case <-released:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errLocked
+		}
+		timer.Stop()
+	}
+}
+
+func (ns *namespace) renew(name string, owner string, ttl time.Duration) (*lease, error) {
+	ns.leaseLock.Lock()
+	defer ns.leaseLock.Unlock()
+	l, ok := ns.held(name)
+	if !ok || l.owner != owner {
+		return nil, errNotOwner
+	}
+	l.expires = time.Now().Add(ttl)
+	return l, nil
+}
+
+func (ns *namespace) release(name string, owner string) error {
+	ns.leaseLock.Lock()
+	defer ns.leaseLock.Unlock()
+	l, ok := ns.held(name)
+	if !ok || l.owner != owner {
+		return errNotOwner
+	}
+	delete(ns.leases, name)
+	close(l.released)
+	return nil
+}
+
+// expireLease removes the lease once it expires so that locks which are
+// not touched again do not stay in memory.
+func (ns *namespace) expireLease(name string, l *lease) {
+	for {
+		ns.leaseLock.Lock()
+		if ns.leases[name] != l {
+			ns.leaseLock.Unlock()
+			return
+		}
+		ttl := time.Until(l.expires)
+		if ttl <= 0 {
+			ns.held(name)
+			ns.leaseLock.Unlock()
+			log.Printf("Lock expired: [%s].\n", name)
+			return
+		}
+		ns.leaseLock.Unlock()
+		timer := time.NewTimer(ttl)
+		select {
+		case <-timer.C:
+		case <-l.released:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// restoreFence raises fence counter to dumped value so that fencing
+// tokens issued after restore are greater than ones issued before dump.
+func restoreFence(value json.RawMessage) error {
+	var fence uint64
+	if err := json.Unmarshal(value, &fence); err != nil {
+		return fmt.Errorf("parse value: %v", err)
+	}
+	for {
+		current := atomic.LoadUint64(&fenceCounter)
+		if current >= fence || atomic.CompareAndSwapUint64(&fenceCounter, current, fence) {
+			return nil
+		}
+	}
+}
+
+// flushLeases releases all locks waking up waiters.
+func (ns *namespace) flushLeases() {
+	ns.leaseLock.Lock()
+	defer ns.leaseLock.Unlock()
+	for _, l := range ns.leases {
+		close(l.released)
+	}
+	ns.leases = make(map[string]*lease)
+}
+
+func leaseTTL(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		return defaultLeaseTTL
+	}
+	return ttl
+}
+
+// acquireLock takes the lock failing with 409 if it is held, optional
+// wait parameter sets how long to wait for the lock.
+func acquireLock(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	wait, ok := durationParam(r, "wait", maxWait)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad wait duration [%s].", r.FormValue("wait")), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	l, err := namespaceOf(r).acquire(ctx, name, leaseTTL(ttl))
+	if err != nil {
+		httpError(w, fmt.Sprintf("Lock [%s] is held.", name), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(l.info(name, true))
+	log.Printf("Lock: [%s] fence: [%d].\n", name, l.fence)
+}
+
+func renewLock(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	l, err := namespaceOf(r).renew(name, r.FormValue("owner"), leaseTTL(ttl))
+	if err != nil {
+		httpError(w, fmt.Sprintf("Lock [%s] is not held by owner.", name), http.StatusPreconditionFailed)
+		return
+	}
+	json.NewEncoder(w).Encode(l.info(name, true))
+}
+
+func releaseLock(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	err := namespaceOf(r).release(name, r.FormValue("owner"))
+	if err != nil {
+		httpError(w, fmt.Sprintf("Lock [%s] is not held by owner.", name), http.StatusPreconditionFailed)
+		return
+	}
+	log.Printf("Unlock: [%s].\n", name)
+}
+
+func lockInfo(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	ns := namespaceOf(r)
+	ns.leaseLock.Lock()
+	l, ok := ns.held(name)
+	var info leaseInfo
+	if ok {
+		info = l.info(name, false)
+	}
+	ns.leaseLock.Unlock()
+	if !ok {
+		httpError(w, fmt.Sprintf("Lock [%s] is not held.", name), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
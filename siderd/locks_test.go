@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name := uuid.New()
+	l, err := cl.Lock(ctx, name, time.Minute, 0)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if l.Owner == "" || l.Fence == 0 {
+		t.Fatalf("unexpected lease: %+v", l)
+	}
+	_, err = cl.Lock(ctx, name, time.Minute, 10*time.Millisecond)
+	if !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other := &client.Lease{Name: name, Owner: "other"}
+	if err := cl.Renew(ctx, other, time.Minute); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("renew by other owner: %v", err)
+	}
+	if err := cl.Unlock(ctx, other); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("unlock by other owner: %v", err)
+	}
+	if err := cl.Renew(ctx, l, time.Minute); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if err := cl.Unlock(ctx, l); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	next, err := cl.Lock(ctx, name, time.Minute, 0)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer cl.Unlock(ctx, next)
+	if next.Fence <= l.Fence {
+		t.Fatalf("fencing token does not grow: %d, %d", l.Fence, next.Fence)
+	}
+	if _, err := cl.Scoped(defaultNamespace).Lock(ctx, name, time.Minute, 0); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("lock is not found in default namespace: %v", err)
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name := uuid.New()
+	expiring, err := cl.Lock(ctx, name, 20*time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	l, err := cl.Lock(ctx, name, time.Minute, time.Second)
+	if err != nil {
+		t.Fatalf("lock after expiration: %v", err)
+	}
+	if err := cl.Unlock(ctx, expiring); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("expired lease is released: %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cl.Unlock(ctx, l)
+	}()
+	start := time.Now()
+	l, err = cl.Lock(ctx, name, time.Minute, time.Second)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	defer cl.Unlock(ctx, l)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("waiter is not woken up on release")
+	}
+}
+
+func TestMutex(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+
+	name := uuid.New()
+	m := cl.NewMutex(name, 30*time.Millisecond)
+	err := m.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if m.Fence() == 0 {
+		t.Fatalf("zero fencing token")
+	}
+
+	other := cl.NewMutex(name, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = other.Lock(ctx)
+	if err == nil {
+		t.Fatalf("lease is not renewed")
+	}
+	select {
+	case <-m.Lost():
+		t.Fatalf("lease is lost")
+	default:
+	}
+	err = m.Unlock(context.Background())
+	if err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if m.Fence() != 0 {
+		t.Fatalf("fencing token of unlocked mutex")
+	}
+	err = other.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	other.Unlock(context.Background())
+}
+
+func TestMutexLost(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+
+	name := uuid.New()
+	m := cl.NewMutex(name, 30*time.Millisecond)
+	err := m.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	ns := defaultNS()
+	ns.leaseLock.Lock()
+	delete(ns.leases, name)
+	ns.leaseLock.Unlock()
+	select {
+	case <-m.Lost():
+	case <-time.After(time.Second):
+		t.Fatalf("lost lease is not reported")
+	}
+	if err := m.Unlock(context.Background()); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLockExpiration(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name := uuid.New()
+	if _, err := cl.Lock(ctx, name, 10*time.Millisecond, 0); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	ns := defaultNS()
+	ns.leaseLock.Lock()
+	_, ok := ns.leases[name]
+	ns.leaseLock.Unlock()
+	if ok {
+		t.Fatalf("expired lease is not removed")
+	}
+
+	l, err := cl.Lock(ctx, name, 0, 0)
+	if err != nil {
+		t.Fatalf("lock with default ttl: %v", err)
+	}
+	defer cl.Unlock(ctx, l)
+	if ttl, _ := time.ParseDuration(l.TTL); ttl <= 20*time.Second {
+		t.Fatalf("unexpected ttl: %s", l.TTL)
+	}
+}
+
+func TestLockFenceRestore(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	fence := atomic.LoadUint64(&fenceCounter) + 1000
+	_, err := cl.Restore(ctx, strings.NewReader(fmt.Sprintf(`{"key": "fence", "type": "fence", "value": %d}`, fence)), client.RestoreFail)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	l, err := cl.Lock(ctx, uuid.New(), time.Minute, 0)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer cl.Unlock(ctx, l)
+	if l.Fence <= fence {
+		t.Fatalf("fencing token is not above restored one: %d", l.Fence)
+	}
+
+	var buf bytes.Buffer
+	if err := cl.Dump(ctx, &buf); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	if !strings.Contains(buf.String(), fmt.Sprintf(`"type":"fence","value":%d`, l.Fence)) {
+		t.Fatalf("fence counter is not dumped: %s", buf.String())
+	}
+}
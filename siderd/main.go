@@ -1,11 +1,16 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
 	"flag"
 	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -13,6 +18,9 @@ import (
 	"time"
 )
 
+// maxWait limits time requests wait for locks and messages.
+const maxWait = time.Minute
+
 var (
 	listen      string
 	gracePeriod time.Duration
@@ -24,7 +32,7 @@ func allowed(m handlerMethods) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handler, ok := m[r.Method]
 		if !ok {
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			httpError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 			return
 		}
 		handler.ServeHTTP(w, r)
@@ -49,16 +57,61 @@ func clientDisconnectHandler(handler http.Handler) http.Handler {
 		select {
 		case <-cnch:
 			cancel()
+			<-done
 		case <-done:
 		}
 	})
 }
 
+// pathFragments splits escaped request path so that escaped slashes
+// stay in their fragments and unescapes every fragment.
+func pathFragments(r *http.Request) []string {
+	fragments := strings.Split(r.URL.EscapedPath(), "/")
+	for i, f := range fragments {
+		if s, err := url.PathUnescape(f); err == nil {
+			fragments[i] = s
+		}
+	}
+	return fragments
+}
+
+func keyParam(r *http.Request) string {
+	fragments := pathFragments(r)
+	if len(fragments) < 3 {
+		return ""
+	}
+	return fragments[2]
+}
+
+type handlerActions map[string]http.Handler
+
+// actions dispatches requests to /keys/{key}/{action} by action name,
+// empty action means request to the key itself.
+func actions(m handlerActions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var action string
+		fragments := pathFragments(r)
+		if len(fragments) > 3 {
+			action = strings.Join(fragments[3:], "/")
+		}
+		handler, ok := m[action]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
 func withParams(fn func(http.ResponseWriter, *http.Request, string, time.Duration)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := strings.Split(r.URL.Path, "/")[2]
+		key := keyParam(r)
 		if key == "" {
-			http.Error(w, "Empty key.", http.StatusBadRequest)
+			httpError(w, "Empty key.", http.StatusBadRequest)
+			return
+		}
+		if maxKeyLength > 0 && len(key) > maxKeyLength {
+			limitExceeded(w, errKeyTooLong)
 			return
 		}
 		var ttl time.Duration
@@ -67,11 +120,11 @@ func withParams(fn func(http.ResponseWriter, *http.Request, string, time.Duratio
 		if ttlStr != "" {
 			ttl, err = time.ParseDuration(ttlStr)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Parse TTL: %v", err), http.StatusBadRequest)
+				httpError(w, fmt.Sprintf("Parse TTL: %v", err), http.StatusBadRequest)
 				return
 			}
 			if ttl <= 0 {
-				http.Error(w, "Zero or negative TTL.", http.StatusBadRequest)
+				httpError(w, "Zero or negative TTL.", http.StatusBadRequest)
 				return
 			}
 		}
@@ -79,21 +132,207 @@ func withParams(fn func(http.ResponseWriter, *http.Request, string, time.Duratio
 	})
 }
 
+// durationParam parses optional non negative duration parameter not
+// greater than max, missing parameter is zero.
+func durationParam(r *http.Request, name string, max time.Duration) (time.Duration, bool) {
+	s := r.FormValue(name)
+	if s == "" {
+		return 0, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || d > max {
+		return 0, false
+	}
+	return d, true
+}
+
+func withName(op string, fn func(http.ResponseWriter, *http.Request, string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := keyParam(r)
+		if !permitted(r, op, name, "") {
+			httpError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		fn(w, r, name)
+	})
+}
+
+func namespaceHandler(keys http.Handler) http.Handler {
+	manage := allowed(
+		handlerMethods{
+			http.MethodGet:    withName(opRead, namespaceStats),
+			http.MethodPost:   withName(opAdmin, createNamespaceHandler),
+			http.MethodDelete: withName(opAdmin, dropNamespaceHandler),
+		})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fragments := strings.SplitN(r.URL.EscapedPath(), "/", 4)
+		name, _ := url.PathUnescape(fragments[2])
+		if !namespaceName.MatchString(name) {
+			httpError(w, fmt.Sprintf("Bad namespace name [%s].", name), http.StatusBadRequest)
+			return
+		}
+		if len(fragments) < 4 {
+			manage.ServeHTTP(w, r)
+			return
+		}
+		ns, ok := lookupNamespace(name)
+		if !ok {
+			httpError(w, fmt.Sprintf("Namespace [%s] not found.", name), http.StatusNotFound)
+			return
+		}
+		r = withNamespace(r, ns)
+		u := *r.URL
+		u.RawPath = "/" + fragments[3]
+		u.Path, _ = url.PathUnescape(u.RawPath)
+		r.URL = &u
+		keys.ServeHTTP(w, r)
+	})
+}
+
 func handler() http.Handler {
-	mux := http.NewServeMux()
-	mux.Handle("/keys", allowed(
+	keys := http.NewServeMux()
+	keys.Handle("/keys", allowed(
 		handlerMethods{
-			http.MethodGet: http.HandlerFunc(list),
+			http.MethodGet:    http.HandlerFunc(list),
+			http.MethodDelete: authorize(opAdmin, http.HandlerFunc(flush)),
 		}))
-	mux.Handle("/keys/", allowed(
+	keys.Handle("/keys/", allowed(
 		handlerMethods{
-			http.MethodGet:    withParams(get),
-			http.MethodPost:   withParams(set),
-			http.MethodDelete: withParams(del),
+			http.MethodGet:  authorize(opRead, withParams(get)),
+			http.MethodHead: authorize(opRead, withParams(exists)),
+			http.MethodPost: actions(
+				handlerActions{
+					"":       authorize(opWrite, withParams(set)),
+					"rename": authorize(opDelete, withParams(rename)),
+					"copy":   authorize(opRead, withParams(duplicate)),
+					"push":   authorize(opWrite, withParams(pushListHandler)),
+					"pop":    authorize(opWrite, withParams(popListHandler)),
+				}),
+			http.MethodPut:    authorize(opWrite, withParams(put)),
+			http.MethodDelete: authorize(opDelete, withParams(del)),
 		}))
 
+	keys.Handle("/locks/", allowed(
+		handlerMethods{
+			http.MethodGet: authorize(opRead, withParams(lockInfo)),
+			http.MethodPost: actions(
+				handlerActions{
+					"":      authorize(opWrite, withParams(acquireLock)),
+					"renew": authorize(opWrite, withParams(renewLock)),
+				}),
+			http.MethodDelete: authorize(opWrite, withParams(releaseLock)),
+		}))
+	keys.Handle("/queues/", allowed(
+		handlerMethods{
+			http.MethodGet: authorize(opRead, withParams(queueStats)),
+			http.MethodPost: actions(
+				handlerActions{
+					"":     authorize(opWrite, withParams(pushMessage)),
+					"pop":  authorize(opWrite, withParams(popMessage)),
+					"ack":  authorize(opWrite, withParams(ackMessage)),
+					"nack": authorize(opWrite, withParams(nackMessage)),
+				}),
+			http.MethodPut:    authorize(opWrite, withParams(configureQueueHandler)),
+			http.MethodDelete: authorize(opDelete, withParams(dropQueueHandler)),
+		}))
+	keys.Handle("/streams/", allowed(
+		handlerMethods{
+			http.MethodGet: actions(
+				handlerActions{
+					"":        authorize(opRead, withParams(rangeHandler)),
+					"info":    authorize(opRead, withParams(streamInfoHandler)),
+					"pending": authorize(opRead, withParams(pendingHandler)),
+				}),
+			http.MethodPost: actions(
+				handlerActions{
+					"":      authorize(opWrite, withParams(appendEntryHandler)),
+					"trim":  authorize(opDelete, withParams(trimHandler)),
+					"group": authorize(opWrite, withParams(createGroupHandler)),
+					"read":  authorize(opWrite, withParams(readGroupHandler)),
+					"ack":   authorize(opWrite, withParams(ackEntriesHandler)),
+					"claim": authorize(opWrite, withParams(claimHandler)),
+				}),
+			http.MethodDelete: actions(
+				handlerActions{
+					"":      authorize(opDelete, withParams(dropStreamHandler)),
+					"group": authorize(opDelete, withParams(dropGroupHandler)),
+				}),
+		}))
+	keys.Handle("/indexes", allowed(
+		handlerMethods{
+			http.MethodGet: authorizeNamespace(opRead, http.HandlerFunc(listIndexes)),
+		}))
+	keys.Handle("/indexes/", allowed(
+		handlerMethods{
+			http.MethodGet:    authorizeNamespace(opRead, withParams(queryHandler)),
+			http.MethodPut:    authorizeNamespace(opAdmin, withParams(createIndexHandler)),
+			http.MethodDelete: authorizeNamespace(opAdmin, withParams(dropIndexHandler)),
+		}))
+	keys.Handle("/eval", allowed(
+		handlerMethods{
+			http.MethodPost: http.HandlerFunc(evalHandler),
+		}))
+	keys.Handle("/scripts", allowed(
+		handlerMethods{
+			http.MethodPost: authorize(opWrite, http.HandlerFunc(loadScriptHandler)),
+		}))
+	keys.Handle("/events", allowed(
+		handlerMethods{
+			http.MethodGet: authorize(opRead, http.HandlerFunc(events)),
+		}))
+
+	admin := http.NewServeMux()
+	admin.Handle("/admin/flush", allowed(
+		handlerMethods{
+			http.MethodPost: http.HandlerFunc(flushAllHandler),
+		}))
+	admin.Handle("/admin/dump", allowed(
+		handlerMethods{
+			http.MethodGet: http.HandlerFunc(dump),
+		}))
+	admin.Handle("/admin/restore", allowed(
+		handlerMethods{
+			http.MethodPost: http.HandlerFunc(restore),
+		}))
+	admin.Handle("/admin/schemas", allowed(
+		handlerMethods{
+			http.MethodGet: http.HandlerFunc(listSchemas),
+		}))
+	admin.Handle("/admin/schemas/", allowed(
+		handlerMethods{
+			http.MethodGet:    http.HandlerFunc(getSchema),
+			http.MethodPut:    http.HandlerFunc(putSchema),
+			http.MethodDelete: http.HandlerFunc(deleteSchema),
+		}))
+	admin.Handle("/admin/scripts", allowed(
+		handlerMethods{
+			http.MethodDelete: http.HandlerFunc(flushScriptsHandler),
+		}))
+	admin.Handle("/admin/bigkeys", allowed(
+		handlerMethods{
+			http.MethodGet: http.HandlerFunc(bigKeysHandler),
+		}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/keys", keys)
+	mux.Handle("/keys/", keys)
+	mux.Handle("/events", keys)
+	mux.Handle("/locks/", keys)
+	mux.Handle("/queues/", keys)
+	mux.Handle("/streams/", keys)
+	mux.Handle("/indexes", keys)
+	mux.Handle("/indexes/", keys)
+	mux.Handle("/eval", keys)
+	mux.Handle("/scripts", keys)
+	mux.Handle("/ns", allowed(
+		handlerMethods{
+			http.MethodGet: http.HandlerFunc(listNamespaces),
+		}))
+	mux.Handle("/ns/", namespaceHandler(keys))
+	mux.Handle("/admin/", authorizeAdmin(admin))
+
 	root := http.NewServeMux()
-	root.Handle("/", clientDisconnectHandler(mux))
+	root.Handle("/", clientDisconnectHandler(rateLimitHandler(authHandler(contentEncodingHandler(mux)))))
 
 	return root
 }
@@ -101,15 +340,107 @@ func handler() http.Handler {
 func init() {
 	flag.StringVar(&listen, "listen", ":8080", "address to listel on")
 	flag.DurationVar(&gracePeriod, "grace-period", 30*time.Second, "graceful shutdown period")
-	flag.Parse()
+	flag.StringVar(&usersFile, "users", "", "users and ACL file, authentication is disabled if empty")
+	flag.StringVar(&rateLimits, "rate-limit", "", "per client operation limits in requests per second with optional burst, e.g. read=100:200,write=10")
+	flag.StringVar(&respListen, "resp-listen", "", "address to serve redis protocol on, disabled if empty")
+	flag.StringVar(&memcacheListen, "memcache-listen", "", "address to serve memcached text protocol on, disabled if empty")
+	flag.StringVar(&grpcListen, "grpc-listen", "", "address to serve gRPC api on, disabled if empty")
+	flag.DurationVar(&scriptTimeout, "script-timeout", time.Second, "maximal execution time of scripts")
+	flag.IntVar(&maxKeyLength, "max-key-length", defaultMaxKeyLength, "maximal key length in bytes, unlimited if zero")
+	flag.Int64Var(&maxValueSize, "max-value-size", defaultMaxValueSize, "maximal value size in bytes, unlimited if zero")
+	flag.IntVar(&maxDepth, "max-depth", defaultMaxDepth, "maximal nesting depth of json values, unlimited if zero")
+	flag.IntVar(&shardCount, "shards", defaultShards, "number of independently locked shards of every namespace")
+	flag.Int64Var(&compressThreshold, "compress-threshold", 0, "compress stored values larger than threshold in bytes, disabled if zero")
+	flag.IntVar(&compressLevel, "compress-level", gzip.DefaultCompression, "gzip compression level from 1 to 9, -1 is default level")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file, serve plain HTTP if empty")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "CA bundle to verify client certificates, client certificates are not required if empty")
 }
 
 func main() {
-	stop := make(chan os.Signal)
+	flag.Parse()
+	if shardCount <= 0 {
+		log.Fatalf("bad number of shards [%d]", shardCount)
+	}
+	// package level default namespace is replaced to use parsed number of shards
+	namespaces[defaultNamespace] = newNamespace(defaultNamespace, 0)
+	if compressLevel < gzip.DefaultCompression || compressLevel > gzip.BestCompression {
+		log.Fatalf("bad compression level [%d]", compressLevel)
+	}
+	if usersFile != "" {
+		var err error
+		users, err = loadUsers(usersFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Loaded [%d] users.\n", len(users))
+	}
+	if rateLimits != "" {
+		var err error
+		limiters, err = parseRateLimits(rateLimits)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGKILL)
 
 	server := &http.Server{Addr: listen, Handler: handler()}
-	go server.ListenAndServe()
+	var grpcOpts []grpc.ServerOption
+	if tlsCert != "" {
+		certs := &certificates{certFile: tlsCert, keyFile: tlsKey, clientCAFile: tlsClientCA}
+		if err := certs.load(); err != nil {
+			log.Fatal(err)
+		}
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := certs.load(); err != nil {
+					log.Printf("Reload certificates: %v\n", err)
+					continue
+				}
+				log.Println("Certificates reloaded.")
+			}
+		}()
+		server.TLSConfig = certs.tlsConfig()
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(certs.tlsConfig())))
+		go server.ListenAndServeTLS("", "")
+	} else {
+		if tlsClientCA != "" {
+			log.Fatal("client CA requires TLS certificate and key")
+		}
+		go server.ListenAndServe()
+	}
+
+	if respListen != "" {
+		l, err := net.Listen("tcp", respListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+		go serveRESP(l)
+	}
+
+	if memcacheListen != "" {
+		l, err := net.Listen("tcp", memcacheListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+		go serveMemcache(l)
+	}
+
+	if grpcListen != "" {
+		l, err := net.Listen("tcp", grpcListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		gs := newGRPCServer(grpcOpts...)
+		defer gs.GracefulStop()
+		go gs.Serve(l)
+	}
 
 	<-stop
 
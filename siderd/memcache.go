@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxMemcacheKey  = 250
+	maxMemcacheItem = 1 << 20
+	maxMemcacheLine = 64 << 10
+	// exptime greater than 30 days is absolute unix time.
+	maxMemcacheRelative = 30 * 24 * 60 * 60
+)
+
+var (
+	memcacheListen string
+
+	errMemcacheLineTooLong = errors.New("line too long")
+)
+
+type memcacheCommand struct {
+	// args is minimal number of arguments including command name.
+	args int
+	op   string
+	fn   func(c *memcacheConn, args []string)
+}
+
+var memcacheCommands map[string]memcacheCommand
+
+func init() {
+	memcacheCommands = map[string]memcacheCommand{
+		"get":       {2, opRead, memcacheGet},
+		"gets":      {2, opRead, memcacheGet},
+		"set":       {5, opWrite, memcacheStore},
+		"add":       {5, opWrite, memcacheStore},
+		"replace":   {5, opWrite, memcacheStore},
+		"cas":       {6, opWrite, memcacheStore},
+		"delete":    {2, opDelete, memcacheDelete},
+		"incr":      {3, opWrite, memcacheIncr},
+		"decr":      {3, opWrite, memcacheIncr},
+		"touch":     {3, opWrite, memcacheTouch},
+		"flush_all": {1, opAdmin, memcacheFlushAll},
+		"version":   {1, "", memcacheVersion},
+		"quit":      {1, "", memcacheQuit},
+	}
+}
+
+type memcacheConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	ns   *namespace
+	user *user
+	quit bool
+}
+
+// serveMemcache serves memcached text protocol in default namespace.
+func serveMemcache(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		ns, _ := lookupNamespace(defaultNamespace)
+		c := &memcacheConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), ns: ns}
+		go c.serve()
+	}
+}
+
+func (c *memcacheConn) serve() {
+	defer c.conn.Close()
+	for !c.quit {
+		line, err := c.readLine()
+		if err == errMemcacheLineTooLong {
+			c.reply("CLIENT_ERROR line too long")
+			break
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Memcache: [%s]: %v\n", c.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			c.reply("ERROR")
+		} else {
+			c.dispatch(args)
+		}
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.w.Flush()
+}
+
+// readLine reads line of at most maxMemcacheLine bytes.
+func (c *memcacheConn) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := c.r.ReadSlice('\n')
+		if len(line)+len(b) > maxMemcacheLine {
+			return "", errMemcacheLineTooLong
+		}
+		line = append(line, b...)
+		switch err {
+		case nil:
+			return string(line), nil
+		case bufio.ErrBufferFull:
+		default:
+			return "", err
+		}
+	}
+}
+
+func (c *memcacheConn) dispatch(args []string) {
+	cmd, ok := memcacheCommands[args[0]]
+	if !ok || len(args) < cmd.args {
+		c.reply("ERROR")
+		return
+	}
+	if cmd.op == "" {
+		cmd.fn(c, args)
+		return
+	}
+	if users != nil && c.user == nil {
+		if args[0] == "set" {
+			memcacheAuth(c, args)
+			return
+		}
+		c.reply("CLIENT_ERROR unauthenticated")
+		return
+	}
+	if l, ok := limiters[cmd.op]; ok {
+		if ok, _ := l.take(c.identity(), time.Now()); !ok {
+			c.discard(args)
+			c.reply("SERVER_ERROR rate limit exceeded")
+			return
+		}
+	}
+	keys := args[1:2]
+	switch args[0] {
+	case "get", "gets":
+		keys = args[1:]
+	case "flush_all":
+		keys = nil
+	}
+	for _, key := range keys {
+		if len(key) > maxMemcacheKey {
+			c.discard(args)
+			c.reply("CLIENT_ERROR bad command line format")
+			return
+		}
+		if users != nil && !c.user.can(cmd.op, c.ns.name, key) {
+			c.discard(args)
+			c.reply("CLIENT_ERROR permission denied")
+			return
+		}
+	}
+	cmd.fn(c, args)
+}
+
+func (c *memcacheConn) identity() string {
+	if c.user != nil {
+		return "token:" + c.user.Token
+	}
+	host, _, err := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if err != nil {
+		return "addr:" + c.conn.RemoteAddr().String()
+	}
+	return "addr:" + host
+}
+
+func (c *memcacheConn) reply(s string) {
+	fmt.Fprintf(c.w, "%s\r\n", s)
+}
+
+// noreply reports whether last argument of storage command asks to
+// suppress the reply.
+func noreply(args []string, n int) bool {
+	return len(args) > n && args[n] == "noreply"
+}
+
+// discard skips data block of rejected storage command so that it is
+// not interpreted as the next command.
+func (c *memcacheConn) discard(args []string) {
+	switch args[0] {
+	case "set", "add", "replace", "cas":
+		if size, err := strconv.Atoi(args[4]); err == nil && size >= 0 {
+			c.r.Discard(size + 2)
+		}
+	}
+}
+
+// readData reads data block of given size followed by \r\n, the rest
+// of malformed block is skipped up to the end of line.
+func (c *memcacheConn) readData(size int) (string, bool) {
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		c.quit = true
+		return "", false
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		if buf[size+1] != '\n' {
+			if _, err := c.readLine(); err != nil {
+				c.quit = true
+			}
+		}
+		c.reply("CLIENT_ERROR bad data chunk")
+		return "", false
+	}
+	return string(buf[:size]), true
+}
+
+// memcacheTTL converts exptime to time to live, zero means no expiration
+// and negative means item is expired immediately.
+func memcacheTTL(exptime int64) time.Duration {
+	switch {
+	case exptime > maxMemcacheRelative:
+		ttl := time.Until(time.Unix(exptime, 0))
+		if ttl <= 0 {
+			return -1
+		}
+		return ttl
+	case exptime < 0:
+		return -1
+	default:
+		return time.Duration(exptime) * time.Second
+	}
+}
+
+// memcacheAuth authenticates connection with memcached text protocol
+// convention: set command with "name token" as data.
+func memcacheAuth(c *memcacheConn, args []string) {
+	size, err := strconv.Atoi(args[4])
+	if err != nil || size < 0 || size > maxMemcacheItem {
+		c.reply("CLIENT_ERROR bad command line format")
+		c.quit = true
+		return
+	}
+	data, ok := c.readData(size)
+	if !ok {
+		return
+	}
+	creds := strings.Fields(data)
+	if len(creds) == 2 {
+		if u, ok := users[creds[1]]; ok && u.Name == creds[0] {
+			c.user = u
+			c.reply("STORED")
+			return
+		}
+	}
+	c.reply("CLIENT_ERROR authentication failure")
+}
+
+func memcacheGet(c *memcacheConn, args []string) {
+	for _, key := range args[1:] {
+		n, ok := c.ns.get(key)
+		if !ok {
+			continue
+		}
+		value := respValue(n.value())
+		if args[0] == "gets" {
+			fmt.Fprintf(c.w, "VALUE %s %d %d %d\r\n%s\r\n", key, n.flags, len(value), n.cas, value)
+			continue
+		}
+		fmt.Fprintf(c.w, "VALUE %s %d %d\r\n%s\r\n", key, n.flags, len(value), value)
+	}
+	c.reply("END")
+}
+
+// memcacheStore implements set, add, replace and cas commands:
+// <command> <key> <flags> <exptime> <bytes> [<cas>] [noreply].
+func memcacheStore(c *memcacheConn, args []string) {
+	key := args[1]
+	flags, err1 := strconv.ParseUint(args[2], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[3], 10, 64)
+	size, err3 := strconv.Atoi(args[4])
+	if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+		c.reply("CLIENT_ERROR bad command line format")
+		c.quit = true
+		return
+	}
+	var cas uint64
+	reply := !noreply(args, 5)
+	if args[0] == "cas" {
+		var err error
+		cas, err = strconv.ParseUint(args[5], 10, 64)
+		if err != nil {
+			c.discard(args)
+			c.reply("CLIENT_ERROR bad command line format")
+			return
+		}
+		reply = !noreply(args, 6)
+	}
+	if size > maxMemcacheItem {
+		c.discard(args)
+		c.reply("SERVER_ERROR object too large for cache")
+		return
+	}
+	value, ok := c.readData(size)
+	if !ok {
+		return
+	}
+	mode := setAlways
+	switch args[0] {
+	case "add":
+		mode = setNew
+	case "replace":
+		mode = setExisting
+	}
+	ttl := memcacheTTL(exptime)
+	n := &node{data: value, size: int64(size), flags: uint32(flags)}
+	expired := ttl < 0
+	if expired {
+		ttl = 0
+	}
+	err := c.ns.store(key, n, ttl, mode, cas)
+	if err == nil && expired {
+		// memcached reports already expired item stored and removes
+		// previous value.
+		c.ns.del(key)
+	}
+	if !reply {
+		return
+	}
+	switch err {
+	case nil:
+		c.reply("STORED")
+	case errExists:
+		c.reply("NOT_STORED")
+	case errNotFound:
+		if cas != 0 {
+			c.reply("NOT_FOUND")
+			return
+		}
+		c.reply("NOT_STORED")
+	case errModified:
+		c.reply("EXISTS")
+	case errMemoryLimit:
+		c.reply("SERVER_ERROR out of memory storing object")
+	default:
+		c.reply("SERVER_ERROR " + err.Error())
+	}
+}
+
+func memcacheDelete(c *memcacheConn, args []string) {
+	ok := c.ns.del(args[1])
+	if noreply(args, 2) {
+		return
+	}
+	if ok {
+		c.reply("DELETED")
+		return
+	}
+	c.reply("NOT_FOUND")
+}
+
+// memcacheIncr implements incr and decr on unsigned 64 bit integers
+// stored as decimal strings or json numbers, incr wraps around and decr
+// stops at zero as memcached does.
+func memcacheIncr(c *memcacheConn, args []string) {
+	delta, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid numeric delta argument")
+		return
+	}
+	var v uint64
+	_, err = c.ns.modify(args[1], func(data interface{}) (interface{}, int64, error) {
+		switch d := data.(type) {
+		case string:
+			var err error
+			v, err = strconv.ParseUint(d, 10, 64)
+			if err != nil {
+				return nil, 0, errNotInteger
+			}
+		case float64:
+			if d < 0 || d != math.Trunc(d) || d > maxSafeInteger {
+				return nil, 0, errNotInteger
+			}
+			v = uint64(d)
+		default:
+			return nil, 0, errNotInteger
+		}
+		switch {
+		case args[0] == "incr":
+			v += delta
+		case delta > v:
+			v = 0
+		default:
+			v -= delta
+		}
+		repr := strconv.FormatUint(v, 10)
+		if _, ok := data.(float64); ok {
+			if v > maxSafeInteger {
+				return nil, 0, errOverflow
+			}
+			return float64(v), int64(len(repr)), nil
+		}
+		return repr, int64(len(repr)), nil
+	})
+	if noreply(args, 3) {
+		return
+	}
+	switch err {
+	case nil:
+		c.reply(strconv.FormatUint(v, 10))
+	case errNotFound:
+		c.reply("NOT_FOUND")
+	case errNotInteger:
+		c.reply("CLIENT_ERROR cannot increment or decrement non-numeric value")
+	case errOverflow:
+		c.reply("CLIENT_ERROR increment or decrement would overflow")
+	case errMemoryLimit:
+		c.reply("SERVER_ERROR out of memory")
+	default:
+		c.reply("SERVER_ERROR " + err.Error())
+	}
+}
+
+func memcacheTouch(c *memcacheConn, args []string) {
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid exptime argument")
+		return
+	}
+	var ok bool
+	if ttl := memcacheTTL(exptime); ttl < 0 {
+		ok = c.ns.del(args[1])
+	} else {
+		ok = c.ns.expireKey(args[1], ttl)
+	}
+	if noreply(args, 3) {
+		return
+	}
+	if ok {
+		c.reply("TOUCHED")
+		return
+	}
+	c.reply("NOT_FOUND")
+}
+
+func memcacheFlushAll(c *memcacheConn, args []string) {
+	c.ns.flush()
+	if !noreply(args, len(args)-1) {
+		c.reply("OK")
+	}
+}
+
+func memcacheVersion(c *memcacheConn, args []string) {
+	c.reply("VERSION 1.6.0-sider")
+}
+
+func memcacheQuit(c *memcacheConn, args []string) {
+	c.quit = true
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+type memcacheClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func memcacheServer(t *testing.T) (net.Listener, *memcacheClient) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go serveMemcache(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return l, &memcacheClient{t, conn, bufio.NewReader(conn)}
+}
+
+func (c *memcacheClient) readLine() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read reply: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// do sends command lines and returns reply, retrieval reply lines are
+// joined with spaces.
+func (c *memcacheClient) do(lines ...string) string {
+	for _, line := range lines {
+		fmt.Fprintf(c.conn, "%s\r\n", line)
+	}
+	line := c.readLine()
+	if !strings.HasPrefix(line, "VALUE ") && line != "END" {
+		return line
+	}
+	reply := []string{}
+	for ; line != "END"; line = c.readLine() {
+		reply = append(reply, line)
+	}
+	return strings.Join(append(reply, line), " ")
+}
+
+func (c *memcacheClient) expect(reply string, lines ...string) {
+	if r := c.do(lines...); r != reply {
+		c.t.Fatalf("%v: unexpected reply: %s, expected: %s", lines, r, reply)
+	}
+}
+
+func TestMemcache(t *testing.T) {
+	l, c := memcacheServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+	defer cleanup("mc:key")
+	defer cleanup("mc:counter")
+
+	c.expect("END", "get mc:key")
+	c.expect("STORED", "set mc:key 5 0 5", "value")
+	c.expect("VALUE mc:key 5 5 value END", "get mc:key mc:missing")
+	c.expect("NOT_STORED", "add mc:key 0 0 5", "other")
+	c.expect("NOT_STORED", "replace mc:missing 0 0 5", "other")
+	c.expect("STORED", "replace mc:key 7 100 5", "other")
+	if ttl, _ := defaultNS().ttl("mc:key"); ttl <= 0 {
+		t.Fatalf("exptime is not set: %v", ttl)
+	}
+
+	n, _ := defaultNS().peek("mc:key")
+	cas := n.cas
+	c.expect(fmt.Sprintf("VALUE mc:key 7 5 %d other END", cas), "gets mc:key")
+	c.expect("EXISTS", fmt.Sprintf("cas mc:key 0 0 3 %d", cas+1), "new")
+	c.expect("STORED", fmt.Sprintf("cas mc:key 0 0 3 %d", cas), "new")
+	c.expect("EXISTS", fmt.Sprintf("cas mc:key 0 0 3 %d", cas), "old")
+	c.expect("NOT_FOUND", "cas mc:missing 0 0 3 1", "new")
+	c.expect("TOUCHED", "touch mc:key 0")
+	if ttl, _ := defaultNS().ttl("mc:key"); ttl != 0 {
+		t.Fatalf("exptime is not reset: %v", ttl)
+	}
+	n, _ = defaultNS().peek("mc:key")
+	if n.cas == cas || n.data != "new" {
+		t.Fatalf("unexpected node: %v", n)
+	}
+
+	c.expect("NOT_FOUND", "incr mc:counter 1")
+	c.expect("STORED", "set mc:counter 0 0 2", "10")
+	c.expect("15", "incr mc:counter 5")
+	c.expect("0", "decr mc:counter 20")
+	c.expect("CLIENT_ERROR cannot increment or decrement non-numeric value", "incr mc:key 1")
+
+	c.expect("STORED", "set mc:key 0 -1 3", "new")
+	c.expect("END", "get mc:key")
+	c.expect("DELETED", "delete mc:counter")
+	c.expect("NOT_FOUND", "delete mc:counter")
+	c.expect("CLIENT_ERROR bad data chunk", "set mc:key 0 0 1", "long")
+	c.expect("ERROR", "unknown")
+	c.expect("ERROR", "get")
+	c.expect("STORED", "set mc:key 0 0 1 noreply", "a", "set mc:key 0 0 1", "b")
+}
+
+func TestMemcacheValue(t *testing.T) {
+	l, c := memcacheServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+
+	ns := defaultNS()
+	ns.set("mc:json", map[string]interface{}{"a": 1.0}, 0, 0, setNew)
+	ns.set("mc:number", 5.0, 0, 0, setNew)
+	defer cleanup("mc:json")
+	defer cleanup("mc:number")
+
+	c.expect(`VALUE mc:json 0 7 {"a":1} END`, "get mc:json")
+	c.expect("6", "incr mc:number 1")
+	if n, _ := ns.peek("mc:number"); n.data != 6.0 {
+		t.Fatalf("json number type is not preserved: %v", n.data)
+	}
+}
+
+func TestMemcacheLineTooLong(t *testing.T) {
+	defer withUsers(t, testUsers)()
+	l, c := memcacheServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+
+	c.conn.Write([]byte(strings.Repeat("a", maxMemcacheLine+4096)))
+	if line := c.readLine(); line != "CLIENT_ERROR line too long" {
+		t.Fatalf("unexpected reply: %s", line)
+	}
+	if _, err := c.r.ReadString('\n'); err == nil {
+		t.Fatal("connection is not closed")
+	}
+}
+
+func TestMemcacheAuth(t *testing.T) {
+	defer withUsers(t, testUsers)()
+	l, c := memcacheServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+
+	c.expect("CLIENT_ERROR unauthenticated", "get app:key")
+	c.expect("CLIENT_ERROR authentication failure", "set auth 0 0 12", "reader admin")
+	c.expect("STORED", "set auth 0 0 13", "reader reader")
+	c.expect("END", "get app:key")
+	c.expect("CLIENT_ERROR permission denied", "get other")
+	c.expect("CLIENT_ERROR permission denied", "set app:key 0 0 5", "value")
+	c.expect("VERSION 1.6.0-sider", "version")
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultNamespace = "default"
+	maxSafeInteger   = 1<<53 - 1
+)
+
+var (
+	errExists      = errors.New("key already exists")
+	errNotFound    = errors.New("key not found")
+	errMemoryLimit = errors.New("namespace memory limit exceeded")
+	errNotInteger  = errors.New("value is not an integer")
+	errOverflow    = errors.New("increment or decrement would overflow")
+	errModified    = errors.New("key was modified")
+
+	namespaceName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
+type node struct {
+	done    chan struct{}
+	expires time.Time
+	size    int64
+	data    interface{}
+	// flags are opaque client flags of memcached protocol.
+	flags uint32
+	// cas is unique version of the value, changed on every update.
+	cas uint64
+}
+
+// remaining returns time to live of the node, zero means node does not
+// expire.
+func (n *node) remaining() time.Duration {
+	if n.done == nil {
+		return 0
+	}
+	ttl := time.Until(n.expires)
+	if ttl <= 0 {
+		return time.Nanosecond
+	}
+	return ttl
+}
+
+type counters struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Sets    uint64 `json:"sets"`
+	Dels    uint64 `json:"dels"`
+	Expired uint64 `json:"expired"`
+}
+
+type stats struct {
+	Name      string `json:"name"`
+	Keys      int    `json:"keys"`
+	Memory    int64  `json:"memory"`
+	MaxMemory int64  `json:"max_memory,omitempty"`
+	// Compressed is number of compressed values, CompressionRatio is
+	// their original size divided by compressed size.
+	Compressed       int     `json:"compressed,omitempty"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+	counters
+}
+
+type namespace struct {
+	name string
+	// maxMemory is accessed atomically, restore changes it.
+	maxMemory int64
+	counters  counters
+
+	shards []*shard
+	memory int64
+	// compressed counts compressed values with their compressed and
+	// original sizes.
+	compressed     int64
+	compressedSize int64
+	originalSize   int64
+
+	// indexes are changed with all shards and index lock held so that
+	// writers holding key shard lock read them without index lock.
+	indexLock sync.Mutex
+	indexes   map[string]*index
+
+	leaseLock sync.Mutex
+	leases    map[string]*lease
+
+	queueLock sync.Mutex
+	queues    map[string]*queue
+	// queuesChanged is closed when queue is created.
+	queuesChanged chan struct{}
+
+	streamLock sync.Mutex
+	streams    map[string]*stream
+	// streamsChanged is closed when stream is created.
+	streamsChanged chan struct{}
+}
+
+type namespaceKey struct{}
+
+type setMode int
+
+const (
+	// setNew stores value only if key does not exist.
+	setNew setMode = iota
+	// setAlways stores value replacing existing one.
+	setAlways
+	// setExisting replaces value only if key exists.
+	setExisting
+)
+
+var (
+	namespaces = map[string]*namespace{defaultNamespace: newNamespace(defaultNamespace, 0)}
+	nsLock     sync.RWMutex
+
+	casCounter uint64
+)
+
+func newNamespace(name string, maxMemory int64) *namespace {
+	return &namespace{name: name, maxMemory: maxMemory, shards: newShards(shardCount), indexes: make(map[string]*index), leases: make(map[string]*lease), queues: make(map[string]*queue), queuesChanged: make(chan struct{}), streams: make(map[string]*stream), streamsChanged: make(chan struct{})}
+}
+
+func lookupNamespace(name string) (*namespace, bool) {
+	nsLock.RLock()
+	defer nsLock.RUnlock()
+	ns, ok := namespaces[name]
+	return ns, ok
+}
+
+func createNamespace(name string, maxMemory int64) (*namespace, error) {
+	nsLock.Lock()
+	defer nsLock.Unlock()
+	if _, ok := namespaces[name]; ok {
+		return nil, errExists
+	}
+	ns := newNamespace(name, maxMemory)
+	namespaces[name] = ns
+	log.Printf("Create namespace: [%s].\n", name)
+	return ns, nil
+}
+
+func dropNamespace(name string) bool {
+	nsLock.Lock()
+	ns, ok := namespaces[name]
+	delete(namespaces, name)
+	nsLock.Unlock()
+	if !ok {
+		return false
+	}
+	ns.flush()
+	log.Printf("Drop namespace: [%s].\n", name)
+	return true
+}
+
+func namespaceNames() []string {
+	nsLock.RLock()
+	defer nsLock.RUnlock()
+	names := []string{}
+	for name := range namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func namespaceOf(r *http.Request) *namespace {
+	if ns, ok := r.Context().Value(namespaceKey{}).(*namespace); ok {
+		return ns
+	}
+	ns, _ := lookupNamespace(defaultNamespace)
+	return ns
+}
+
+func withNamespace(r *http.Request, ns *namespace) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), namespaceKey{}, ns))
+}
+
+func (ns *namespace) get(key string) (*node, bool) {
+	s := ns.shard(key)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	n, ok := s.storage[key]
+	if ok {
+		atomic.AddUint64(&ns.counters.Hits, 1)
+	} else {
+		atomic.AddUint64(&ns.counters.Misses, 1)
+	}
+	return n, ok
+}
+
+// peek returns node without updating hit and miss counters.
+func (ns *namespace) peek(key string) (*node, bool) {
+	s := ns.shard(key)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	n, ok := s.storage[key]
+	return n, ok
+}
+
+func (ns *namespace) set(key string, data interface{}, size int64, ttl time.Duration, mode setMode) error {
+	return ns.store(key, &node{data: data, size: size}, ttl, mode, 0)
+}
+
+// store is like set but takes node with client flags, non zero cas
+// replaces value only if it was not modified since cas was obtained.
+func (ns *namespace) store(key string, n *node, ttl time.Duration, mode setMode, cas uint64) error {
+	s := ns.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	old, ok := s.storage[key]
+	switch {
+	case ok && mode == setNew:
+		return errExists
+	case !ok && (mode == setExisting || cas != 0):
+		return errNotFound
+	case cas != 0 && old.cas != cas:
+		return errModified
+	}
+	if err := checkLimits(key, n.size); err != nil {
+		return err
+	}
+	if err := validate(ns.name, key, n.data); err != nil {
+		return err
+	}
+	n.size += int64(len(key))
+	delta := n.size
+	if ok {
+		delta -= old.size
+	}
+	if !ns.reserveMemory(delta) {
+		return errMemoryLimit
+	}
+	defer ns.releaseMemory(delta)
+	ns.remove(key)
+	ns.insert(key, n, ttl)
+	atomic.AddUint64(&ns.counters.Sets, 1)
+	ns.notify(eventSet, key)
+	return nil
+}
+
+// expireKey sets new expiration timeout of the key, zero ttl makes key
+// persistent.
+func (ns *namespace) expireKey(key string, ttl time.Duration) bool {
+	s := ns.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n, ok := s.storage[key]
+	if !ok {
+		return false
+	}
+	ns.remove(key)
+	ns.insert(key, &node{data: n.data, size: n.size, flags: n.flags, cas: n.cas}, ttl)
+	return true
+}
+
+// ttl returns remaining time to live of the key, zero means key does
+// not expire.
+func (ns *namespace) ttl(key string) (time.Duration, bool) {
+	n, ok := ns.peek(key)
+	if !ok {
+		return 0, false
+	}
+	return n.remaining(), true
+}
+
+// incr atomically adds delta to integer value stored either as json
+// number or as decimal string, missing key is treated as zero.
+func (ns *namespace) incr(key string, delta int64) (int64, error) {
+	s := ns.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var v int64
+	var str bool
+	n, ok := s.storage[key]
+	if ok {
+		switch d := n.value().(type) {
+		case string:
+			var err error
+			v, err = strconv.ParseInt(d, 10, 64)
+			if err != nil {
+				return 0, errNotInteger
+			}
+			str = true
+		case float64:
+			if d != math.Trunc(d) || math.Abs(d) > maxSafeInteger {
+				return 0, errNotInteger
+			}
+			v = int64(d)
+		default:
+			return 0, errNotInteger
+		}
+	}
+	if (delta > 0 && v > math.MaxInt64-delta) || (delta < 0 && v < math.MinInt64-delta) {
+		return 0, errOverflow
+	}
+	v += delta
+	repr := strconv.FormatInt(v, 10)
+	c := &node{data: repr, size: int64(len(key) + len(repr))}
+	if ok {
+		c.flags = n.flags
+	}
+	if !str {
+		if math.Abs(float64(v)) > maxSafeInteger {
+			return 0, errOverflow
+		}
+		c.data = float64(v)
+	}
+	if err := validate(ns.name, key, c.data); err != nil {
+		return 0, err
+	}
+	growth := c.size
+	var ttl time.Duration
+	if ok {
+		growth -= n.size
+		ttl = n.remaining()
+	}
+	if !ns.reserveMemory(growth) {
+		return 0, errMemoryLimit
+	}
+	defer ns.releaseMemory(growth)
+	ns.remove(key)
+	ns.insert(key, c, ttl)
+	atomic.AddUint64(&ns.counters.Sets, 1)
+	ns.notify(eventSet, key)
+	return v, nil
+}
+
+// modify replaces value of existing key with the one returned by fn
+// keeping time to live and flags.
+func (ns *namespace) modify(key string, fn func(data interface{}) (interface{}, int64, error)) (*node, error) {
+	s := ns.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return ns.update(key, fn)
+}
+
+// update is like modify but must be called with write lock of the key
+// shard held.
+func (ns *namespace) update(key string, fn func(data interface{}) (interface{}, int64, error)) (*node, error) {
+	n, ok := ns.find(key)
+	if !ok {
+		return nil, errNotFound
+	}
+	data, size, err := fn(n.value())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimits(key, size); err != nil {
+		return nil, err
+	}
+	if err := validate(ns.name, key, data); err != nil {
+		return nil, err
+	}
+	c := &node{data: data, size: int64(len(key)) + size, flags: n.flags}
+	delta := c.size - n.size
+	if !ns.reserveMemory(delta) {
+		return nil, errMemoryLimit
+	}
+	defer ns.releaseMemory(delta)
+	ttl := n.remaining()
+	ns.remove(key)
+	ns.insert(key, c, ttl)
+	atomic.AddUint64(&ns.counters.Sets, 1)
+	ns.notify(eventSet, key)
+	return c, nil
+}
+
+func (ns *namespace) del(key string) bool {
+	s := ns.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := ns.remove(key)
+	if ok {
+		atomic.AddUint64(&ns.counters.Dels, 1)
+		ns.notify(eventDel, key)
+	}
+	return ok
+}
+
+// copy duplicates value of src key to dst key removing src if move
+// is set. Positive ttl sets new expiration, zero keeps remaining time to
+// live of src and negative ttl makes dst persistent.
+func (ns *namespace) copy(src string, dst string, ttl time.Duration, move bool) error {
+	unlock := ns.lockKeys(src, dst)
+	defer unlock()
+	n, ok := ns.find(src)
+	if !ok {
+		return errNotFound
+	}
+	if _, ok := ns.find(dst); ok {
+		return errExists
+	}
+	if err := checkLimits(dst, n.size-int64(len(src))); err != nil {
+		return err
+	}
+	if err := validate(ns.name, dst, n.value()); err != nil {
+		return err
+	}
+	c := &node{data: n.data, size: n.size - int64(len(src)) + int64(len(dst)), flags: n.flags}
+	var delta int64
+	if !move {
+		delta = c.size
+	}
+	if !ns.reserveMemory(delta) {
+		return errMemoryLimit
+	}
+	defer ns.releaseMemory(delta)
+	switch {
+	case ttl < 0:
+		ttl = 0
+	case ttl == 0:
+		ttl = n.remaining()
+	}
+	if move {
+		ns.remove(src)
+		ns.notify(eventDel, src)
+	}
+	ns.insert(dst, c, ttl)
+	atomic.AddUint64(&ns.counters.Sets, 1)
+	ns.notify(eventSet, dst)
+	return nil
+}
+
+// keys returns keys matching filter locking one shard at a time, so
+// the list is not a snapshot of the whole namespace.
+func (ns *namespace) keys(ctx context.Context, filter func(string) bool) ([]string, error) {
+	list := []string{}
+	for _, s := range ns.shards {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		s.lock.RLock()
+		for k := range s.storage {
+			if filter(k) {
+				list = append(list, k)
+			}
+		}
+		s.lock.RUnlock()
+	}
+	return list, nil
+}
+
+// flush deletes all keys, queues, streams and locks of the namespace.
+func (ns *namespace) flush() {
+	unlock := ns.lockAll()
+	for _, s := range ns.shards {
+		for k := range s.storage {
+			ns.remove(k)
+			ns.notify(eventDel, k)
+		}
+	}
+	unlock()
+	ns.flushQueues()
+	ns.flushStreams()
+	ns.flushLeases()
+	log.Printf("Flush: [%s].\n", ns.name)
+}
+
+func flushAll() {
+	nsLock.RLock()
+	defer nsLock.RUnlock()
+	for _, ns := range namespaces {
+		ns.flush()
+	}
+}
+
+func (ns *namespace) stats() stats {
+	keys := 0
+	for _, s := range ns.shards {
+		s.lock.RLock()
+		keys += len(s.storage)
+		s.lock.RUnlock()
+	}
+	var ratio float64
+	if size := atomic.LoadInt64(&ns.compressedSize); size > 0 {
+		ratio = float64(atomic.LoadInt64(&ns.originalSize)) / float64(size)
+	}
+	return stats{
+		Name:             ns.name,
+		Keys:             keys,
+		Memory:           atomic.LoadInt64(&ns.memory),
+		MaxMemory:        atomic.LoadInt64(&ns.maxMemory),
+		Compressed:       int(atomic.LoadInt64(&ns.compressed)),
+		CompressionRatio: ratio,
+		counters: counters{
+			Hits:    atomic.LoadUint64(&ns.counters.Hits),
+			Misses:  atomic.LoadUint64(&ns.counters.Misses),
+			Sets:    atomic.LoadUint64(&ns.counters.Sets),
+			Dels:    atomic.LoadUint64(&ns.counters.Dels),
+			Expired: atomic.LoadUint64(&ns.counters.Expired),
+		},
+	}
+}
+
+// notify wakes up waiters of the key and publishes change event, must
+// be called with write lock of the key shard held.
+func (ns *namespace) notify(t string, key string) {
+	s := ns.shard(key)
+	if w, ok := s.waiters[key]; ok {
+		close(w.ch)
+		delete(s.waiters, key)
+	}
+	hub.publish(event{Type: t, Namespace: ns.name, Key: key})
+}
+
+// insert stores node, updates indexes and starts expiration timer,
+// node without cas gets a new one. Must be called with write lock of
+// the key shard held.
+func (ns *namespace) insert(key string, n *node, ttl time.Duration) {
+	if n.cas == 0 {
+		n.cas = atomic.AddUint64(&casCounter, 1)
+	}
+	if ttl != 0 {
+		log.Printf("Key: [%s] expires in: [%v].\n", key, ttl)
+		n.done = make(chan struct{})
+		n.expires = time.Now().Add(ttl)
+		go ns.expire(key, n, ttl)
+	}
+	data := n.data
+	compress(key, n)
+	if c, ok := n.data.(*compressed); ok {
+		atomic.AddInt64(&ns.compressed, 1)
+		atomic.AddInt64(&ns.compressedSize, int64(len(c.data)))
+		atomic.AddInt64(&ns.originalSize, c.size)
+	}
+	ns.shard(key).storage[key] = n
+	atomic.AddInt64(&ns.memory, n.size)
+	if len(ns.indexes) == 0 {
+		return
+	}
+	if _, ok := data.(*compressed); ok {
+		data = n.value()
+	}
+	for _, idx := range ns.indexes {
+		idx.lock.Lock()
+		idx.add(key, data)
+		idx.lock.Unlock()
+	}
+}
+
+// remove deletes node from storage and indexes and stops expiration
+// timer, must be called with write lock of the key shard held.
+func (ns *namespace) remove(key string) (*node, bool) {
+	s := ns.shard(key)
+	n, ok := s.storage[key]
+	if !ok {
+		return nil, false
+	}
+	if n.done != nil {
+		close(n.done)
+	}
+	delete(s.storage, key)
+	atomic.AddInt64(&ns.memory, -n.size)
+	if c, ok := n.data.(*compressed); ok {
+		atomic.AddInt64(&ns.compressed, -1)
+		atomic.AddInt64(&ns.compressedSize, -int64(len(c.data)))
+		atomic.AddInt64(&ns.originalSize, -c.size)
+	}
+	if len(ns.indexes) == 0 {
+		return n, true
+	}
+	for _, idx := range ns.indexes {
+		idx.lock.Lock()
+		idx.remove(key)
+		idx.lock.Unlock()
+	}
+	return n, true
+}
+
+func (ns *namespace) expire(key string, n *node, ttl time.Duration) {
+	select {
+	case <-time.After(ttl):
+		s := ns.shard(key)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.storage[key] != n {
+			return
+		}
+		ns.remove(key)
+		atomic.AddUint64(&ns.counters.Expired, 1)
+		ns.notify(eventExpire, key)
+		log.Printf("Expired: [%s].\n", key)
+	case <-n.done:
+		log.Printf("Drop timer: [%s].\n", key)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	name := uuid.New()
+	err := cl.CreateNamespace(context.Background(), name, 0)
+	if err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer cl.DropNamespace(context.Background(), name)
+
+	err = cl.CreateNamespace(context.Background(), name, 0)
+	if err == nil {
+		t.Fatalf("duplicate namespace created")
+	}
+
+	scoped := cl.Scoped(name)
+	key := uuid.New()
+	err = scoped.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	_, err = scoped.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_, err = cl.Get(context.Background(), key)
+	if err == nil {
+		t.Fatalf("key leaked into default namespace")
+	}
+
+	stats, err := cl.Stats(context.Background(), name)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Keys != 1 || stats.Sets != 1 || stats.Hits != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	names, err := cl.Namespaces(context.Background())
+	if err != nil {
+		t.Fatalf("namespaces: %v", err)
+	}
+	found := false
+	for _, n := range names {
+		found = found || n == name
+	}
+	if !found {
+		t.Fatalf("namespace [%s] not listed: %v", name, names)
+	}
+
+	err = scoped.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	keys, err := scoped.Keys(context.Background())
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("keys after flush: %v", keys)
+	}
+}
+
+func TestNamespaceNotFound(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL).Scoped(uuid.New())
+	_, err := cl.Keys(context.Background())
+	if err == nil {
+		t.Fatalf("keys in missing namespace")
+	}
+}
+
+func TestNamespaceMemoryLimit(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	name := uuid.New()
+	err := cl.CreateNamespace(context.Background(), name, 64)
+	if err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer cl.DropNamespace(context.Background(), name)
+
+	scoped := cl.Scoped(name)
+	err = scoped.Set(context.Background(), "small", bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	err = scoped.Set(context.Background(), "large", bytes.NewReader(bytes.Repeat([]byte(" "), 64)), 0)
+	if err == nil {
+		t.Fatalf("memory limit exceeded")
+	}
+}
+
+func TestDropDefaultNamespace(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	err := client.NewClient(server.URL).DropNamespace(context.Background(), defaultNamespace)
+	if err == nil {
+		t.Fatalf("default namespace dropped")
+	}
+}
+
+func TestNamespaceACL(t *testing.T) {
+	defer withUsers(t, `[
+		{"name": "admin", "token": "admin", "acl": [{"keys": ["*"], "ops": ["admin"]}]},
+		{"name": "team", "token": "team", "acl": [{"namespaces": ["team"], "keys": ["*"], "ops": ["read", "write"]}]}
+	]`)()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	admin := client.NewClient(server.URL)
+	admin.Token = "admin"
+	err := admin.CreateNamespace(context.Background(), "team", 0)
+	if err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer admin.DropNamespace(context.Background(), "team")
+
+	team := client.NewClient(server.URL)
+	team.Token = "team"
+	err = team.CreateNamespace(context.Background(), "other", 0)
+	if err == nil {
+		t.Fatalf("namespace created without admin permission")
+	}
+	err = team.Scoped("team").Set(context.Background(), "key", bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	err = team.Set(context.Background(), "key", bytes.NewReader([]byte("{}")), 0)
+	if err == nil {
+		t.Fatalf("set outside of namespace")
+	}
+	names, err := team.Namespaces(context.Background())
+	if err != nil {
+		t.Fatalf("namespaces: %v", err)
+	}
+	if len(names) != 1 || names[0] != "team" {
+		t.Fatalf("unexpected namespaces: %v", names)
+	}
+}
+
+func TestNamespaceFlush(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	ctx := context.Background()
+	name := uuid.New()
+	admin := client.NewClient(server.URL)
+	if err := admin.CreateNamespace(ctx, name, 0); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer admin.DropNamespace(ctx, name)
+	cl := client.NewClient(server.URL, client.WithNamespace(name))
+
+	if err := cl.Set(ctx, "key", bytes.NewReader([]byte("{}")), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := cl.Push(ctx, "queue", strings.NewReader(`1`)); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if _, err := cl.Stream("stream").Append(ctx, strings.NewReader(`1`), 0); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if _, err := cl.Lock(ctx, "lock", time.Minute, 0); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if err := cl.ConfigureQueue(ctx, "waiting", "", 0); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	popped := make(chan *client.Message)
+	go func() {
+		m, _ := cl.Pop(ctx, "waiting", time.Minute, time.Second)
+		popped <- m
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := cl.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if _, err := cl.Get(ctx, "key"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("key exists after flush: %v", err)
+	}
+	if _, err := cl.QueueStats(ctx, "queue"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("queue exists after flush: %v", err)
+	}
+	if _, err := cl.Stream("stream").Info(ctx); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("stream exists after flush: %v", err)
+	}
+	if _, err := cl.Lock(ctx, "lock", time.Minute, 0); err != nil {
+		t.Fatalf("lock is held after flush: %v", err)
+	}
+	if stats, err := admin.Stats(ctx, name); err != nil || stats.Memory != 0 {
+		t.Fatalf("unexpected stats: %+v %v", stats, err)
+	}
+
+	if _, err := cl.Push(ctx, "waiting", strings.NewReader(`"after flush"`)); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if m := <-popped; m == nil || string(m.Body) != `"after flush"` {
+		t.Fatalf("consumer is not woken up by flush: %+v", m)
+	}
+}
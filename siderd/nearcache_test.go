@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cached waits until value of the key is served from near cache.
+func cached(t *testing.T, nc *client.NearCache, key string) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		hits := nc.CacheStats().Hits
+		nc.Get(context.Background(), key)
+		nc.Get(context.Background(), key)
+		if nc.CacheStats().Hits > hits {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("key [%s] is not cached", key)
+}
+
+// eventually waits until value of the key read through near cache is
+// equal to expected.
+func eventually(t *testing.T, nc *client.NearCache, key string, expected interface{}) {
+	deadline := time.Now().Add(time.Second)
+	var v interface{}
+	for time.Now().Before(deadline) {
+		v, _ = nc.Get(context.Background(), key)
+		if v == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unexpected value of key [%s]: %v, expected: %v", key, v, expected)
+}
+
+func TestNearCache(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	nc := client.NewNearCache(client.NewClient(server.URL), 10, time.Minute)
+	defer nc.Close()
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	cl.Set(ctx, key, bytes.NewReader([]byte(`"one"`)), 0)
+	cached(t, nc, key)
+
+	cl.Put(ctx, key, bytes.NewReader([]byte(`"two"`)), 0)
+	eventually(t, nc, key, "two")
+	cached(t, nc, key)
+
+	err := nc.Put(ctx, key, bytes.NewReader([]byte(`"three"`)), 0)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if v, _ := nc.Get(ctx, key); v != "three" {
+		t.Fatalf("written value is not read back: %v", v)
+	}
+	cached(t, nc, key)
+
+	defaultNS().expireKey(key, time.Millisecond)
+	eventually(t, nc, key, nil)
+
+	stats := nc.CacheStats()
+	if stats.Invalidations < 2 || stats.Misses == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestNearCacheEviction(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	nc := client.NewNearCache(client.NewClient(server.URL), 1, time.Minute)
+	defer nc.Close()
+	ctx := context.Background()
+
+	first, second := uuid.New(), uuid.New()
+	defer cleanup(first)
+	defer cleanup(second)
+	nc.Set(ctx, first, bytes.NewReader([]byte(`1`)), 0)
+	nc.Set(ctx, second, bytes.NewReader([]byte(`2`)), 0)
+	cached(t, nc, first)
+	nc.Get(ctx, second)
+
+	stats := nc.CacheStats()
+	if stats.Size != 1 || stats.Evictions == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestNearCacheTTL(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	nc := client.NewNearCache(client.NewClient(server.URL), 0, 20*time.Millisecond)
+	defer nc.Close()
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	nc.Set(ctx, key, bytes.NewReader([]byte(`1`)), 0)
+	cached(t, nc, key)
+	time.Sleep(30 * time.Millisecond)
+	misses := nc.CacheStats().Misses
+	nc.Get(ctx, key)
+	if nc.CacheStats().Misses != misses+1 {
+		t.Fatalf("expired value is served from cache")
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pborman/uuid"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultVisibility = 30 * time.Second
+	maxVisibility     = 12 * time.Hour
+)
+
+var (
+	errNoMessage  = errors.New("queue is empty")
+	errBadReceipt = errors.New("receipt is not valid")
+)
+
+type message struct {
+	ID       string          `json:"id"`
+	Receipt  string          `json:"receipt,omitempty"`
+	Body     json.RawMessage `json:"body"`
+	Attempts int             `json:"attempts"`
+	// visible is the end of visibility timeout of reserved message.
+	visible time.Time
+}
+
+// size is memory used by the message accounted in namespace memory.
+func (m *message) size() int64 {
+	return int64(len(m.ID) + len(m.Body))
+}
+
+type queue struct {
+	deadLetter  string
+	maxAttempts int
+	ready       []*message
+	// reserved messages by receipt.
+	reserved map[string]*message
+	// pushed is closed when message becomes ready to wake up consumers.
+	pushed chan struct{}
+}
+
+type queueInfo struct {
+	Name        string `json:"name"`
+	Ready       int    `json:"ready"`
+	Reserved    int    `json:"reserved"`
+	DeadLetter  string `json:"dead_letter,omitempty"`
+	MaxAttempts int    `json:"max_attempts,omitempty"`
+}
+
+// queueRecord is dumped value of the queue, reserved messages are
+// dumped as ready ones.
+type queueRecord struct {
+	DeadLetter  string    `json:"dead_letter,omitempty"`
+	MaxAttempts int       `json:"max_attempts,omitempty"`
+	Messages    []message `json:"messages"`
+}
+
+type pushResult struct {
+	ID string `json:"id"`
+}
+
+func newQueue() *queue {
+	return &queue{reserved: make(map[string]*message), pushed: make(chan struct{})}
+}
+
+func (q *queue) wake() {
+	close(q.pushed)
+	q.pushed = make(chan struct{})
+}
+
+// size returns memory used by ready and reserved messages.
+func (q *queue) size() int64 {
+	var size int64
+	for _, m := range q.ready {
+		size += m.size()
+	}
+	for _, m := range q.reserved {
+		size += m.size()
+	}
+	return size
+}
+
+func (q *queue) info(name string) queueInfo {
+	return queueInfo{Name: name, Ready: len(q.ready), Reserved: len(q.reserved), DeadLetter: q.deadLetter, MaxAttempts: q.maxAttempts}
+}
+
+// queue returns existing queue or creates empty one, must be called with
+// queue lock held.
+func (ns *namespace) queue(name string) *queue {
+	q, ok := ns.queues[name]
+	if !ok {
+		q = newQueue()
+		ns.queues[name] = q
+		ns.queueCreated()
+	}
+	return q
+}
+
+// queueCreated wakes up consumers waiting for missing queues, must be
+// called with queue lock held.
+func (ns *namespace) queueCreated() {
+	close(ns.queuesChanged)
+	ns.queuesChanged = make(chan struct{})
+}
+
+// lookupQueue returns queue returning expired reservations to it, must
+// be called with queue lock held.
+func (ns *namespace) lookupQueue(name string) (*queue, bool) {
+	q, ok := ns.queues[name]
+	if !ok {
+		return nil, false
+	}
+	now := time.Now()
+	for receipt, m := range q.reserved {
+		if now.After(m.visible) {
+			delete(q.reserved, receipt)
+			ns.requeue(name, q, m)
+		}
+	}
+	return q, true
+}
+
+// requeue makes reserved message ready again moving it to dead letter
+// queue when it has no attempts left, must be called with queue lock
+// held.
+func (ns *namespace) requeue(name string, q *queue, m *message) {
+	m.Receipt = ""
+	if q.maxAttempts > 0 && m.Attempts >= q.maxAttempts {
+		dlq := ns.queue(q.deadLetter)
+		dlq.ready = append(dlq.ready, m)
+		dlq.wake()
+		log.Printf("Dead letter: [%s] message: [%s] to: [%s].\n", name, m.ID, q.deadLetter)
+		return
+	}
+	q.ready = append([]*message{m}, q.ready...)
+	q.wake()
+}
+
+// push appends message to the queue, messages are accounted in namespace
+// memory until they are acknowledged.
+func (ns *namespace) push(name string, body json.RawMessage) (*message, error) {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	m := &message{ID: uuid.New(), Body: body}
+	if !ns.reserveMemory(m.size()) {
+		return nil, errMemoryLimit
+	}
+	q := ns.queue(name)
+	q.ready = append(q.ready, m)
+	q.wake()
+	return m, nil
+}
+
+// pop reserves first ready message for visibility timeout waiting for
+// it or for the queue to be created if ctx allows.
+func (ns *namespace) pop(ctx context.Context, name string, visibility time.Duration) (message, error) {
+	for {
+		ns.queueLock.Lock()
+		q, ok := ns.lookupQueue(name)
+		if !ok {
+			changed := ns.queuesChanged
+			ns.queueLock.Unlock()
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return message{}, errNoMessage
+			}
+		}
+		if len(q.ready) > 0 {
+			m := q.ready[0]
+			q.ready[0], q.ready = nil, q.ready[1:]
+			m.Attempts++
+			m.Receipt = uuid.New()
+			m.visible = time.Now().Add(visibility)
+			q.reserved[m.Receipt] = m
+			ns.queueLock.Unlock()
+			return *m, nil
+		}
+		var next time.Time
+		for _, m := range q.reserved {
+			if next.IsZero() || m.visible.Before(next) {
+				next = m.visible
+			}
+		}
+		pushed := q.pushed
+		ns.queueLock.Unlock()
+		var expired <-chan time.Time
+		timer := time.NewTimer(time.Until(next))
+		if !next.IsZero() {
+			expired = timer.C
+		}
+		select {
+		case <-pushed:
+		case <-expired:
+		case <-ctx.Done():
+			timer.Stop()
+			return message{}, errNoMessage
+		}
+		timer.Stop()
+	}
+}
+
+// ack removes reserved message, nack makes it ready again.
+func (ns *namespace) ack(name string, receipt string, nack bool) error {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	q, ok := ns.lookupQueue(name)
+	if !ok {
+		return errBadReceipt
+	}
+	m, ok := q.reserved[receipt]
+	if !ok {
+		return errBadReceipt
+	}
+	delete(q.reserved, receipt)
+	if nack {
+		ns.requeue(name, q, m)
+		return nil
+	}
+	ns.releaseMemory(m.size())
+	return nil
+}
+
+func (ns *namespace) configureQueue(name string, deadLetter string, maxAttempts int) queueInfo {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	q := ns.queue(name)
+	q.deadLetter, q.maxAttempts = deadLetter, maxAttempts
+	return q.info(name)
+}
+
+func (ns *namespace) queueInfo(name string) (queueInfo, bool) {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	q, ok := ns.lookupQueue(name)
+	if !ok {
+		return queueInfo{}, false
+	}
+	return q.info(name), true
+}
+
+func (ns *namespace) dropQueue(name string) bool {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	q, ok := ns.queues[name]
+	if !ok {
+		return false
+	}
+	delete(ns.queues, name)
+	ns.releaseMemory(q.size())
+	q.wake()
+	return true
+}
+
+// flushQueues drops all queues waking up their consumers.
+func (ns *namespace) flushQueues() {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	for _, q := range ns.queues {
+		ns.releaseMemory(q.size())
+		q.wake()
+	}
+	ns.queues = make(map[string]*queue)
+}
+
+// queueRecords returns dumped values of all queues by name.
+func (ns *namespace) queueRecords() ([]string, map[string]queueRecord) {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	names := []string{}
+	for name := range ns.queues {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		ns.lookupQueue(name)
+	}
+	// expired messages may create dead letter queues.
+	names = names[:0]
+	for name := range ns.queues {
+		names = append(names, name)
+	}
+	records := make(map[string]queueRecord)
+	for _, name := range names {
+		q := ns.queues[name]
+		rec := queueRecord{DeadLetter: q.deadLetter, MaxAttempts: q.maxAttempts, Messages: []message{}}
+		for _, m := range q.ready {
+			rec.Messages = append(rec.Messages, *m)
+		}
+		for _, m := range q.reserved {
+			c := *m
+			c.Receipt = ""
+			rec.Messages = append(rec.Messages, c)
+		}
+		records[name] = rec
+	}
+	sort.Strings(names)
+	return names, records
+}
+
+func (ns *namespace) restoreQueue(name string, rec queueRecord, mode setMode) error {
+	ns.queueLock.Lock()
+	defer ns.queueLock.Unlock()
+	old, ok := ns.queues[name]
+	if ok && mode == setNew {
+		return errExists
+	}
+	q := newQueue()
+	q.deadLetter, q.maxAttempts = rec.DeadLetter, rec.MaxAttempts
+	for i := range rec.Messages {
+		m := rec.Messages[i]
+		m.Receipt = ""
+		q.ready = append(q.ready, &m)
+	}
+	var size int64
+	if ok {
+		size = old.size()
+	}
+	if !ns.reserveMemory(q.size() - size) {
+		return errMemoryLimit
+	}
+	ns.releaseMemory(size - q.size())
+	ns.queues[name] = q
+	if ok {
+		old.wake()
+	} else {
+		ns.queueCreated()
+	}
+	return nil
+}
+
+func pushMessage(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	var body json.RawMessage
+	if _, ok := decodeValue(w, r, &body); !ok {
+		return
+	}
+	ns := namespaceOf(r)
+	m, err := ns.push(name, body)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Namespace [%s] memory limit exceeded.", ns.name), http.StatusInsufficientStorage)
+		return
+	}
+	json.NewEncoder(w).Encode(pushResult{ID: m.ID})
+	log.Printf("Push: [%s] message: [%s].\n", name, m.ID)
+}
+
+// popMessage reserves message for visibility timeout, optional wait
+// parameter sets how long to wait for message. Empty queue responds with
+// 204.
+func popMessage(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	visibility, ok := durationParam(r, "visibility", maxVisibility)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad visibility timeout [%s].", r.FormValue("visibility")), http.StatusBadRequest)
+		return
+	}
+	if visibility == 0 {
+		visibility = defaultVisibility
+	}
+	wait, ok := durationParam(r, "wait", maxWait)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad wait duration [%s].", r.FormValue("wait")), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	m, err := namespaceOf(r).pop(ctx, name, visibility)
+	if err != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	json.NewEncoder(w).Encode(m)
+	log.Printf("Pop: [%s] message: [%s] attempt: [%d].\n", name, m.ID, m.Attempts)
+}
+
+func ackMessage(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	acknowledge(w, r, name, false)
+}
+
+func nackMessage(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	acknowledge(w, r, name, true)
+}
+
+func acknowledge(w http.ResponseWriter, r *http.Request, name string, nack bool) {
+	receipt := r.FormValue("receipt")
+	err := namespaceOf(r).ack(name, receipt, nack)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Receipt [%s] is not valid in queue [%s].", receipt, name), http.StatusPreconditionFailed)
+		return
+	}
+	if nack {
+		log.Printf("Nack: [%s] receipt: [%s].\n", name, receipt)
+		return
+	}
+	log.Printf("Ack: [%s] receipt: [%s].\n", name, receipt)
+}
+
+// configureQueueHandler sets dead letter queue receiving messages after
+// max_attempts deliveries.
+func configureQueueHandler(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	deadLetter := r.FormValue("dead_letter")
+	var maxAttempts int
+	if s := r.FormValue("max_attempts"); s != "" {
+		var err error
+		maxAttempts, err = strconv.Atoi(s)
+		if err != nil || maxAttempts < 0 {
+			httpError(w, fmt.Sprintf("Bad max attempts [%s].", s), http.StatusBadRequest)
+			return
+		}
+	}
+	switch {
+	case deadLetter == name:
+		httpError(w, "Queue can not be dead letter queue of itself.", http.StatusBadRequest)
+		return
+	case (deadLetter == "") != (maxAttempts == 0):
+		httpError(w, "Dead letter queue requires max attempts.", http.StatusBadRequest)
+		return
+	}
+	ns := namespaceOf(r)
+	if deadLetter != "" && !permitted(r, opWrite, ns.name, deadLetter) {
+		httpError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	info := ns.configureQueue(name, deadLetter, maxAttempts)
+	json.NewEncoder(w).Encode(info)
+	log.Printf("Configure queue: [%s].\n", name)
+}
+
+func queueStats(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	info, ok := namespaceOf(r).queueInfo(name)
+	if !ok {
+		httpError(w, fmt.Sprintf("Queue [%s] not found.", name), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
+
+func dropQueueHandler(w http.ResponseWriter, r *http.Request, name string, ttl time.Duration) {
+	if !namespaceOf(r).dropQueue(name) {
+		httpError(w, fmt.Sprintf("Queue [%s] not found.", name), http.StatusNotFound)
+		return
+	}
+	log.Printf("Drop queue: [%s].\n", name)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name := uuid.New()
+	defer cl.DropQueue(ctx, name)
+	first, err := cl.Push(ctx, name, strings.NewReader(`{"n": 1}`))
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	_, err = cl.Push(ctx, name, strings.NewReader(`{"n": 2}`))
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if _, err := cl.Push(ctx, name, strings.NewReader(`{`)); err == nil {
+		t.Fatalf("malformed message is pushed")
+	}
+
+	m, err := cl.Pop(ctx, name, time.Minute, 0)
+	if err != nil {
+		t.Fatalf("pop: %v", err)
+	}
+	if m == nil || m.ID != first || m.Attempts != 1 || string(m.Body) != `{"n":1}` {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+	stats, err := cl.QueueStats(ctx, name)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Ready != 1 || stats.Reserved != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if err := cl.Ack(ctx, name, m.Receipt); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := cl.Ack(ctx, name, m.Receipt); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("message is acknowledged twice: %v", err)
+	}
+
+	m, err = cl.Pop(ctx, name, time.Minute, 0)
+	if err != nil || m == nil {
+		t.Fatalf("pop: %v", err)
+	}
+	if err := cl.Nack(ctx, name, m.Receipt); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	again, err := cl.Pop(ctx, name, time.Minute, 0)
+	if err != nil || again == nil {
+		t.Fatalf("pop: %v", err)
+	}
+	if again.ID != m.ID || again.Attempts != 2 || again.Receipt == m.Receipt {
+		t.Fatalf("unexpected redelivered message: %+v", again)
+	}
+	cl.Ack(ctx, name, again.Receipt)
+
+	m, err = cl.Pop(ctx, name, time.Minute, 0)
+	if err != nil || m != nil {
+		t.Fatalf("message in empty queue: %+v, %v", m, err)
+	}
+	if _, err := cl.Scoped(defaultNamespace).QueueStats(ctx, uuid.New()); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestQueueVisibility(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name := uuid.New()
+	defer cl.DropQueue(ctx, name)
+	_, err := cl.Push(ctx, name, strings.NewReader(`1`))
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	m, err := cl.Pop(ctx, name, 20*time.Millisecond, 0)
+	if err != nil || m == nil {
+		t.Fatalf("pop: %v", err)
+	}
+	start := time.Now()
+	again, err := cl.Pop(ctx, name, time.Minute, time.Second)
+	if err != nil || again == nil {
+		t.Fatalf("message is not redelivered: %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("waiter is not woken up on visibility timeout")
+	}
+	if again.ID != m.ID || again.Attempts != 2 {
+		t.Fatalf("unexpected redelivered message: %+v", again)
+	}
+	if err := cl.Ack(ctx, name, m.Receipt); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("expired receipt is acknowledged: %v", err)
+	}
+	if err := cl.Ack(ctx, name, again.Receipt); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name, dlq := uuid.New(), uuid.New()
+	defer cl.DropQueue(ctx, name)
+	defer cl.DropQueue(ctx, dlq)
+	if err := cl.ConfigureQueue(ctx, name, name, 1); err == nil {
+		t.Fatalf("queue is dead letter queue of itself")
+	}
+	if err := cl.ConfigureQueue(ctx, name, dlq, 2); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	id, err := cl.Push(ctx, name, strings.NewReader(`"poison"`))
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		m, err := cl.Pop(ctx, name, time.Minute, 0)
+		if err != nil || m == nil {
+			t.Fatalf("pop: %v", err)
+		}
+		if err := cl.Nack(ctx, name, m.Receipt); err != nil {
+			t.Fatalf("nack: %v", err)
+		}
+	}
+	if m, err := cl.Pop(ctx, name, time.Minute, 0); err != nil || m != nil {
+		t.Fatalf("message is not moved to dead letter queue: %+v, %v", m, err)
+	}
+	m, err := cl.Pop(ctx, dlq, time.Minute, 0)
+	if err != nil || m == nil {
+		t.Fatalf("pop dead letter: %v", err)
+	}
+	if m.ID != id || string(m.Body) != `"poison"` {
+		t.Fatalf("unexpected dead letter message: %+v", m)
+	}
+}
+
+func TestQueueReceive(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name := uuid.New()
+	defer cl.DropQueue(ctx, name)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cl.Push(ctx, name, strings.NewReader(`"late"`))
+	}()
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	m, err := cl.Receive(wctx, name, time.Minute)
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if string(m.Body) != `"late"` {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+	cl.Ack(ctx, name, m.Receipt)
+
+	wctx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := cl.Receive(wctx, name, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestQueueDumpRestore(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	name := uuid.New()
+	defer cl.DropQueue(ctx, name)
+	for _, body := range []string{`1`, `2`} {
+		if _, err := cl.Push(ctx, name, strings.NewReader(body)); err != nil {
+			t.Fatalf("push: %v", err)
+		}
+	}
+	reserved, err := cl.Pop(ctx, name, time.Minute, 0)
+	if err != nil || reserved == nil {
+		t.Fatalf("pop: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = cl.Dump(ctx, &buf)
+	if err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"key":"`+name+`","type":"queue"`) {
+		t.Fatalf("queue is not dumped: %s", buf.String())
+	}
+	cl.DropQueue(ctx, name)
+
+	_, err = cl.Restore(ctx, &buf, client.RestoreSkip)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	stats, err := cl.QueueStats(ctx, name)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Ready != 2 || stats.Reserved != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if err := cl.Ack(ctx, name, reserved.Receipt); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("receipt is valid after restore: %v", err)
+	}
+}
+
+func TestQueueMemory(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	ctx := context.Background()
+	name := uuid.New()
+	admin := client.NewClient(server.URL)
+	if err := admin.CreateNamespace(ctx, name, 100); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	defer admin.DropNamespace(ctx, name)
+	cl := client.NewClient(server.URL, client.WithNamespace(name))
+
+	if m, err := cl.Pop(ctx, "queue", time.Minute, 0); err != nil || m != nil {
+		t.Fatalf("pop: %+v %v", m, err)
+	}
+	if _, err := cl.QueueStats(ctx, "queue"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("queue is created by pop: %v", err)
+	}
+
+	if _, err := cl.Push(ctx, "queue", strings.NewReader(`"`+strings.Repeat("a", 40)+`"`)); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if _, err := cl.Push(ctx, "queue", strings.NewReader(`"`+strings.Repeat("b", 40)+`"`)); err == nil {
+		t.Fatalf("message exceeding memory limit is pushed")
+	}
+	stats, err := admin.Stats(ctx, name)
+	if err != nil || stats.Memory != 78 {
+		t.Fatalf("unexpected stats: %+v %v", stats, err)
+	}
+	m, err := cl.Pop(ctx, "queue", time.Minute, 0)
+	if err != nil || m == nil {
+		t.Fatalf("pop: %v", err)
+	}
+	if err := cl.Ack(ctx, "queue", m.Receipt); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if stats, err := admin.Stats(ctx, name); err != nil || stats.Memory != 0 {
+		t.Fatalf("unexpected stats: %+v %v", stats, err)
+	}
+}
+
+func TestQueueDeadLetterForbidden(t *testing.T) {
+	defer withUsers(t, `[
+	{"name": "app", "token": "app", "acl": [{"keys": ["app:*"], "ops": ["read", "write"]}]}
+]`)()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	cl.Token = "app"
+	ctx := context.Background()
+
+	name := "app:" + uuid.New()
+	if err := cl.ConfigureQueue(ctx, name, uuid.New(), 1); !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("dead letter queue outside of acl: %v", err)
+	}
+	if _, err := cl.QueueStats(ctx, name); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("queue is configured: %v", err)
+	}
+}
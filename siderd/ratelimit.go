@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+var (
+	rateLimits string
+	limiters   map[string]*limiter
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limiter struct {
+	rate  float64
+	burst float64
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newLimiter(rate float64, burst float64) *limiter {
+	return &limiter{rate: rate, burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// take removes one token from the client bucket, if bucket is empty
+// it returns time to wait until next token is available.
+func (l *limiter) take(id string, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if now.Sub(l.swept) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[id] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *limiter) sweep(now time.Time) {
+	for id, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, id)
+		}
+	}
+	l.swept = now
+}
+
+// parseRateLimits parses comma separated list of operation limits in
+// requests per second with optional burst: read=100:200,write=10.
+func parseRateLimits(s string) (map[string]*limiter, error) {
+	m := make(map[string]*limiter)
+	for _, limit := range strings.Split(s, ",") {
+		fragments := strings.SplitN(limit, "=", 2)
+		if len(fragments) != 2 {
+			return nil, fmt.Errorf("malformed limit [%s]", limit)
+		}
+		op := strings.TrimSpace(fragments[0])
+		switch op {
+		case opRead, opWrite, opDelete, opAdmin:
+		default:
+			return nil, fmt.Errorf("unknown operation [%s]", op)
+		}
+		values := strings.SplitN(fragments[1], ":", 2)
+		rate, err := strconv.ParseFloat(values[0], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("bad rate [%s] for [%s]", values[0], op)
+		}
+		burst := math.Max(rate, 1)
+		if len(values) == 2 {
+			burst, err = strconv.ParseFloat(values[1], 64)
+			if err != nil || burst < 1 {
+				return nil, fmt.Errorf("bad burst [%s] for [%s]", values[1], op)
+			}
+		}
+		m[op] = newLimiter(rate, burst)
+	}
+	return m, nil
+}
+
+func operation(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return opRead
+	case http.MethodDelete:
+		return opDelete
+	default:
+		return opWrite
+	}
+}
+
+// identity returns rate limit bucket of the request, requests with tokens
+// of known users are limited per user and all other requests per remote
+// address so that clients can not avoid limits with random tokens.
+func identity(r *http.Request) string {
+	if u, ok := users[token(r)]; ok {
+		return "token:" + u.Token
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "addr:" + r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+func rateLimitHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, ok := limiters[operation(r)]
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := l.take(identity(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			httpError(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
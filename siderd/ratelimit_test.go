@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/pborman/uuid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(10, 2)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.take("client", now); !ok {
+			t.Fatalf("burst request %d limited", i)
+		}
+	}
+	ok, wait := l.take("client", now)
+	if ok {
+		t.Fatalf("request above burst allowed")
+	}
+	if wait != 100*time.Millisecond {
+		t.Fatalf("unexpected wait: %v", wait)
+	}
+	if ok, _ := l.take("other", now); !ok {
+		t.Fatalf("other client limited")
+	}
+	if ok, _ := l.take("client", now.Add(wait)); !ok {
+		t.Fatalf("request after wait limited")
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	m, err := parseRateLimits("read=100:200,write=0.5")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if m[opRead].rate != 100 || m[opRead].burst != 200 {
+		t.Fatalf("unexpected read limit: %v", m[opRead])
+	}
+	if m[opWrite].rate != 0.5 || m[opWrite].burst != 1 {
+		t.Fatalf("unexpected write limit: %v", m[opWrite])
+	}
+	for _, s := range []string{"read", "list=1", "read=-1", "read=1:0"} {
+		if _, err := parseRateLimits(s); err == nil {
+			t.Fatalf("malformed limits accepted: %s", s)
+		}
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	limiters = map[string]*limiter{opRead: newLimiter(0.1, 1)}
+	defer func() {
+		limiters = nil
+	}()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/keys")
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/keys")
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if h := resp.Header.Get("Retry-After"); h != "10" {
+		t.Fatalf("unexpected Retry-After: %s", h)
+	}
+}
+
+func TestRateLimitUnknownTokens(t *testing.T) {
+	limiters = map[string]*limiter{opRead: newLimiter(0.1, 1)}
+	defer func() {
+		limiters = nil
+	}()
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	for i, code := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		r, _ := http.NewRequest(http.MethodGet, server.URL+"/keys", nil)
+		r.Header.Set("Authorization", "Bearer "+uuid.New())
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("keys: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Fatalf("request %d: unexpected status: %d", i, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+const jsonContentType = "application/json"
+
+// raw is value stored as is and returned with its content type.
+type raw struct {
+	contentType string
+	data        []byte
+}
+
+// rawRecord is dump representation of raw value.
+type rawRecord struct {
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// isRaw reports whether request body is raw value. Requests without
+// content type are json, form bodies are consumed by parameters parsing
+// so they are treated as json too.
+func isRaw(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return true
+	}
+	switch mt {
+	case jsonContentType, "application/x-www-form-urlencoded", "multipart/form-data":
+		return false
+	}
+	return true
+}
+
+// readValue reads value of the request body either as json or as raw
+// value depending on content type and returns value size, it replies
+// with error and returns false if value can not be read.
+func readValue(w http.ResponseWriter, r *http.Request) (interface{}, int64, bool) {
+	if !isRaw(r) {
+		var data interface{}
+		size, ok := decodeValue(w, r, &data)
+		return data, size, ok
+	}
+	var body io.Reader = r.Body
+	if maxValueSize > 0 {
+		body = io.LimitReader(r.Body, maxValueSize+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Read request: %v", err), http.StatusBadRequest)
+		return nil, 0, false
+	}
+	if maxValueSize > 0 && int64(len(b)) > maxValueSize {
+		limitExceeded(w, errValueTooLarge)
+		return nil, 0, false
+	}
+	return &raw{contentType: r.Header.Get("Content-Type"), data: b}, int64(len(b) + len(r.Header.Get("Content-Type"))), true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	data := []byte{0x89, 'P', 'N', 'G', 0, 1, 2, 0xff}
+	if err := cl.SetBytes(ctx, key, data, "image/png", 0); err != nil {
+		t.Fatalf("set bytes: %v", err)
+	}
+	b, ct, err := cl.GetBytes(ctx, key)
+	if err != nil {
+		t.Fatalf("get bytes: %v", err)
+	}
+	if !bytes.Equal(b, data) || ct != "image/png" {
+		t.Fatalf("unexpected value: %q %s", b, ct)
+	}
+	if _, err := cl.Get(ctx, key); err == nil {
+		t.Fatalf("raw value is decoded as json")
+	}
+
+	other := uuid.New()
+	defer cleanup(other)
+	if err := cl.SetBytes(ctx, other, []byte(`{"a": 1}`), "", 0); err != nil {
+		t.Fatalf("set bytes: %v", err)
+	}
+	b, ct, err = cl.GetBytes(ctx, other)
+	if err != nil || ct != "application/json" || strings.TrimSpace(string(b)) != `{"a":1}` {
+		t.Fatalf("unexpected value: %s %s %v", b, ct, err)
+	}
+	if err := cl.SetBytes(ctx, uuid.New(), []byte(`{`), "application/json; charset=utf-8", 0); err == nil {
+		t.Fatalf("invalid json is stored")
+	}
+
+	var dump bytes.Buffer
+	if err := cl.Dump(ctx, &dump); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	cl.Del(ctx, key)
+	if _, err := cl.Restore(ctx, &dump, client.RestoreSkip); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	b, ct, err = cl.GetBytes(ctx, key)
+	if err != nil || !bytes.Equal(b, data) || ct != "image/png" {
+		t.Fatalf("unexpected restored value: %q %s %v", b, ct, err)
+	}
+
+	name := uuid.New()
+	err = cl.PutSchema(ctx, &client.Schema{Name: name, Pattern: key, Schema: json.RawMessage(`true`)})
+	if err != nil {
+		t.Fatalf("put schema: %v", err)
+	}
+	defer cl.DeleteSchema(ctx, name)
+	cl.Del(ctx, key)
+	if err := cl.SetBytes(ctx, key, data, "image/png", 0); !errors.Is(err, client.ErrInvalidValue) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,664 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRESPBulk  = 512 << 20
+	maxRESPArray = 1 << 20
+	maxRESPLine  = 64 << 10
+	// unauthenticated clients may send only small commands.
+	maxRESPAuthBulk  = 1 << 20
+	maxRESPAuthArray = 16
+	scanCount        = 10
+
+	maxDuration = time.Duration(math.MaxInt64)
+)
+
+var (
+	respListen string
+
+	errRESPProtocol = errors.New("protocol error")
+)
+
+type respCommand struct {
+	// arity is exact number of arguments including command name,
+	// negative arity is minimal number of arguments.
+	arity int
+	op    string
+	// keys is position of the key argument, -1 means all arguments
+	// after command name are keys.
+	keys int
+	fn   func(c *respConn, args []string)
+}
+
+var respCommands map[string]respCommand
+
+func init() {
+	respCommands = map[string]respCommand{
+		"PING":    {-1, "", 0, respPing},
+		"ECHO":    {2, "", 0, respEcho},
+		"HELLO":   {-1, "", 0, respHello},
+		"AUTH":    {-2, "", 0, respAuth},
+		"SELECT":  {2, "", 0, respSelect},
+		"QUIT":    {1, "", 0, respQuit},
+		"COMMAND": {-1, "", 0, respCommandInfo},
+		"INFO":    {-1, opRead, 0, respInfo},
+		"DBSIZE":  {1, opRead, 0, respDBSize},
+		"FLUSHDB": {-1, opAdmin, 0, respFlushDB},
+		"GET":     {2, opRead, 1, respGet},
+		"SET":     {-3, opWrite, 1, respSet},
+		"DEL":     {-2, opDelete, -1, respDel},
+		"EXISTS":  {-2, opRead, -1, respExists},
+		"KEYS":    {2, opRead, 0, respKeys},
+		"SCAN":    {-2, opRead, 0, respScan},
+		"EXPIRE":  {3, opWrite, 1, respExpire},
+		"PEXPIRE": {3, opWrite, 1, respExpire},
+		"PERSIST": {2, opWrite, 1, respPersist},
+		"TTL":     {2, opRead, 1, respTTL},
+		"PTTL":    {2, opRead, 1, respTTL},
+		"INCR":    {2, opWrite, 1, respIncr},
+		"DECR":    {2, opWrite, 1, respIncr},
+		"INCRBY":  {3, opWrite, 1, respIncr},
+		"DECRBY":  {3, opWrite, 1, respIncr},
+	}
+}
+
+type respConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	w     *bufio.Writer
+	proto int
+	ns    *namespace
+	user  *user
+	quit  bool
+}
+
+func serveRESP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		ns, _ := lookupNamespace(defaultNamespace)
+		c := &respConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), proto: 2, ns: ns}
+		go c.serve()
+	}
+}
+
+func (c *respConn) serve() {
+	defer c.conn.Close()
+	for !c.quit {
+		args, err := c.readCommand()
+		if err == errRESPProtocol {
+			c.error("ERR Protocol error")
+			c.w.Flush()
+			return
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("RESP: [%s]: %v\n", c.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		c.dispatch(args)
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.w.Flush()
+}
+
+// readLine reads line of at most maxRESPLine bytes.
+func (c *respConn) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := c.r.ReadSlice('\n')
+		if len(line)+len(b) > maxRESPLine {
+			return "", errRESPProtocol
+		}
+		line = append(line, b...)
+		switch err {
+		case nil:
+			return strings.TrimRight(string(line), "\r\n"), nil
+		case bufio.ErrBufferFull:
+		default:
+			return "", err
+		}
+	}
+}
+
+// limits returns maximum number of command arguments and size of one
+// argument, values can not exceed value size limit.
+func (c *respConn) limits() (int, int) {
+	switch {
+	case users != nil && c.user == nil:
+		return maxRESPAuthArray, maxRESPAuthBulk
+	case maxValueSize > 0 && maxValueSize < maxRESPBulk-maxRESPLine:
+		// key and other arguments may be longer than value.
+		return maxRESPArray, int(maxValueSize) + maxRESPLine
+	}
+	return maxRESPArray, maxRESPBulk
+}
+
+func (c *respConn) readCommand() ([]string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	maxArray, maxBulk := c.limits()
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArray {
+		return nil, errRESPProtocol
+	}
+	// arguments are not preallocated as client may not send them.
+	var args []string
+	for i := 0; i < n; i++ {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errRESPProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, errRESPProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func (c *respConn) dispatch(args []string) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := respCommands[name]
+	if !ok {
+		c.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return
+	}
+	if cmd.op != "" {
+		if users != nil && c.user == nil {
+			c.error("NOAUTH Authentication required.")
+			return
+		}
+		if l, ok := limiters[cmd.op]; ok {
+			if ok, _ := l.take(c.identity(), time.Now()); !ok {
+				c.error("ERR rate limit exceeded")
+				return
+			}
+		}
+		var keys []string
+		switch {
+		case cmd.keys > 0:
+			keys = args[cmd.keys : cmd.keys+1]
+		case cmd.keys < 0:
+			keys = args[1:]
+		}
+		if !c.permitted(cmd.op, "") {
+			c.error("NOPERM this user has no permissions to run the '" + strings.ToLower(name) + "' command")
+			return
+		}
+		for _, key := range keys {
+			if !c.permitted(cmd.op, key) {
+				c.error("NOPERM this user has no permissions to access one of the keys used as arguments")
+				return
+			}
+		}
+	}
+	args[0] = name
+	cmd.fn(c, args)
+}
+
+func (c *respConn) permitted(op string, key string) bool {
+	return users == nil || (c.user != nil && c.user.can(op, c.ns.name, key))
+}
+
+func (c *respConn) identity() string {
+	if c.user != nil {
+		return "token:" + c.user.Token
+	}
+	host, _, err := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if err != nil {
+		return "addr:" + c.conn.RemoteAddr().String()
+	}
+	return "addr:" + host
+}
+
+func (c *respConn) simple(s string) {
+	fmt.Fprintf(c.w, "+%s\r\n", s)
+}
+
+func (c *respConn) error(s string) {
+	fmt.Fprintf(c.w, "-%s\r\n", s)
+}
+
+func (c *respConn) integer(i int64) {
+	fmt.Fprintf(c.w, ":%d\r\n", i)
+}
+
+func (c *respConn) bulk(s string) {
+	fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (c *respConn) null() {
+	if c.proto == 3 {
+		c.w.WriteString("_\r\n")
+		return
+	}
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *respConn) array(n int) {
+	fmt.Fprintf(c.w, "*%d\r\n", n)
+}
+
+func (c *respConn) mapHeader(n int) {
+	if c.proto == 3 {
+		fmt.Fprintf(c.w, "%%%d\r\n", n)
+		return
+	}
+	c.array(2 * n)
+}
+
+func (c *respConn) strings(list []string) {
+	c.array(len(list))
+	for _, s := range list {
+		c.bulk(s)
+	}
+}
+
+func (c *respConn) storeError(err error) {
+	switch err {
+	case errNotInteger:
+		c.error("ERR value is not an integer or out of range")
+	case errOverflow:
+		c.error("ERR increment or decrement would overflow")
+	case errMemoryLimit:
+		c.error("OOM namespace memory limit exceeded")
+	default:
+		c.error("ERR " + err.Error())
+	}
+}
+
+// respValue represents stored value as redis string: strings are
+// returned as is, other values in json notation.
+func respValue(data interface{}) string {
+	switch v := data.(type) {
+	case string:
+		return v
+	case *raw:
+		return string(v.data)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func respPing(c *respConn, args []string) {
+	if len(args) > 1 {
+		c.bulk(args[1])
+		return
+	}
+	c.simple("PONG")
+}
+
+func respEcho(c *respConn, args []string) {
+	c.bulk(args[1])
+}
+
+func respQuit(c *respConn, args []string) {
+	c.simple("OK")
+	c.quit = true
+}
+
+func respCommandInfo(c *respConn, args []string) {
+	c.array(0)
+}
+
+func (c *respConn) authenticate(token string) bool {
+	if users == nil {
+		return true
+	}
+	u, ok := users[token]
+	if !ok {
+		return false
+	}
+	c.user = u
+	return true
+}
+
+// respAuth accepts AUTH token and AUTH username token, user name is
+// ignored since tokens identify users.
+func respAuth(c *respConn, args []string) {
+	if len(args) > 3 {
+		c.error("ERR syntax error")
+		return
+	}
+	if !c.authenticate(args[len(args)-1]) {
+		c.error("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	c.simple("OK")
+}
+
+func respHello(c *respConn, args []string) {
+	proto := c.proto
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 2 || v > 3 {
+			c.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				c.error("ERR syntax error")
+				return
+			}
+			if !c.authenticate(args[i+2]) {
+				c.error("WRONGPASS invalid username-password pair or user is disabled.")
+				return
+			}
+			i += 2
+		case "SETNAME":
+			i++
+		default:
+			c.error("ERR syntax error")
+			return
+		}
+	}
+	c.proto = proto
+	c.mapHeader(3)
+	c.bulk("server")
+	c.bulk("sider")
+	c.bulk("proto")
+	c.integer(int64(proto))
+	c.bulk("mode")
+	c.bulk("standalone")
+}
+
+// respSelect switches connection to namespace, database 0 is default
+// namespace.
+func respSelect(c *respConn, args []string) {
+	name := args[1]
+	if name == "0" {
+		name = defaultNamespace
+	}
+	ns, ok := lookupNamespace(name)
+	if !ok {
+		c.error("ERR DB index is out of range")
+		return
+	}
+	c.ns = ns
+	c.simple("OK")
+}
+
+func respInfo(c *respConn, args []string) {
+	var b strings.Builder
+	b.WriteString("# Server\r\nredis_version:7.0.0\r\nsider_mode:standalone\r\n")
+	b.WriteString("\r\n# Keyspace\r\n")
+	for _, name := range namespaceNames() {
+		ns, ok := lookupNamespace(name)
+		if !ok || !c.permittedNamespace(name) {
+			continue
+		}
+		st := ns.stats()
+		fmt.Fprintf(&b, "%s:keys=%d,memory=%d,hits=%d,misses=%d,expired=%d\r\n", name, st.Keys, st.Memory, st.Hits, st.Misses, st.Expired)
+	}
+	c.bulk(b.String())
+}
+
+func (c *respConn) permittedNamespace(name string) bool {
+	return users == nil || (c.user != nil && c.user.can(opRead, name, ""))
+}
+
+func respDBSize(c *respConn, args []string) {
+	c.integer(int64(c.ns.stats().Keys))
+}
+
+func respFlushDB(c *respConn, args []string) {
+	c.ns.flush()
+	c.simple("OK")
+}
+
+func respGet(c *respConn, args []string) {
+	n, ok := c.ns.get(args[1])
+	if !ok {
+		c.null()
+		return
+	}
+	c.bulk(respValue(n.value()))
+}
+
+// respSet implements SET key value [NX|XX] [EX seconds|PX milliseconds].
+func respSet(c *respConn, args []string) {
+	key, value := args[1], args[2]
+	mode := setAlways
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			mode = setNew
+		case "XX":
+			mode = setExisting
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				c.error("ERR syntax error")
+				return
+			}
+			v, err := strconv.ParseInt(args[i+1], 10, 64)
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if err != nil || v <= 0 || v > int64(maxDuration/unit) {
+				c.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(v) * unit
+			i++
+		default:
+			c.error("ERR syntax error")
+			return
+		}
+	}
+	switch err := c.ns.set(key, value, int64(len(value)), ttl, mode); err {
+	case nil:
+		c.simple("OK")
+	case errExists, errNotFound:
+		c.null()
+	default:
+		c.storeError(err)
+	}
+}
+
+func respDel(c *respConn, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if c.ns.del(key) {
+			n++
+		}
+	}
+	c.integer(n)
+}
+
+func respExists(c *respConn, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if _, ok := c.ns.peek(key); ok {
+			n++
+		}
+	}
+	c.integer(n)
+}
+
+func (c *respConn) keys(pattern string) []string {
+	keys, _ := c.ns.keys(context.Background(), func(k string) bool {
+		if ok, _ := path.Match(pattern, k); !ok {
+			return false
+		}
+		return c.permitted(opRead, k)
+	})
+	return keys
+}
+
+func respKeys(c *respConn, args []string) {
+	c.strings(c.keys(args[1]))
+}
+
+// respScan implements SCAN cursor [MATCH pattern] [COUNT count], cursor
+// is a position in sorted key list.
+func respScan(c *respConn, args []string) {
+	cursor, err := strconv.Atoi(args[1])
+	if err != nil || cursor < 0 {
+		c.error("ERR invalid cursor")
+		return
+	}
+	pattern, count := "*", scanCount
+	for i := 2; i < len(args); i++ {
+		if i+1 >= len(args) {
+			c.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				c.error("ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			c.error("ERR syntax error")
+			return
+		}
+		i++
+	}
+	keys := c.keys(pattern)
+	sort.Strings(keys)
+	if cursor > len(keys) {
+		cursor = len(keys)
+	}
+	end := cursor + count
+	next := end
+	if end >= len(keys) {
+		end, next = len(keys), 0
+	}
+	c.array(2)
+	c.bulk(strconv.Itoa(next))
+	c.strings(keys[cursor:end])
+}
+
+func respExpire(c *respConn, args []string) {
+	v, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.error("ERR value is not an integer or out of range")
+		return
+	}
+	unit := time.Second
+	if args[0] == "PEXPIRE" {
+		unit = time.Millisecond
+	}
+	if v > int64(maxDuration/unit) {
+		c.error("ERR invalid expire time in '" + strings.ToLower(args[0]) + "' command")
+		return
+	}
+	if v <= 0 {
+		if c.ns.del(args[1]) {
+			c.integer(1)
+			return
+		}
+		c.integer(0)
+		return
+	}
+	if c.ns.expireKey(args[1], time.Duration(v)*unit) {
+		c.integer(1)
+		return
+	}
+	c.integer(0)
+}
+
+func respPersist(c *respConn, args []string) {
+	ttl, ok := c.ns.ttl(args[1])
+	if !ok || ttl == 0 || !c.ns.expireKey(args[1], 0) {
+		c.integer(0)
+		return
+	}
+	c.integer(1)
+}
+
+func respTTL(c *respConn, args []string) {
+	ttl, ok := c.ns.ttl(args[1])
+	switch {
+	case !ok:
+		c.integer(-2)
+	case ttl == 0:
+		c.integer(-1)
+	case args[0] == "PTTL":
+		c.integer(int64((ttl + time.Millisecond/2) / time.Millisecond))
+	default:
+		c.integer(int64((ttl + time.Second/2) / time.Second))
+	}
+}
+
+func respIncr(c *respConn, args []string) {
+	delta := int64(1)
+	if len(args) == 3 {
+		var err error
+		delta, err = strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			c.error("ERR value is not an integer or out of range")
+			return
+		}
+	}
+	if args[0] == "DECR" || args[0] == "DECRBY" {
+		if delta == math.MinInt64 {
+			c.error("ERR decrement would overflow")
+			return
+		}
+		delta = -delta
+	}
+	v, err := c.ns.incr(args[1], delta)
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.integer(v)
+}
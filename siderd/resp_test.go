@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func respServer(t *testing.T) (net.Listener, *respClient) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go serveRESP(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return l, &respClient{t, conn, bufio.NewReader(conn)}
+}
+
+// do sends command and returns reply in simplified notation: arrays
+// and maps are flattened to space separated elements.
+func (c *respClient) do(args ...string) string {
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.read()
+}
+
+func (c *respClient) read() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read reply: %v", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch line[0] {
+	case '$':
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		if n < 0 {
+			return "(nil)"
+		}
+		buf := make([]byte, n+2)
+		io.ReadFull(c.r, buf)
+		return string(buf[:n])
+	case '*', '%':
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		if line[0] == '%' {
+			n *= 2
+		}
+		var elems []string
+		for i := 0; i < n; i++ {
+			elems = append(elems, c.read())
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	case '_':
+		return "(nil)"
+	default:
+		return line
+	}
+}
+
+func (c *respClient) expect(reply string, args ...string) {
+	if r := c.do(args...); r != reply {
+		c.t.Fatalf("%v: unexpected reply: %s, expected: %s", args, r, reply)
+	}
+}
+
+func TestRESP(t *testing.T) {
+	l, c := respServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+
+	c.expect("+PONG", "PING")
+	c.expect("(nil)", "GET", "resp:key")
+	c.expect("+OK", "SET", "resp:key", "value")
+	c.expect("value", "GET", "resp:key")
+	c.expect("(nil)", "SET", "resp:key", "other", "NX")
+	c.expect("(nil)", "SET", "resp:missing", "other", "XX")
+	c.expect("+OK", "SET", "resp:key", "other", "XX", "EX", "100")
+	c.expect(":100", "TTL", "resp:key")
+	c.expect(":1", "PERSIST", "resp:key")
+	c.expect(":-1", "TTL", "resp:key")
+	c.expect(":-2", "TTL", "resp:missing")
+	c.expect(":1", "INCR", "resp:counter")
+	c.expect(":11", "INCRBY", "resp:counter", "10")
+	c.expect(":9", "DECRBY", "resp:counter", "2")
+	c.expect("-ERR value is not an integer or out of range", "INCR", "resp:key")
+	c.expect(":2", "EXISTS", "resp:key", "resp:counter", "resp:missing")
+	c.expect("[0 [resp:counter resp:key]]", "SCAN", "0", "MATCH", "resp:*", "COUNT", "100")
+	c.expect("[1 [resp:counter]]", "SCAN", "0", "MATCH", "resp:*", "COUNT", "1")
+	c.expect("[0 [resp:key]]", "SCAN", "1", "MATCH", "resp:*", "COUNT", "1")
+	c.expect(":1", "EXPIRE", "resp:key", "10")
+	c.expect(":2", "DEL", "resp:key", "resp:counter")
+	c.expect("[]", "KEYS", "resp:*")
+	c.expect("-ERR unknown command 'UNKNOWN'", "UNKNOWN")
+	c.expect("-ERR wrong number of arguments for 'get' command", "GET")
+
+	c.expect("[server sider proto :3 mode standalone]", "HELLO", "3")
+	c.expect("(nil)", "GET", "resp:key")
+
+	fmt.Fprintf(c.conn, "PING inline\r\n")
+	if r := c.read(); r != "inline" {
+		t.Fatalf("unexpected inline reply: %s", r)
+	}
+}
+
+func TestRESPValue(t *testing.T) {
+	l, c := respServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+
+	ns := defaultNS()
+	ns.set("resp:json", map[string]interface{}{"a": 1.0}, 0, 0, setNew)
+	ns.set("resp:number", 5.0, 0, 0, setNew)
+	defer cleanup("resp:json")
+	defer cleanup("resp:number")
+
+	c.expect(`{"a":1}`, "GET", "resp:json")
+	c.expect(":6", "INCR", "resp:number")
+	if n, _ := ns.peek("resp:number"); n.data != 6.0 {
+		t.Fatalf("json number type is not preserved: %v", n.data)
+	}
+}
+
+func TestRESPAuth(t *testing.T) {
+	defer withUsers(t, testUsers)()
+	l, c := respServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+
+	c.expect("-NOAUTH Authentication required.", "GET", "app:key")
+	c.expect("-WRONGPASS invalid username-password pair or user is disabled.", "AUTH", "unknown")
+	c.expect("+OK", "AUTH", "reader", "reader")
+	c.expect("(nil)", "GET", "app:key")
+	c.expect("-NOPERM this user has no permissions to access one of the keys used as arguments", "GET", "other")
+	c.expect("-NOPERM this user has no permissions to run the 'set' command", "SET", "app:key", "value")
+}
+
+func TestRESPLimits(t *testing.T) {
+	defer withUsers(t, testUsers)()
+	defer func(n int64) { maxValueSize = n }(maxValueSize)
+	maxValueSize = 1 << 20
+	l, c := respServer(t)
+	defer l.Close()
+	defer c.conn.Close()
+
+	dial := func() *respClient {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return &respClient{t, conn, bufio.NewReader(conn)}
+	}
+	requests := []struct {
+		auth    bool
+		request string
+	}{
+		{false, fmt.Sprintf("*3\r\n$3\r\nSET\r\n$7\r\napp:key\r\n$%d\r\n", maxRESPAuthBulk+1)},
+		{false, fmt.Sprintf("*%d\r\n", maxRESPAuthArray+1)},
+		{false, strings.Repeat("a", maxRESPLine+1) + "\r\n"},
+		{true, fmt.Sprintf("*3\r\n$3\r\nSET\r\n$7\r\napp:key\r\n$%d\r\n", maxValueSize+maxRESPLine+1)},
+	}
+	for _, req := range requests {
+		c := dial()
+		if req.auth {
+			c.expect("+OK", "AUTH", "admin")
+		}
+		fmt.Fprint(c.conn, req.request)
+		if r := c.read(); r != "-ERR Protocol error" {
+			t.Fatalf("%q: unexpected reply: %s", req.request[:16], r)
+		}
+		c.conn.Close()
+	}
+
+	c.expect("+OK", "AUTH", "admin")
+	c.expect("-ERR invalid expire time in 'set' command", "SET", "app:key", "value", "EX", "9223372036854775807")
+	c.expect("+OK", "SET", "app:key", "value")
+	defer cleanup("app:key")
+	c.expect("-ERR invalid expire time in 'expire' command", "EXPIRE", "app:key", "9223372036854775807")
+	c.expect("-ERR invalid expire time in 'pexpire' command", "PEXPIRE", "app:key", "9223372036854775807")
+	c.expect(":-1", "TTL", "app:key")
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	schemaRegistryLock sync.RWMutex
+	schemaRegistry     = make(map[string]*keySchema)
+	// sortedSchemas are registered schemas ordered by name, rebuilt
+	// when schemas change so that writes do not sort them.
+	sortedSchemas = []*keySchema{}
+
+	// annotations are schema keywords not affecting validation.
+	annotations = map[string]bool{
+		"$schema": true, "$id": true, "$comment": true, "title": true,
+		"description": true, "default": true, "examples": true,
+		"readOnly": true, "writeOnly": true, "deprecated": true,
+	}
+)
+
+// keySchema validates values of the keys matching glob pattern in the
+// namespace, empty namespace means all namespaces.
+type keySchema struct {
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace,omitempty"`
+	Pattern   string          `json:"pattern"`
+	Schema    json.RawMessage `json:"schema"`
+	compiled  *schema
+}
+
+// validationError describes why value does not match the schema, path
+// is json pointer to invalid part of the value.
+type validationError struct {
+	Key     string
+	Schema  string
+	Path    string
+	Message string
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.location(), e.Message)
+}
+
+func (e *validationError) location() string {
+	if e.Path == "" {
+		return "/"
+	}
+	return e.Path
+}
+
+type validationErrorResponse struct {
+	errorResponse
+	Schema string `json:"schema"`
+	Path   string `json:"path"`
+}
+
+// schema is compiled subset of JSON Schema, boolean schemas are
+// represented with accept or reject set.
+type schema struct {
+	accept, reject bool
+
+	types    []string
+	enum     []interface{}
+	constant []interface{}
+
+	properties           map[string]*schema
+	required             []string
+	additionalProperties *schema
+	minProperties        *int
+	maxProperties        *int
+
+	items    *schema
+	minItems *int
+	maxItems *int
+	unique   bool
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	allOf []*schema
+	anyOf []*schema
+	oneOf []*schema
+	not   *schema
+}
+
+// compileSchema parses decoded json schema failing on keywords which
+// are not supported.
+func compileSchema(v interface{}) (*schema, error) {
+	if b, ok := v.(bool); ok {
+		return &schema{accept: b, reject: !b}, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema must be an object or boolean")
+	}
+	s := &schema{}
+	keywords := make([]string, 0, len(m))
+	for k := range m {
+		keywords = append(keywords, k)
+	}
+	sort.Strings(keywords)
+	for _, k := range keywords {
+		err := s.compileKeyword(k, m[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *schema) compileKeyword(k string, v interface{}) error {
+	var err error
+	switch k {
+	case "type":
+		switch t := v.(type) {
+		case string:
+			s.types = []string{t}
+		case []interface{}:
+			for _, e := range t {
+				name, ok := e.(string)
+				if !ok {
+					return fmt.Errorf("must be a string or array of strings")
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return fmt.Errorf("must be a string or array of strings")
+		}
+		for _, t := range s.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "integer", "string":
+			default:
+				return fmt.Errorf("unknown type [%s]", t)
+			}
+		}
+	case "enum":
+		a, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("must be an array")
+		}
+		s.enum = a
+	case "const":
+		s.constant = []interface{}{v}
+	case "properties":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("must be an object")
+		}
+		s.properties = make(map[string]*schema)
+		for name, p := range m {
+			s.properties[name], err = compileSchema(p)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	case "required":
+		a, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("must be an array of strings")
+		}
+		for _, e := range a {
+			name, ok := e.(string)
+			if !ok {
+				return fmt.Errorf("must be an array of strings")
+			}
+			s.required = append(s.required, name)
+		}
+	case "additionalProperties":
+		s.additionalProperties, err = compileSchema(v)
+	case "items":
+		s.items, err = compileSchema(v)
+	case "uniqueItems":
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("must be a boolean")
+		}
+		s.unique = b
+	case "minProperties":
+		s.minProperties, err = count(v)
+	case "maxProperties":
+		s.maxProperties, err = count(v)
+	case "minItems":
+		s.minItems, err = count(v)
+	case "maxItems":
+		s.maxItems, err = count(v)
+	case "minLength":
+		s.minLength, err = count(v)
+	case "maxLength":
+		s.maxLength, err = count(v)
+	case "minimum":
+		s.minimum, err = number(v)
+	case "maximum":
+		s.maximum, err = number(v)
+	case "exclusiveMinimum":
+		s.exclusiveMinimum, err = number(v)
+	case "exclusiveMaximum":
+		s.exclusiveMaximum, err = number(v)
+	case "multipleOf":
+		s.multipleOf, err = number(v)
+		if err == nil && *s.multipleOf <= 0 {
+			return fmt.Errorf("must be greater than zero")
+		}
+	case "pattern":
+		p, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		s.pattern, err = regexp.Compile(p)
+	case "allOf":
+		s.allOf, err = compileSchemas(v)
+	case "anyOf":
+		s.anyOf, err = compileSchemas(v)
+	case "oneOf":
+		s.oneOf, err = compileSchemas(v)
+	case "not":
+		s.not, err = compileSchema(v)
+	default:
+		if !annotations[k] {
+			return fmt.Errorf("unsupported keyword")
+		}
+	}
+	return err
+}
+
+func compileSchemas(v interface{}) ([]*schema, error) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) == 0 {
+		return nil, fmt.Errorf("must be a non empty array")
+	}
+	schemas := make([]*schema, len(a))
+	for i, e := range a {
+		var err error
+		schemas[i], err = compileSchema(e)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", i, err)
+		}
+	}
+	return schemas, nil
+}
+
+func count(v interface{}) (*int, error) {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("must be a non negative integer")
+	}
+	n := int(f)
+	return &n, nil
+}
+
+func number(v interface{}) (*float64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return &f, nil
+}
+
+func typeOf(v interface{}) string {
+	switch d := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if d == math.Trunc(d) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// validate checks value at json pointer p returning first violation.
+func (s *schema) validate(v interface{}, p string) *validationError {
+	fail := func(format string, args ...interface{}) *validationError {
+		return &validationError{Path: p, Message: fmt.Sprintf(format, args...)}
+	}
+	switch {
+	case s.accept:
+		return nil
+	case s.reject:
+		return fail("value is not allowed")
+	}
+	t := typeOf(v)
+	if len(s.types) > 0 {
+		ok := false
+		for _, expected := range s.types {
+			if expected == t || expected == "number" && t == "integer" {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fail("expected %s, got %s", strings.Join(s.types, " or "), t)
+		}
+	}
+	if s.enum != nil && !contains(s.enum, v) {
+		return fail("value is not one of enumerated values")
+	}
+	if s.constant != nil && !reflect.DeepEqual(s.constant[0], v) {
+		return fail("value is not equal to constant")
+	}
+	switch d := v.(type) {
+	case map[string]interface{}:
+		if err := s.validateObject(d, p); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := s.validateArray(d, p); err != nil {
+			return err
+		}
+	case float64:
+		if err := s.validateNumber(d, p); err != nil {
+			return err
+		}
+	case string:
+		n := utf8.RuneCountInString(d)
+		switch {
+		case s.minLength != nil && n < *s.minLength:
+			return fail("string is shorter than %d", *s.minLength)
+		case s.maxLength != nil && n > *s.maxLength:
+			return fail("string is longer than %d", *s.maxLength)
+		case s.pattern != nil && !s.pattern.MatchString(d):
+			return fail("string does not match pattern [%s]", s.pattern)
+		}
+	}
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, p); err != nil {
+			return err
+		}
+	}
+	if s.anyOf != nil {
+		var first *validationError
+		for _, sub := range s.anyOf {
+			err := sub.validate(v, p)
+			if err == nil {
+				first = nil
+				break
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		if first != nil {
+			return fail("value does not match any schema of anyOf, first: %v", first)
+		}
+	}
+	if s.oneOf != nil {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, p) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fail("value matches %d schemas of oneOf instead of one", matched)
+		}
+	}
+	if s.not != nil && s.not.validate(v, p) == nil {
+		return fail("value must not match schema of not")
+	}
+	return nil
+}
+
+func (s *schema) validateObject(o map[string]interface{}, p string) *validationError {
+	for _, name := range s.required {
+		if _, ok := o[name]; !ok {
+			return &validationError{Path: p, Message: fmt.Sprintf("missing required property [%s]", name)}
+		}
+	}
+	if s.minProperties != nil && len(o) < *s.minProperties {
+		return &validationError{Path: p, Message: fmt.Sprintf("object has less than %d properties", *s.minProperties)}
+	}
+	if s.maxProperties != nil && len(o) > *s.maxProperties {
+		return &validationError{Path: p, Message: fmt.Sprintf("object has more than %d properties", *s.maxProperties)}
+	}
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub, ok := s.properties[name]
+		if !ok {
+			sub = s.additionalProperties
+		}
+		if sub == nil {
+			continue
+		}
+		if !ok && sub.reject {
+			return &validationError{Path: p, Message: fmt.Sprintf("additional property [%s] is not allowed", name)}
+		}
+		if err := sub.validate(o[name], p+"/"+escapePointer(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *schema) validateArray(a []interface{}, p string) *validationError {
+	switch {
+	case s.minItems != nil && len(a) < *s.minItems:
+		return &validationError{Path: p, Message: fmt.Sprintf("array has less than %d items", *s.minItems)}
+	case s.maxItems != nil && len(a) > *s.maxItems:
+		return &validationError{Path: p, Message: fmt.Sprintf("array has more than %d items", *s.maxItems)}
+	}
+	if s.unique {
+		for i := range a {
+			if contains(a[:i], a[i]) {
+				return &validationError{Path: fmt.Sprintf("%s/%d", p, i), Message: "array items are not unique"}
+			}
+		}
+	}
+	if s.items == nil {
+		return nil
+	}
+	for i, e := range a {
+		if err := s.items.validate(e, fmt.Sprintf("%s/%d", p, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *schema) validateNumber(f float64, p string) *validationError {
+	fail := func(format string, args ...interface{}) *validationError {
+		return &validationError{Path: p, Message: fmt.Sprintf(format, args...)}
+	}
+	switch {
+	case s.minimum != nil && f < *s.minimum:
+		return fail("number is less than %v", *s.minimum)
+	case s.maximum != nil && f > *s.maximum:
+		return fail("number is greater than %v", *s.maximum)
+	case s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum:
+		return fail("number is not greater than %v", *s.exclusiveMinimum)
+	case s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum:
+		return fail("number is not less than %v", *s.exclusiveMaximum)
+	case s.multipleOf != nil:
+		q := f / *s.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			return fail("number is not a multiple of %v", *s.multipleOf)
+		}
+	}
+	return nil
+}
+
+func contains(values []interface{}, v interface{}) bool {
+	for _, e := range values {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks value of the key against schemas registered for the
+// key in namespace.
+func validate(ns string, key string, data interface{}) error {
+	schemaRegistryLock.RLock()
+	defer schemaRegistryLock.RUnlock()
+	for _, ks := range sortedSchemas {
+		if ks.Namespace != "" && ks.Namespace != ns {
+			continue
+		}
+		if ok, _ := path.Match(ks.Pattern, key); !ok {
+			continue
+		}
+		if _, ok := data.(*raw); ok {
+			return &validationError{Key: key, Schema: ks.Name, Message: "raw value is not json"}
+		}
+		if err := ks.compiled.validate(data, ""); err != nil {
+			err.Key, err.Schema = key, ks.Name
+			return err
+		}
+	}
+	return nil
+}
+
+// sortSchemas rebuilds sorted schemas, must be called with registry
+// write lock held.
+func sortSchemas() {
+	list := make([]*keySchema, 0, len(schemaRegistry))
+	for _, ks := range schemaRegistry {
+		list = append(list, ks)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	sortedSchemas = list
+}
+
+func registerSchema(ks *keySchema) error {
+	if _, err := path.Match(ks.Pattern, ""); err != nil || ks.Pattern == "" {
+		return fmt.Errorf("bad pattern [%s]", ks.Pattern)
+	}
+	var v interface{}
+	err := json.Unmarshal(ks.Schema, &v)
+	if err != nil {
+		return fmt.Errorf("parse schema: %v", err)
+	}
+	ks.compiled, err = compileSchema(v)
+	if err != nil {
+		return fmt.Errorf("compile schema: %v", err)
+	}
+	schemaRegistryLock.Lock()
+	defer schemaRegistryLock.Unlock()
+	schemaRegistry[ks.Name] = ks
+	sortSchemas()
+	log.Printf("Register schema: [%s] for [%s].\n", ks.Name, ks.Pattern)
+	return nil
+}
+
+func lookupSchema(name string) (*keySchema, bool) {
+	schemaRegistryLock.RLock()
+	defer schemaRegistryLock.RUnlock()
+	ks, ok := schemaRegistry[name]
+	return ks, ok
+}
+
+func removeSchema(name string) bool {
+	schemaRegistryLock.Lock()
+	defer schemaRegistryLock.Unlock()
+	_, ok := schemaRegistry[name]
+	delete(schemaRegistry, name)
+	sortSchemas()
+	return ok
+}
+
+// restoreSchema registers schema from dump record, existing schema is
+// replaced only with setAlways mode.
+func restoreSchema(rec *record, mode setMode) (int, error) {
+	if rec.Key == "" || strings.Contains(rec.Key, "/") {
+		return http.StatusBadRequest, fmt.Errorf("bad schema name [%s]", rec.Key)
+	}
+	var ks keySchema
+	if err := json.Unmarshal(rec.Value, &ks); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("parse value: %v", err)
+	}
+	ks.Name = rec.Key
+	if _, ok := lookupSchema(ks.Name); ok && mode == setNew {
+		return http.StatusConflict, errExists
+	}
+	if err := registerSchema(&ks); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("schema [%s]: %v", ks.Name, err)
+	}
+	return http.StatusOK, nil
+}
+
+// validationFailed replies with 422 and json pointer to invalid part of
+// the value.
+func validationFailed(w http.ResponseWriter, err *validationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(validationErrorResponse{
+		errorResponse: errorResponse{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("Value of key [%s] does not match schema [%s]: %v.", err.Key, err.Schema, err),
+		},
+		Schema: err.Schema,
+		Path:   err.Path,
+	})
+}
+
+func schemaName(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/admin/schemas/")
+}
+
+func listSchemas(w http.ResponseWriter, r *http.Request) {
+	schemaRegistryLock.RLock()
+	defer schemaRegistryLock.RUnlock()
+	json.NewEncoder(w).Encode(sortedSchemas)
+}
+
+func getSchema(w http.ResponseWriter, r *http.Request) {
+	name := schemaName(r)
+	ks, ok := lookupSchema(name)
+	if !ok {
+		httpError(w, fmt.Sprintf("Schema [%s] not found.", name), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(ks)
+}
+
+// putSchema registers or replaces schema validating values of keys
+// matching pattern, existing keys are not validated.
+func putSchema(w http.ResponseWriter, r *http.Request) {
+	name := schemaName(r)
+	if name == "" || strings.Contains(name, "/") {
+		httpError(w, fmt.Sprintf("Bad schema name [%s].", name), http.StatusBadRequest)
+		return
+	}
+	var ks keySchema
+	err := json.NewDecoder(r.Body).Decode(&ks)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Parse request: %v", err), http.StatusBadRequest)
+		return
+	}
+	ks.Name = name
+	err = registerSchema(&ks)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Schema [%s]: %v.", name, err), http.StatusBadRequest)
+		return
+	}
+}
+
+func deleteSchema(w http.ResponseWriter, r *http.Request) {
+	name := schemaName(r)
+	if !removeSchema(name) {
+		httpError(w, fmt.Sprintf("Schema [%s] not found.", name), http.StatusNotFound)
+		return
+	}
+	log.Printf("Remove schema: [%s].\n", name)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"roles": {"type": "array", "items": {"enum": ["admin", "user"]}, "uniqueItems": true},
+		"address": {
+			"type": "object",
+			"properties": {"zip": {"type": "string"}},
+			"additionalProperties": false
+		}
+	}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	var v interface{}
+	json.Unmarshal([]byte(userSchema), &v)
+	s, err := compileSchema(v)
+	if err != nil {
+		t.Fatalf("compile schema: %v", err)
+	}
+	for value, path := range map[string]string{
+		`{"name": "a", "age": 1, "roles": ["admin"], "address": {"zip": "1"}}`: "-",
+		`[]`:                                                 "",
+		`{"name": "a"}`:                                      "",
+		`{"name": "", "age": 1}`:                             "/name",
+		`{"name": "a", "age": 1.5}`:                          "/age",
+		`{"name": "a", "age": -1}`:                           "/age",
+		`{"name": "a", "age": 1, "email": "x"}`:              "/email",
+		`{"name": "a", "age": 1, "roles": ["root"]}`:         "/roles/0",
+		`{"name": "a", "age": 1, "roles": ["user", "user"]}`: "/roles/1",
+		`{"name": "a", "age": 1, "address": {"zip": 1}}`:     "/address/zip",
+		`{"name": "a", "age": 1, "address": {"city": "x"}}`:  "/address",
+	} {
+		var data interface{}
+		json.Unmarshal([]byte(value), &data)
+		err := s.validate(data, "")
+		switch {
+		case path == "-" && err != nil:
+			t.Fatalf("valid value %s is rejected: %v", value, err)
+		case path != "-" && err == nil:
+			t.Fatalf("invalid value %s is accepted", value)
+		case path != "-" && err.Path != path:
+			t.Fatalf("unexpected path of %s: %v", value, err)
+		}
+	}
+
+	for _, schema := range []string{`1`, `{"type": "text"}`, `{"$ref": "#/definitions/x"}`, `{"minLength": -1}`, `{"pattern": "("}`, `{"anyOf": []}`} {
+		json.Unmarshal([]byte(schema), &v)
+		if _, err := compileSchema(v); err == nil {
+			t.Fatalf("bad schema is compiled: %s", schema)
+		}
+	}
+	json.Unmarshal([]byte(`{"oneOf": [{"type": "number"}, {"type": "integer"}], "not": {"const": 0}}`), &v)
+	s, _ = compileSchema(v)
+	for value, valid := range map[float64]bool{1.5: true, 1: false, 0: false} {
+		if err := s.validate(value, ""); (err == nil) != valid {
+			t.Fatalf("unexpected validation of %v: %v", value, err)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	prefix := uuid.New()
+	name := uuid.New()
+	err := cl.PutSchema(ctx, &client.Schema{Name: name, Pattern: prefix + ":*", Schema: json.RawMessage(userSchema)})
+	if err != nil {
+		t.Fatalf("put schema: %v", err)
+	}
+	defer cl.DeleteSchema(ctx, name)
+	if err := cl.PutSchema(ctx, &client.Schema{Name: uuid.New(), Pattern: "*", Schema: json.RawMessage(`{"type": "str"}`)}); err == nil {
+		t.Fatalf("bad schema is registered")
+	}
+
+	key := prefix + ":1"
+	defer cleanup(key)
+	err = cl.Set(ctx, key, strings.NewReader(`{"name": "a", "age": 1, "address": {"zip": 1}}`), 0)
+	var e *client.Error
+	if !errors.Is(err, client.ErrInvalidValue) || !errors.As(err, &e) || e.Path != "/address/zip" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Set(ctx, key, strings.NewReader(`{"name": "a", "age": 1}`), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	other := uuid.New()
+	defer cleanup(other)
+	if err := cl.Set(ctx, other, strings.NewReader(`1`), 0); err != nil {
+		t.Fatalf("value of key not matching pattern is validated: %v", err)
+	}
+	if _, err := cl.ListPush(ctx, prefix+":3", strings.NewReader(`1`)); !errors.Is(err, client.ErrInvalidValue) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Copy(ctx, other, prefix+":2", 0); !errors.Is(err, client.ErrInvalidValue) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = cl.Eval(ctx, `sider.set(KEYS[1], {name = "b"})`, []string{key}, nil, nil)
+	if !errors.Is(err, client.ErrInvalidValue) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	schemas, err := cl.Schemas(ctx)
+	if err != nil {
+		t.Fatalf("schemas: %v", err)
+	}
+	if len(schemas) != 1 || schemas[0].Name != name || schemas[0].Pattern != prefix+":*" {
+		t.Fatalf("unexpected schemas: %+v", schemas)
+	}
+	if err := cl.DeleteSchema(ctx, name); err != nil {
+		t.Fatalf("delete schema: %v", err)
+	}
+	if _, err := cl.Schema(ctx, name); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Put(ctx, key, strings.NewReader(`1`), 0); err != nil {
+		t.Fatalf("value is validated by deleted schema: %v", err)
+	}
+}
+
+func TestSchemaDumpRestore(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	prefix := uuid.New()
+	name := uuid.New()
+	key := prefix + ":1"
+	defer cleanup(key)
+	cl.Set(ctx, key, strings.NewReader(`1`), 0)
+	err := cl.PutSchema(ctx, &client.Schema{Name: name, Pattern: prefix + ":*", Schema: json.RawMessage(userSchema)})
+	if err != nil {
+		t.Fatalf("put schema: %v", err)
+	}
+	defer cl.DeleteSchema(ctx, name)
+
+	var buf bytes.Buffer
+	if err := cl.Dump(ctx, &buf); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"key":"`+name+`","type":"schema"`) {
+		t.Fatalf("schema is not dumped: %s", buf.String())
+	}
+	cl.DeleteSchema(ctx, name)
+	cl.Del(ctx, key)
+
+	dump := buf.String()
+	if _, err := cl.Restore(ctx, strings.NewReader(dump), client.RestoreSkip); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if !stored(key) {
+		t.Fatalf("key not matching schema is not restored")
+	}
+	ks, err := cl.Schema(ctx, name)
+	if err != nil || ks.Pattern != prefix+":*" {
+		t.Fatalf("schema is not restored: %+v, %v", ks, err)
+	}
+	if err := cl.Set(ctx, prefix+":2", strings.NewReader(`1`), 0); !errors.Is(err, client.ErrInvalidValue) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := cl.Restore(ctx, strings.NewReader(dump), client.RestoreFail); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxScriptDepth = 64
+	maxScriptSize  = 64 << 10
+
+	// scripts can not recurse deeper than call stack size and use more
+	// than registry max size stack slots.
+	scriptCallStackSize   = 200
+	scriptRegistrySize    = 1 << 12
+	scriptRegistryMaxSize = 1 << 14
+)
+
+var (
+	scriptTimeout time.Duration
+
+	// maxScripts is number of cached scripts, least recently used
+	// scripts are evicted.
+	maxScripts = 1000
+
+	scriptLock sync.Mutex
+	scripts    = make(map[string]*cachedScript)
+	// scriptClock orders uses of cached scripts.
+	scriptClock uint64
+
+	errScriptTimeout  = errors.New("script time limit exceeded")
+	errScriptTooLarge = errors.New("script is too large")
+
+	// unsafeBuiltins are removed from base library of the scripts.
+	unsafeBuiltins = []string{"dofile", "loadfile", "load", "loadstring", "print", "require", "module"}
+)
+
+type evalRequest struct {
+	Script string        `json:"script"`
+	SHA    string        `json:"sha"`
+	Keys   []string      `json:"keys"`
+	Args   []interface{} `json:"args"`
+}
+
+type loadScriptResult struct {
+	SHA string `json:"sha"`
+}
+
+type cachedScript struct {
+	proto *lua.FunctionProto
+	used  uint64
+}
+
+// scriptSHA returns hex encoded sha1 of the script source.
+func scriptSHA(source string) string {
+	sum := sha1.Sum([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadScript compiles the script and caches it by sha evicting least
+// recently used script when cache is full.
+func loadScript(source string) (string, *lua.FunctionProto, error) {
+	if len(source) > maxScriptSize {
+		return "", nil, errScriptTooLarge
+	}
+	sha := scriptSHA(source)
+	if proto, ok := lookupScript(sha); ok {
+		return sha, proto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(source), sha)
+	if err != nil {
+		return "", nil, err
+	}
+	proto, err := lua.Compile(chunk, sha)
+	if err != nil {
+		return "", nil, err
+	}
+	scriptLock.Lock()
+	if _, ok := scripts[sha]; !ok {
+		for len(scripts) >= maxScripts {
+			var lru string
+			for s, c := range scripts {
+				if lru == "" || c.used < scripts[lru].used {
+					lru = s
+				}
+			}
+			delete(scripts, lru)
+		}
+	}
+	scriptClock++
+	scripts[sha] = &cachedScript{proto: proto, used: scriptClock}
+	scriptLock.Unlock()
+	log.Printf("Load script: [%s].\n", sha)
+	return sha, proto, nil
+}
+
+func lookupScript(sha string) (*lua.FunctionProto, bool) {
+	scriptLock.Lock()
+	defer scriptLock.Unlock()
+	c, ok := scripts[strings.ToLower(sha)]
+	if !ok {
+		return nil, false
+	}
+	scriptClock++
+	c.used = scriptClock
+	return c.proto, true
+}
+
+func flushScripts() {
+	scriptLock.Lock()
+	defer scriptLock.Unlock()
+	scripts = make(map[string]*cachedScript)
+	log.Println("Flush scripts.")
+}
+
+// scriptWrite is a change of the key made by the script, nil node
+// means key is deleted.
+type scriptWrite struct {
+	n   *node
+	ttl time.Duration
+}
+
+// scriptRun executes the script against the namespace, changes are
+// kept aside and applied only if script succeeds.
+type scriptRun struct {
+	ns     *namespace
+	state  *lua.LState
+	keys   map[string]bool
+	writes map[string]*scriptWrite
+	order  []string
+	// object is metatable of tables decoded from json objects so that
+	// empty objects are not encoded as arrays.
+	object *lua.LTable
+}
+
+// eval runs the script with write locks of the declared keys shards
+// held so that it is atomic, script can only access keys it declares.
+func (ns *namespace) eval(ctx context.Context, proto *lua.FunctionProto, keys []string, args []interface{}) (interface{}, error) {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   scriptCallStackSize,
+		RegistrySize:    scriptRegistrySize,
+		RegistryMaxSize: scriptRegistryMaxSize,
+	})
+	defer L.Close()
+	run := &scriptRun{ns: ns, state: L, keys: make(map[string]bool), writes: make(map[string]*scriptWrite), object: L.NewTable()}
+	run.open()
+	keysTable := L.NewTable()
+	for _, key := range keys {
+		run.keys[key] = true
+		keysTable.Append(lua.LString(key))
+	}
+	L.SetGlobal("KEYS", keysTable)
+	argsTable := L.NewTable()
+	for _, arg := range args {
+		argsTable.Append(run.toLua(arg))
+	}
+	L.SetGlobal("ARGV", argsTable)
+
+	unlock := ns.lockKeys(keys...)
+	defer unlock()
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(proto))
+	err := L.PCall(0, 1, nil)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, errScriptTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	result, err := run.fromLua(L.Get(-1), 0)
+	if err != nil {
+		return nil, fmt.Errorf("result: %v", err)
+	}
+	err = run.commit()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// open loads safe subset of standard libraries and sider module.
+func (run *scriptRun) open() {
+	L := run.state
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeBuiltins {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.GetGlobal(lua.StringLibName).(*lua.LTable).RawSetString("rep", L.NewFunction(run.rep))
+	L.SetGlobal("sider", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":  run.get,
+		"set":  run.set,
+		"del":  run.del,
+		"ttl":  run.ttl,
+		"time": run.time,
+	}))
+}
+
+// rep is string.rep limited to value size so that one call can not
+// exhaust memory.
+func (run *scriptRun) rep(L *lua.LState) int {
+	s := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n <= 0 || s == "" {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	limit := maxValueSize
+	if limit <= 0 {
+		limit = defaultMaxValueSize
+	}
+	if int64(n) > limit/int64(len(s)) {
+		L.RaiseError("string is too large")
+	}
+	L.Push(lua.LString(strings.Repeat(s, n)))
+	return 1
+}
+
+// key returns key argument failing if script did not declare it.
+func (run *scriptRun) key(L *lua.LState) string {
+	key := L.CheckString(1)
+	if !run.keys[key] {
+		L.RaiseError("key [%s] is not declared", key)
+	}
+	return key
+}
+
+// lookup returns current node of the key taking changes of the script
+// into account.
+func (run *scriptRun) lookup(key string) (*node, time.Duration, bool) {
+	if w, ok := run.writes[key]; ok {
+		return w.n, w.ttl, w.n != nil
+	}
+	n, ok := run.ns.find(key)
+	if !ok {
+		return nil, 0, false
+	}
+	return n, n.remaining(), true
+}
+
+func (run *scriptRun) write(key string, n *node, ttl time.Duration) {
+	if _, ok := run.writes[key]; !ok {
+		run.order = append(run.order, key)
+	}
+	run.writes[key] = &scriptWrite{n: n, ttl: ttl}
+}
+
+// get returns value of the key or nil.
+func (run *scriptRun) get(L *lua.LState) int {
+	key := run.key(L)
+	n, _, ok := run.lookup(key)
+	if ok {
+		atomic.AddUint64(&run.ns.counters.Hits, 1)
+		L.Push(run.toLua(n.value()))
+	} else {
+		atomic.AddUint64(&run.ns.counters.Misses, 1)
+		L.Push(lua.LNil)
+	}
+	return 1
+}
+
+// set stores value of the key with optional time to live in
+// milliseconds.
+func (run *scriptRun) set(L *lua.LState) int {
+	key := run.key(L)
+	data, err := run.fromLua(L.CheckAny(2), 0)
+	if err != nil {
+		L.RaiseError("value: %v", err)
+	}
+	ttl := time.Duration(L.OptNumber(3, 0)) * time.Millisecond
+	if ttl < 0 {
+		L.RaiseError("negative ttl")
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		L.RaiseError("value: %v", err)
+	}
+	run.write(key, &node{data: data, size: int64(len(key) + len(b))}, ttl)
+	return 0
+}
+
+// del removes the key and returns true if it existed.
+func (run *scriptRun) del(L *lua.LState) int {
+	key := run.key(L)
+	_, _, ok := run.lookup(key)
+	if ok {
+		run.write(key, nil, 0)
+	}
+	L.Push(lua.LBool(ok))
+	return 1
+}
+
+// ttl returns remaining time to live of the key in milliseconds, zero
+// means key does not expire and nil means key does not exist.
+func (run *scriptRun) ttl(L *lua.LState) int {
+	key := run.key(L)
+	_, ttl, ok := run.lookup(key)
+	if !ok {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(lua.LNumber(math.Ceil(float64(ttl) / float64(time.Millisecond))))
+	return 1
+}
+
+// time returns current unix time in milliseconds.
+func (run *scriptRun) time(L *lua.LState) int {
+	L.Push(lua.LNumber(time.Now().UnixNano() / int64(time.Millisecond)))
+	return 1
+}
+
+// commit applies changes of the script, must be called with write
+// locks of the key shards held.
+func (run *scriptRun) commit() error {
+	ns := run.ns
+	var delta int64
+	for key, w := range run.writes {
+		if n, ok := ns.find(key); ok {
+			delta -= n.size
+		}
+		if w.n != nil {
+			delta += w.n.size
+		}
+	}
+	if !ns.reserveMemory(delta) {
+		return errMemoryLimit
+	}
+	defer ns.releaseMemory(delta)
+	for _, key := range run.order {
+		if w := run.writes[key]; w.n != nil {
+			if err := checkLimits(key, w.n.size-int64(len(key))); err != nil {
+				return err
+			}
+			if err := validate(ns.name, key, w.n.data); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range run.order {
+		w := run.writes[key]
+		_, existed := ns.remove(key)
+		switch {
+		case w.n != nil:
+			ns.insert(key, w.n, w.ttl)
+			atomic.AddUint64(&ns.counters.Sets, 1)
+			ns.notify(eventSet, key)
+		case existed:
+			atomic.AddUint64(&ns.counters.Dels, 1)
+			ns.notify(eventDel, key)
+		}
+	}
+	return nil
+}
+
+// toLua converts decoded json value to lua value.
+func (run *scriptRun) toLua(v interface{}) lua.LValue {
+	L := run.state
+	switch v := v.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case *raw:
+		return lua.LString(v.data)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, e := range v {
+			t.Append(run.toLua(e))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for k, e := range v {
+			t.RawSetString(k, run.toLua(e))
+		}
+		t.Metatable = run.object
+		return t
+	}
+	return lua.LNil
+}
+
+// fromLua converts lua value to json value, tables with keys 1..n are
+// arrays and other tables are objects.
+func (run *scriptRun) fromLua(v lua.LValue, depth int) (interface{}, error) {
+	if depth > maxScriptDepth {
+		return nil, errors.New("value is nested too deep")
+	}
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("number is not finite")
+		}
+		return f, nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LTable:
+		n := v.MaxN()
+		if n > 0 && n == countKeys(v) {
+			a := make([]interface{}, n)
+			for i := 1; i <= n; i++ {
+				e, err := run.fromLua(v.RawGetInt(i), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				a[i-1] = e
+			}
+			return a, nil
+		}
+		if n == 0 && v.Metatable != run.object && countKeys(v) == 0 {
+			return []interface{}{}, nil
+		}
+		o := make(map[string]interface{})
+		var err error
+		v.ForEach(func(k lua.LValue, e lua.LValue) {
+			if err != nil {
+				return
+			}
+			switch k.(type) {
+			case lua.LString, lua.LNumber:
+			default:
+				err = fmt.Errorf("unsupported key type: %s", k.Type())
+				return
+			}
+			o[k.String()], err = run.fromLua(e, depth+1)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return o, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %s", v.Type())
+}
+
+func countKeys(t *lua.LTable) int {
+	n := 0
+	t.ForEach(func(lua.LValue, lua.LValue) {
+		n++
+	})
+	return n
+}
+
+// evalHandler executes script given by source or by sha of previously
+// loaded script with keys and json arguments.
+func evalHandler(w http.ResponseWriter, r *http.Request) {
+	var req evalRequest
+	if _, ok := decodeValue(w, r, &req); !ok {
+		return
+	}
+	ns := namespaceOf(r)
+	for _, key := range req.Keys {
+		if key == "" {
+			httpError(w, "Empty key.", http.StatusBadRequest)
+			return
+		}
+		if !permitted(r, opWrite, ns.name, key) {
+			httpError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+	}
+	var proto *lua.FunctionProto
+	switch {
+	case req.Script != "":
+		var err error
+		req.SHA, proto, err = loadScript(req.Script)
+		if err == errScriptTooLarge {
+			httpError(w, fmt.Sprintf("Script size exceeds limit [%d] bytes.", maxScriptSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			httpError(w, fmt.Sprintf("Compile script: %v", err), http.StatusBadRequest)
+			return
+		}
+	case req.SHA != "":
+		var ok bool
+		proto, ok = lookupScript(req.SHA)
+		if !ok {
+			httpError(w, fmt.Sprintf("Script [%s] not found.", req.SHA), http.StatusNotFound)
+			return
+		}
+	default:
+		httpError(w, "Missing script or sha.", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), scriptTimeout)
+	defer cancel()
+	result, err := ns.eval(ctx, proto, req.Keys, req.Args)
+	if ve, ok := err.(*validationError); ok {
+		validationFailed(w, ve)
+		return
+	}
+	switch err {
+	case nil:
+	case errScriptTimeout:
+		httpError(w, fmt.Sprintf("Script [%s] time limit [%v] exceeded.", req.SHA, scriptTimeout), http.StatusServiceUnavailable)
+		return
+	case errKeyTooLong, errValueTooLarge:
+		limitExceeded(w, err)
+		return
+	case errMemoryLimit:
+		httpError(w, fmt.Sprintf("Namespace [%s] memory limit exceeded.", ns.name), http.StatusInsufficientStorage)
+		return
+	default:
+		httpError(w, fmt.Sprintf("Script [%s]: %v", req.SHA, err), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+	log.Printf("Eval: [%s].\n", req.SHA)
+}
+
+// loadScriptHandler compiles script sent as request body and caches it
+// by sha for eval.
+func loadScriptHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxScriptSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		httpError(w, fmt.Sprintf("Script size exceeds limit [%d] bytes.", maxScriptSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		httpError(w, fmt.Sprintf("Read request: %v", err), http.StatusBadRequest)
+		return
+	}
+	sha, _, err := loadScript(string(b))
+	if err != nil {
+		httpError(w, fmt.Sprintf("Compile script: %v", err), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(loadScriptResult{SHA: sha})
+}
+
+func flushScriptsHandler(w http.ResponseWriter, r *http.Request) {
+	flushScripts()
+}
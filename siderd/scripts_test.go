@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const slidingWindow = `
+local now = sider.time()
+local hits = sider.get(KEYS[1]) or {}
+local recent = {}
+for _, t in ipairs(hits) do
+	if t > now - ARGV[2] then
+		table.insert(recent, t)
+	end
+end
+if #recent >= ARGV[1] then
+	return false
+end
+table.insert(recent, now)
+sider.set(KEYS[1], recent, ARGV[2])
+return true
+`
+
+func TestEval(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	for i := 0; i < 4; i++ {
+		var allowed bool
+		err := cl.Eval(ctx, slidingWindow, []string{key}, []interface{}{3, 60000}, &allowed)
+		if err != nil {
+			t.Fatalf("eval: %v", err)
+		}
+		if allowed != (i < 3) {
+			t.Fatalf("unexpected result of call %d: %v", i, allowed)
+		}
+	}
+	var hits []float64
+	if err := cl.GetInto(ctx, key, &hits); err != nil || len(hits) != 3 {
+		t.Fatalf("unexpected value: %v, %v", hits, err)
+	}
+	ttl, ok := defaultNS().ttl(key)
+	if !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("unexpected ttl: %v", ttl)
+	}
+
+	var result map[string]interface{}
+	cl.Put(ctx, key, strings.NewReader(`{"empty": {}}`), 0)
+	err := cl.Eval(ctx, `return {name = ARGV[1], empty = sider.get(KEYS[1]).empty, list = {1, 2}}`, []string{key}, []interface{}{"x"}, &result)
+	if err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+	if result["name"] != "x" || len(result["list"].([]interface{})) != 2 {
+		t.Fatalf("unexpected result: %v", result)
+	}
+	if _, ok := result["empty"].(map[string]interface{}); !ok {
+		t.Fatalf("empty object is not kept: %v", result)
+	}
+}
+
+func TestEvalSHA(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	script := `return ARGV[1] + ARGV[2]`
+	if err := cl.EvalSHA(ctx, scriptSHA(script), nil, nil, nil); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sha, err := cl.LoadScript(ctx, script)
+	if err != nil {
+		t.Fatalf("load script: %v", err)
+	}
+	var sum int
+	if err := cl.EvalSHA(ctx, sha, nil, []interface{}{1, 2}, &sum); err != nil || sum != 3 {
+		t.Fatalf("unexpected result: %d, %v", sum, err)
+	}
+	if _, err := cl.LoadScript(ctx, `return (`); err == nil {
+		t.Fatalf("script with syntax error is loaded")
+	}
+	if err := cl.FlushScripts(ctx); err != nil {
+		t.Fatalf("flush scripts: %v", err)
+	}
+	if _, ok := lookupScript(sha); ok {
+		t.Fatalf("script is not flushed")
+	}
+}
+
+func TestEvalAtomic(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key, other := uuid.New(), uuid.New()
+	defer cleanup(key)
+	defer cleanup(other)
+	cl.Set(ctx, key, strings.NewReader(`1`), 0)
+	err := cl.Eval(ctx, `sider.set(KEYS[1], 2); sider.del(KEYS[2]); error("failed")`, []string{key, other}, nil, nil)
+	var e *client.Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var v int
+	if err := cl.GetInto(ctx, key, &v); err != nil || v != 1 {
+		t.Fatalf("changes of failed script are applied: %d, %v", v, err)
+	}
+	if err := cl.Eval(ctx, `return sider.get(KEYS[1])`, []string{key}, nil, nil); err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+	if err := cl.Eval(ctx, `return sider.get(ARGV[1])`, nil, []interface{}{key}, nil); err == nil {
+		t.Fatalf("undeclared key is accessed")
+	}
+	for _, script := range []string{`dofile("/etc/passwd")`, `load("return 1")`, `os.exit(1)`, `io.write("x")`} {
+		if err := cl.Eval(ctx, script, nil, nil, nil); err == nil {
+			t.Fatalf("unsafe script is executed: %s", script)
+		}
+	}
+}
+
+func TestEvalTimeout(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	defer func(d time.Duration) { scriptTimeout = d }(scriptTimeout)
+	scriptTimeout = 50 * time.Millisecond
+	key := uuid.New()
+	defer cleanup(key)
+	start := time.Now()
+	err := cl.Eval(ctx, `sider.set(KEYS[1], 1); while true do end`, []string{key}, nil, nil)
+	var e *client.Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("script is not interrupted")
+	}
+	if ok, _ := cl.Exists(ctx, key); ok {
+		t.Fatalf("changes of interrupted script are applied")
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	for _, script := range []string{
+		`local function f(n) return f(n + 1) + 1 end return f(1)`,
+		`local t = {} for i = 1, 20000 do t[i] = i end return unpack(t)`,
+		`return #string.rep("a", 1073741824)`,
+		`return #("ab"):rep(1073741824)`,
+	} {
+		if err := cl.Eval(ctx, script, nil, nil, nil); err == nil {
+			t.Fatalf("script exceeding limits succeeded: %s", script)
+		}
+	}
+	var n int
+	if err := cl.Eval(ctx, `return #string.rep("a", 1000)`, nil, nil, &n); err != nil || n != 1000 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+
+	large := "return 1" + strings.Repeat(" ", maxScriptSize)
+	if _, err := cl.LoadScript(ctx, large); !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("large script is loaded: %v", err)
+	}
+	if err := cl.Eval(ctx, large, nil, nil, nil); !errors.Is(err, client.ErrTooLarge) {
+		t.Fatalf("large script is evaluated: %v", err)
+	}
+
+	defer func(n int) { maxScripts = n }(maxScripts)
+	maxScripts = 2
+	first, _ := cl.LoadScript(ctx, `return 1`)
+	second, _ := cl.LoadScript(ctx, `return 2`)
+	lookupScript(first)
+	cl.LoadScript(ctx, `return 3`)
+	if _, ok := lookupScript(second); ok {
+		t.Fatalf("least recently used script is not evicted")
+	}
+	if _, ok := lookupScript(first); !ok {
+		t.Fatalf("recently used script is evicted")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultShards = 32
+
+// shardCount is number of shards of namespaces created after it is set.
+var shardCount = defaultShards
+
+// shard is independently locked part of namespace key space, keys are
+// distributed among shards by hash.
+type shard struct {
+	lock    sync.RWMutex
+	storage map[string]*node
+	waiters map[string]*waiter
+}
+
+func newShards(n int) []*shard {
+	if n <= 0 {
+		n = 1
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{storage: make(map[string]*node), waiters: make(map[string]*waiter)}
+	}
+	return shards
+}
+
+// shardIndex returns shard of the key by FNV-1a hash.
+func (ns *namespace) shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(ns.shards)))
+}
+
+func (ns *namespace) shard(key string) *shard {
+	return ns.shards[ns.shardIndex(key)]
+}
+
+// find returns node of the key, must be called with lock of the key
+// shard held.
+func (ns *namespace) find(key string) (*node, bool) {
+	n, ok := ns.shard(key).storage[key]
+	return n, ok
+}
+
+// lockKeys write locks shards of the keys in shard order so that
+// operations on several keys are atomic, returned function unlocks them.
+func (ns *namespace) lockKeys(keys ...string) func() {
+	seen := make(map[int]bool)
+	var indexes []int
+	for _, key := range keys {
+		i := ns.shardIndex(key)
+		if !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return ns.lockShards(indexes)
+}
+
+// lockAll write locks all shards.
+func (ns *namespace) lockAll() func() {
+	indexes := make([]int, len(ns.shards))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return ns.lockShards(indexes)
+}
+
+func (ns *namespace) lockShards(indexes []int) func() {
+	for _, i := range indexes {
+		ns.shards[i].lock.Lock()
+	}
+	return func() {
+		for j := len(indexes) - 1; j >= 0; j-- {
+			ns.shards[indexes[j]].lock.Unlock()
+		}
+	}
+}
+
+// reserveMemory accounts memory growth of the change before it is
+// applied failing if it exceeds memory limit, so that concurrent changes
+// in different shards can not exceed the limit together. Reservation is
+// released with releaseMemory once the change is applied.
+func (ns *namespace) reserveMemory(delta int64) bool {
+	if delta <= 0 {
+		return true
+	}
+	for {
+		memory, limit := atomic.LoadInt64(&ns.memory), atomic.LoadInt64(&ns.maxMemory)
+		if limit > 0 && memory+delta > limit {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&ns.memory, memory, memory+delta) {
+			return true
+		}
+	}
+}
+
+func (ns *namespace) releaseMemory(delta int64) {
+	if delta > 0 {
+		atomic.AddInt64(&ns.memory, -delta)
+	}
+}
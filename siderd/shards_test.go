@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardsMemoryLimit(t *testing.T) {
+	ns := newNamespace("test", 10000)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ns.set(fmt.Sprintf("%d:%d", i, j), "value", 100, 0, setAlways)
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := ns.stats()
+	if stats.Memory > 10000 || stats.Keys == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	var memory int64
+	for _, s := range ns.shards {
+		for _, n := range s.storage {
+			memory += n.size
+		}
+	}
+	if memory != stats.Memory {
+		t.Fatalf("memory [%d] is not equal to size of values [%d]", stats.Memory, memory)
+	}
+}
+
+func TestShardsRename(t *testing.T) {
+	ns := newNamespace("test", 0)
+	ns.set("a", 1.0, 1, 0, setNew)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				ns.copy("a", "b", 0, true)
+				ns.copy("b", "a", 0, true)
+			}
+		}()
+	}
+	wg.Wait()
+	if keys := ns.stats().Keys; keys != 1 {
+		t.Fatalf("unexpected number of keys: %d", keys)
+	}
+}
+
+func benchmarkShards(b *testing.B, fn func(ns *namespace, key string)) {
+	for _, shards := range []int{1, defaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			defer func(n int) { shardCount = n }(shardCount)
+			shardCount = shards
+			ns := newNamespace("bench", 0)
+			for i := 0; i < 1000; i++ {
+				ns.set(strconv.Itoa(i), "value", 7, 0, setAlways)
+			}
+			var id uint64
+			b.RunParallel(func(pb *testing.PB) {
+				i := atomic.AddUint64(&id, 1) * 7919
+				for pb.Next() {
+					i++
+					fn(ns, strconv.FormatUint(i%1000, 10))
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkShards(b, func(ns *namespace, key string) {
+		ns.get(key)
+	})
+}
+
+func BenchmarkSet(b *testing.B) {
+	benchmarkShards(b, func(ns *namespace, key string) {
+		ns.set(key, "value", 7, 0, setAlways)
+	})
+}
+
+func BenchmarkMixed(b *testing.B) {
+	benchmarkShards(b, func(ns *namespace, key string) {
+		if key[len(key)-1] < '8' {
+			ns.get(key)
+			return
+		}
+		ns.set(key, "value", 7, 0, setAlways)
+	})
+}
@@ -1,101 +1,211 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 )
 
-type node struct {
-	done chan struct{}
-	data interface{}
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
-var (
-	storage map[string]*node = make(map[string]*node)
-	lock    sync.RWMutex
-)
+// httpError replies with json error body so that clients can tell
+// errors apart without parsing messages.
+func httpError(w http.ResponseWriter, message string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
 
 func set(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
-	var data interface{}
-	err := json.NewDecoder(r.Body).Decode(&data)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Parse request: %v", err), http.StatusBadRequest)
-		return
-	}
-	
-	lock.RLock()
-	_, ok := storage[key]
-	lock.RUnlock()
-	
-	if ok {
-		http.Error(w, "Key already exists", http.StatusConflict)
-		return
-	}
-
-	lock.Lock()
-	defer lock.Unlock()
-	var done chan struct{}
-	if ttl != 0 {
-		log.Printf("Key: [%s] expires in: [%v].\n", key, ttl)
-		done = make(chan struct{})
-		go func(key string, done chan struct{}) {
-			select {
-			case <-time.After(ttl):
-				lock.Lock()
-				defer lock.Unlock()
-				delete(storage, key)
-				log.Printf("Expired: [%s].\n", key)
-			case <-done:
-				log.Printf("Drop timer: [%s].\n", key)
-			}
-		}(key, done)
-	}
-
-	storage[key] = &node{done: done, data: data}
+	store(w, r, key, ttl, setNew)
+}
+
+// put stores value replacing existing one.
+func put(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	store(w, r, key, ttl, setAlways)
+}
+
+func store(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration, mode setMode) {
+	data, size, ok := readValue(w, r)
+	if !ok {
+		return
+	}
+
+	ns := namespaceOf(r)
+	err := ns.set(key, data, size, ttl, mode)
+	if ve, ok := err.(*validationError); ok {
+		validationFailed(w, ve)
+		return
+	}
+	switch err {
+	case nil:
+	case errExists:
+		httpError(w, "Key already exists", http.StatusConflict)
+		return
+	case errKeyTooLong, errValueTooLarge:
+		limitExceeded(w, err)
+		return
+	case errMemoryLimit:
+		httpError(w, fmt.Sprintf("Namespace [%s] memory limit exceeded.", ns.name), http.StatusInsufficientStorage)
+		return
+	}
 	log.Printf("Set: [%s].\n", key)
 }
 
+// get returns value of the key with its version in ETag header. Optional
+// wait parameter sets how long to wait for missing key to appear or, with
+// If-None-Match header, for the value to change.
 func get(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
-	lock.RLock()
-	defer lock.RUnlock()
-	v, ok := storage[key]
+	wait, ok := durationParam(r, "wait", maxWait)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad wait duration [%s].", r.FormValue("wait")), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	etag := r.Header.Get("If-None-Match")
+	v, ok := namespaceOf(r).getWait(ctx, key, etag)
 	if !ok {
-		http.Error(w, fmt.Sprintf("Key [%s] not found.", key), http.StatusNotFound)
+		httpError(w, fmt.Sprintf("Key [%s] not found.", key), http.StatusNotFound)
 		return
 	}
-	json.NewEncoder(w).Encode(v.data)
+	w.Header().Set("ETag", v.etag())
+	if etag != "" && v.etag() == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeValue(w, r, v)
 	log.Printf("Get: [%s].\n", key)
 }
 
-func del(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
-	lock.Lock()
-	defer lock.Unlock()
-	v, ok := storage[key]
-	if !ok {
+func exists(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	if _, ok := namespaceOf(r).get(key); !ok {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func rename(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	copyKey(w, r, key, ttl, true)
+}
+
+func duplicate(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	copyKey(w, r, key, ttl, false)
+}
+
+func copyKey(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration, move bool) {
+	dst := r.FormValue("to")
+	if dst == "" || strings.Contains(dst, "/") {
+		httpError(w, fmt.Sprintf("Bad destination key [%s].", dst), http.StatusBadRequest)
 		return
 	}
-	if v.done != nil {
-		close(v.done)
+	ns := namespaceOf(r)
+	if !permitted(r, opWrite, ns.name, dst) {
+		httpError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if r.FormValue("persist") == "true" {
+		ttl = -1
+	}
+	err := ns.copy(key, dst, ttl, move)
+	if ve, ok := err.(*validationError); ok {
+		validationFailed(w, ve)
+		return
+	}
+	switch err {
+	case nil:
+	case errNotFound:
+		httpError(w, fmt.Sprintf("Key [%s] not found.", key), http.StatusNotFound)
+		return
+	case errExists:
+		httpError(w, "Key already exists", http.StatusConflict)
+		return
+	case errKeyTooLong, errValueTooLarge:
+		limitExceeded(w, err)
+		return
+	case errMemoryLimit:
+		httpError(w, fmt.Sprintf("Namespace [%s] memory limit exceeded.", ns.name), http.StatusInsufficientStorage)
+		return
+	}
+	if move {
+		log.Printf("Rename: [%s] to [%s].\n", key, dst)
+	} else {
+		log.Printf("Copy: [%s] to [%s].\n", key, dst)
+	}
+}
+
+func del(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	if !namespaceOf(r).del(key) {
+		return
 	}
-	delete(storage, key)
 	log.Printf("Del: [%s].\n", key)
 }
 
 func list(w http.ResponseWriter, r *http.Request) {
-	var list []string = []string{}
-	lock.RLock()
-	defer lock.RUnlock()
-	for k, _ := range storage {
-		list = append(list, k)
-		select {
-		case <-r.Context().Done():
+	ns := namespaceOf(r)
+	list, err := ns.keys(r.Context(), func(k string) bool {
+		return permitted(r, opRead, ns.name, k)
+	})
+	if err != nil {
+		return
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func flush(w http.ResponseWriter, r *http.Request) {
+	namespaceOf(r).flush()
+}
+
+func flushAllHandler(w http.ResponseWriter, r *http.Request) {
+	flushAll()
+}
+
+func listNamespaces(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for _, name := range namespaceNames() {
+		if permitted(r, opRead, name, "") {
+			names = append(names, name)
+		}
+	}
+	json.NewEncoder(w).Encode(names)
+}
+
+func createNamespaceHandler(w http.ResponseWriter, r *http.Request, name string) {
+	var maxMemory int64
+	if s := r.FormValue("max-memory"); s != "" {
+		var err error
+		maxMemory, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || maxMemory < 0 {
+			httpError(w, fmt.Sprintf("Bad memory limit [%s].", s), http.StatusBadRequest)
 			return
-		default:
 		}
 	}
-	json.NewEncoder(w).Encode(list)
+	if _, err := createNamespace(name, maxMemory); err != nil {
+		httpError(w, fmt.Sprintf("Namespace [%s] already exists.", name), http.StatusConflict)
+	}
+}
+
+func dropNamespaceHandler(w http.ResponseWriter, r *http.Request, name string) {
+	if name == defaultNamespace {
+		httpError(w, "Default namespace can not be dropped.", http.StatusBadRequest)
+		return
+	}
+	dropNamespace(name)
+}
+
+func namespaceStats(w http.ResponseWriter, r *http.Request, name string) {
+	ns, ok := lookupNamespace(name)
+	if !ok {
+		httpError(w, fmt.Sprintf("Namespace [%s] not found.", name), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(ns.stats())
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"github.com/aandryashin/sider/siderd/client"
 	"github.com/pborman/uuid"
 	"net/http/httptest"
@@ -11,6 +12,20 @@ import (
 	"time"
 )
 
+func defaultNS() *namespace {
+	ns, _ := lookupNamespace(defaultNamespace)
+	return ns
+}
+
+func stored(key string) bool {
+	_, ok := defaultNS().get(key)
+	return ok
+}
+
+func cleanup(key string) {
+	defaultNS().del(key)
+}
+
 func TestSet(t *testing.T) {
 	server := httptest.NewServer(handler())
 	defer server.Close()
@@ -21,16 +36,12 @@ func TestSet(t *testing.T) {
 	if err != nil {
 		t.Fatalf("client: %v", err)
 	}
-	lock.RLock()
-	_, ok := storage[key]
-	lock.RUnlock()
+	ok := stored(key)
 	if !ok {
 		t.Fatalf("key not found")
 	}
 
-	lock.Lock()
-	defer lock.Unlock()
-	delete(storage, key)
+	cleanup(key)
 }
 
 func TestSetDuplicate(t *testing.T) {
@@ -49,16 +60,12 @@ func TestSetDuplicate(t *testing.T) {
 		t.Fatalf("possible duplicate key key")
 	}
 	
-	lock.RLock()
-	_, ok := storage[key]
-	lock.RUnlock()
+	ok := stored(key)
 	if !ok {
 		t.Fatalf("key not found")
 	}
 
-	lock.Lock()
-	defer lock.Unlock()
-	delete(storage, key)
+	cleanup(key)
 }
 
 
@@ -75,9 +82,7 @@ func TestSetExpiration(t *testing.T) {
 
 	<-time.After(100 * time.Millisecond)
 
-	lock.RLock()
-	_, ok := storage[key]
-	lock.RUnlock()
+	ok := stored(key)
 	if ok {
 		t.Fatalf("key is not expired")
 	}
@@ -230,3 +235,168 @@ func TestDelDropTimer(t *testing.T) {
 		t.Fatalf("del: %v", err)
 	}
 }
+
+func TestExists(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	key := uuid.New()
+	ok, err := cl.Exists(context.Background(), key)
+	if err != nil {
+		t.Fatalf("exists: %v", err)
+	}
+	if ok {
+		t.Fatalf("unexpected key")
+	}
+
+	err = cl.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	defer cleanup(key)
+
+	ok, err = cl.Exists(context.Background(), key)
+	if err != nil {
+		t.Fatalf("exists: %v", err)
+	}
+	if !ok {
+		t.Fatalf("key not found")
+	}
+}
+
+func TestRename(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	src, dst := uuid.New(), uuid.New()
+	err := cl.Set(context.Background(), src, bytes.NewReader([]byte("{}")), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	err = cl.Rename(context.Background(), src, dst, 0)
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if stored(src) {
+		t.Fatalf("source key exists after rename")
+	}
+	if !stored(dst) {
+		t.Fatalf("destination key not found")
+	}
+
+	<-time.After(100 * time.Millisecond)
+
+	if stored(dst) {
+		t.Fatalf("expiration is not preserved")
+	}
+}
+
+func TestRenameMissing(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	err := cl.Rename(context.Background(), uuid.New(), uuid.New(), 0)
+	if err == nil {
+		t.Fatalf("missing key renamed")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	src, dst := uuid.New(), uuid.New()
+	err := cl.Set(context.Background(), src, bytes.NewReader([]byte("{}")), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	err = cl.Copy(context.Background(), src, dst, client.Persist)
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	defer cleanup(dst)
+
+	err = cl.Copy(context.Background(), src, dst, 0)
+	if err == nil {
+		t.Fatalf("copy to existing key")
+	}
+
+	<-time.After(100 * time.Millisecond)
+
+	if stored(src) {
+		t.Fatalf("source key is not expired")
+	}
+	if !stored(dst) {
+		t.Fatalf("persistent copy expired")
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+
+	cl := client.NewClient(server.URL)
+	key := uuid.New()
+	err := cl.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	err = cl.FlushAll(context.Background())
+	if err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if stored(key) {
+		t.Fatalf("key exists after flush")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+
+	key := uuid.New()
+	_, err := cl.Get(context.Background(), key)
+	var e *client.Error
+	if !errors.Is(err, client.ErrNotFound) || !errors.As(err, &e) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.StatusCode != 404 || e.Message != "Key ["+key+"] not found." {
+		t.Fatalf("unexpected error: %#v", e)
+	}
+
+	defer cleanup(key)
+	cl.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	err = cl.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+	if !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestEscapedKeys(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL, client.WithNamespace(defaultNamespace))
+
+	prefix := uuid.New()
+	for _, key := range []string{prefix + "/a", prefix + "?a", prefix + "#a", prefix + "//a", prefix + "%2Fa"} {
+		defer cleanup(key)
+		err := cl.Set(context.Background(), key, bytes.NewReader([]byte("{}")), 0)
+		if err != nil {
+			t.Fatalf("set [%s]: %v", key, err)
+		}
+		if !stored(key) {
+			t.Fatalf("key [%s] is not stored", key)
+		}
+		if _, err := cl.Get(context.Background(), key); err != nil {
+			t.Fatalf("get [%s]: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,799 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStreamCount = 100
+	maxStreamCount     = 10000
+)
+
+var (
+	errBadEntryID    = errors.New("bad entry id")
+	errGroupNotFound = errors.New("consumer group not found")
+)
+
+// entryID is stream entry id made of append time in milliseconds and
+// sequence number of the entry appended in the same millisecond.
+type entryID struct {
+	ms  uint64
+	seq uint64
+}
+
+var maxEntryID = entryID{math.MaxUint64, math.MaxUint64}
+
+func (id entryID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+// next returns the least id greater than id.
+func (id entryID) next() entryID {
+	if id.seq == math.MaxUint64 {
+		return entryID{id.ms + 1, 0}
+	}
+	return entryID{id.ms, id.seq + 1}
+}
+
+func (id entryID) less(other entryID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// parseEntryID parses <ms>-<seq> id, sequence number is zero if it is
+// omitted.
+func parseEntryID(s string) (entryID, error) {
+	fragments := strings.SplitN(s, "-", 2)
+	ms, err := strconv.ParseUint(fragments[0], 10, 64)
+	if err != nil {
+		return entryID{}, errBadEntryID
+	}
+	var seq uint64
+	if len(fragments) == 2 {
+		seq, err = strconv.ParseUint(fragments[1], 10, 64)
+		if err != nil {
+			return entryID{}, errBadEntryID
+		}
+	}
+	return entryID{ms, seq}, nil
+}
+
+func (id entryID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(id.String())
+}
+
+func (id *entryID) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	var err error
+	*id, err = parseEntryID(s)
+	return err
+}
+
+type streamEntry struct {
+	ID    entryID         `json:"id"`
+	Value json.RawMessage `json:"value"`
+}
+
+// size returns memory used by the entry, id is two 64 bit numbers.
+func (e streamEntry) size() int64 {
+	return int64(len(e.Value)) + 16
+}
+
+type pendingEntry struct {
+	ID         entryID   `json:"id"`
+	Consumer   string    `json:"consumer"`
+	Delivered  time.Time `json:"delivered"`
+	Deliveries int       `json:"deliveries"`
+}
+
+// consumerGroup delivers every entry to one of its consumers, delivered
+// entries are pending until acknowledged.
+type consumerGroup struct {
+	last    entryID
+	pending map[entryID]*pendingEntry
+}
+
+type stream struct {
+	entries []streamEntry
+	// size is memory used by entries accounted in namespace memory.
+	size   int64
+	last   entryID
+	groups map[string]*consumerGroup
+	// appended is closed when entry is appended to wake up readers.
+	appended chan struct{}
+}
+
+type groupInfo struct {
+	Name          string  `json:"name"`
+	LastDelivered entryID `json:"last_delivered"`
+	Pending       int     `json:"pending"`
+}
+
+type streamInfo struct {
+	Key     string      `json:"key"`
+	Length  int         `json:"length"`
+	FirstID *entryID    `json:"first_id,omitempty"`
+	LastID  entryID     `json:"last_id"`
+	Groups  []groupInfo `json:"groups"`
+}
+
+type pendingInfo struct {
+	ID         entryID `json:"id"`
+	Consumer   string  `json:"consumer"`
+	Idle       string  `json:"idle"`
+	Deliveries int     `json:"deliveries"`
+}
+
+// streamRecord is dumped value of the stream.
+type streamRecord struct {
+	Entries []streamEntry          `json:"entries"`
+	Last    entryID                `json:"last"`
+	Groups  map[string]groupRecord `json:"groups,omitempty"`
+}
+
+type groupRecord struct {
+	Last    entryID        `json:"last_delivered"`
+	Pending []pendingEntry `json:"pending,omitempty"`
+}
+
+func newStream() *stream {
+	return &stream{groups: make(map[string]*consumerGroup), appended: make(chan struct{})}
+}
+
+// search returns index of the first entry with id not less than id.
+func (s *stream) search(id entryID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].ID.less(id)
+	})
+}
+
+// between returns at most count entries with ids from start to end
+// inclusive.
+func (s *stream) between(start entryID, end entryID, count int) []streamEntry {
+	entries := []streamEntry{}
+	for i := s.search(start); i < len(s.entries) && len(entries) < count; i++ {
+		if end.less(s.entries[i].ID) {
+			break
+		}
+		entries = append(entries, s.entries[i])
+	}
+	return entries
+}
+
+// lookup returns entry by id if it is not trimmed.
+func (s *stream) lookup(id entryID) (streamEntry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return streamEntry{}, false
+}
+
+// trim removes oldest entries keeping at most maxLen ones and ones not
+// older than maxAge, zero values disable limit.
+func (s *stream) trim(maxLen int, maxAge time.Duration) int {
+	n := 0
+	if maxLen > 0 && len(s.entries) > maxLen {
+		n = len(s.entries) - maxLen
+	}
+	if maxAge > 0 {
+		oldest := entryID{ms: uint64(time.Now().Add(-maxAge).UnixMilli())}
+		if i := s.search(oldest); i > n {
+			n = i
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	for i := range s.entries[:n] {
+		s.size -= s.entries[i].size()
+		s.entries[i] = streamEntry{}
+	}
+	s.entries = s.entries[n:]
+	// trimmed entries are reclaimed when append grows the slice, large
+	// trims are compacted right away.
+	if n >= len(s.entries) {
+		s.entries = append([]streamEntry(nil), s.entries...)
+	}
+	return n
+}
+
+// stream returns existing stream or creates empty one, must be called
+// with stream lock held.
+func (ns *namespace) stream(key string) *stream {
+	s, ok := ns.streams[key]
+	if !ok {
+		s = newStream()
+		ns.streams[key] = s
+		ns.streamCreated()
+	}
+	return s
+}
+
+// streamCreated wakes up readers waiting for missing streams, must be
+// called with stream lock held.
+func (ns *namespace) streamCreated() {
+	close(ns.streamsChanged)
+	ns.streamsChanged = make(chan struct{})
+}
+
+// appendEntry appends value to the stream trimming it to maxLen, entries
+// are accounted in namespace memory until they are trimmed.
+func (ns *namespace) appendEntry(key string, value json.RawMessage, maxLen int) (entryID, error) {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	e := streamEntry{Value: value}
+	if !ns.reserveMemory(e.size()) {
+		return entryID{}, errMemoryLimit
+	}
+	s := ns.stream(key)
+	e.ID = entryID{ms: uint64(time.Now().UnixMilli())}
+	if !s.last.less(e.ID) {
+		e.ID = s.last.next()
+	}
+	s.entries = append(s.entries, e)
+	s.size += e.size()
+	s.last = e.ID
+	ns.trim(s, maxLen, 0)
+	close(s.appended)
+	s.appended = make(chan struct{})
+	return e.ID, nil
+}
+
+// trim trims the stream releasing memory of trimmed entries, must be
+// called with stream lock held.
+func (ns *namespace) trim(s *stream, maxLen int, maxAge time.Duration) int {
+	size := s.size
+	n := s.trim(maxLen, maxAge)
+	ns.releaseMemory(size - s.size)
+	return n
+}
+
+// waitEntries calls fn until it returns entries or ctx is done, fn is
+// called with stream lock held and nil stream if it does not exist.
+func (ns *namespace) waitEntries(ctx context.Context, key string, fn func(*stream) ([]streamEntry, error)) ([]streamEntry, error) {
+	for {
+		ns.streamLock.Lock()
+		s, ok := ns.streams[key]
+		entries, err := fn(s)
+		if err != nil || len(entries) > 0 || ctx.Err() != nil {
+			ns.streamLock.Unlock()
+			return entries, err
+		}
+		changed := ns.streamsChanged
+		if ok {
+			changed = s.appended
+		}
+		ns.streamLock.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (ns *namespace) rangeEntries(ctx context.Context, key string, start entryID, end entryID, count int) ([]streamEntry, error) {
+	return ns.waitEntries(ctx, key, func(s *stream) ([]streamEntry, error) {
+		if s == nil {
+			return []streamEntry{}, nil
+		}
+		return s.between(start, end, count), nil
+	})
+}
+
+// readGroup delivers entries not delivered to the group yet to consumer.
+func (ns *namespace) readGroup(ctx context.Context, key string, group string, consumer string, count int) ([]streamEntry, error) {
+	return ns.waitEntries(ctx, key, func(s *stream) ([]streamEntry, error) {
+		if s == nil {
+			return nil, errGroupNotFound
+		}
+		g, ok := s.groups[group]
+		if !ok {
+			return nil, errGroupNotFound
+		}
+		entries := s.between(g.last.next(), maxEntryID, count)
+		now := time.Now()
+		for _, e := range entries {
+			g.pending[e.ID] = &pendingEntry{ID: e.ID, Consumer: consumer, Delivered: now, Deliveries: 1}
+			g.last = e.ID
+		}
+		return entries, nil
+	})
+}
+
+// createGroup creates consumer group delivering entries after start,
+// nil start means entries appended after group creation.
+func (ns *namespace) createGroup(key string, group string, start *entryID) error {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	s := ns.stream(key)
+	if _, ok := s.groups[group]; ok {
+		return errExists
+	}
+	g := &consumerGroup{last: s.last, pending: make(map[entryID]*pendingEntry)}
+	if start != nil {
+		g.last = *start
+	}
+	s.groups[group] = g
+	return nil
+}
+
+func (ns *namespace) dropGroup(key string, group string) bool {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	s, ok := ns.streams[key]
+	if !ok {
+		return false
+	}
+	if _, ok := s.groups[group]; !ok {
+		return false
+	}
+	delete(s.groups, group)
+	return true
+}
+
+// group returns consumer group of the stream, must be called with
+// stream lock held.
+func (ns *namespace) group(key string, group string) (*stream, *consumerGroup, error) {
+	s, ok := ns.streams[key]
+	if !ok {
+		return nil, nil, errGroupNotFound
+	}
+	g, ok := s.groups[group]
+	if !ok {
+		return nil, nil, errGroupNotFound
+	}
+	return s, g, nil
+}
+
+func (ns *namespace) ackEntries(key string, group string, ids []entryID) (int, error) {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	_, g, err := ns.group(key, group)
+	if err != nil {
+		return 0, err
+	}
+	acked := 0
+	for _, id := range ids {
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			acked++
+		}
+	}
+	return acked, nil
+}
+
+// claim transfers at most count entries pending longer than minIdle to
+// consumer, pending entries which were trimmed are dropped.
+func (ns *namespace) claim(key string, group string, consumer string, minIdle time.Duration, count int) ([]streamEntry, error) {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	s, g, err := ns.group(key, group)
+	if err != nil {
+		return nil, err
+	}
+	entries := []streamEntry{}
+	now := time.Now()
+	for _, p := range sortedPending(g) {
+		if len(entries) == count {
+			break
+		}
+		if now.Sub(p.Delivered) < minIdle {
+			continue
+		}
+		e, ok := s.lookup(p.ID)
+		if !ok {
+			delete(g.pending, p.ID)
+			continue
+		}
+		p.Consumer, p.Delivered = consumer, now
+		p.Deliveries++
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func sortedPending(g *consumerGroup) []*pendingEntry {
+	pending := []*pendingEntry{}
+	for _, p := range g.pending {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ID.less(pending[j].ID)
+	})
+	return pending
+}
+
+func (ns *namespace) pending(key string, group string) ([]pendingInfo, error) {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	_, g, err := ns.group(key, group)
+	if err != nil {
+		return nil, err
+	}
+	list := []pendingInfo{}
+	for _, p := range sortedPending(g) {
+		list = append(list, pendingInfo{ID: p.ID, Consumer: p.Consumer, Idle: time.Since(p.Delivered).String(), Deliveries: p.Deliveries})
+	}
+	return list, nil
+}
+
+func (ns *namespace) trimStream(key string, maxLen int, maxAge time.Duration) (int, bool) {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	s, ok := ns.streams[key]
+	if !ok {
+		return 0, false
+	}
+	return ns.trim(s, maxLen, maxAge), true
+}
+
+func (ns *namespace) streamInfo(key string) (streamInfo, bool) {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	s, ok := ns.streams[key]
+	if !ok {
+		return streamInfo{}, false
+	}
+	info := streamInfo{Key: key, Length: len(s.entries), LastID: s.last, Groups: []groupInfo{}}
+	if len(s.entries) > 0 {
+		info.FirstID = &s.entries[0].ID
+	}
+	for name, g := range s.groups {
+		info.Groups = append(info.Groups, groupInfo{Name: name, LastDelivered: g.last, Pending: len(g.pending)})
+	}
+	sort.Slice(info.Groups, func(i, j int) bool {
+		return info.Groups[i].Name < info.Groups[j].Name
+	})
+	return info, true
+}
+
+func (ns *namespace) dropStream(key string) bool {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	s, ok := ns.streams[key]
+	if !ok {
+		return false
+	}
+	delete(ns.streams, key)
+	ns.releaseMemory(s.size)
+	close(s.appended)
+	return true
+}
+
+// flushStreams drops all streams waking up their readers.
+func (ns *namespace) flushStreams() {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	for _, s := range ns.streams {
+		ns.releaseMemory(s.size)
+		close(s.appended)
+	}
+	ns.streams = make(map[string]*stream)
+}
+
+// streamRecords returns dumped values of all streams by key.
+func (ns *namespace) streamRecords() ([]string, map[string]streamRecord) {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	keys := []string{}
+	records := make(map[string]streamRecord)
+	for key, s := range ns.streams {
+		rec := streamRecord{Entries: append([]streamEntry{}, s.entries...), Last: s.last}
+		if len(s.groups) > 0 {
+			rec.Groups = make(map[string]groupRecord)
+		}
+		for name, g := range s.groups {
+			gr := groupRecord{Last: g.last}
+			for _, p := range sortedPending(g) {
+				gr.Pending = append(gr.Pending, *p)
+			}
+			rec.Groups[name] = gr
+		}
+		keys = append(keys, key)
+		records[key] = rec
+	}
+	sort.Strings(keys)
+	return keys, records
+}
+
+func (ns *namespace) restoreStream(key string, rec streamRecord, mode setMode) error {
+	ns.streamLock.Lock()
+	defer ns.streamLock.Unlock()
+	old, ok := ns.streams[key]
+	if ok && mode == setNew {
+		return errExists
+	}
+	s := newStream()
+	s.entries, s.last = rec.Entries, rec.Last
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].ID.less(s.entries[j].ID)
+	})
+	if n := len(s.entries); n > 0 && s.last.less(s.entries[n-1].ID) {
+		s.last = s.entries[n-1].ID
+	}
+	for _, e := range s.entries {
+		s.size += e.size()
+	}
+	var size int64
+	if ok {
+		size = old.size
+	}
+	if !ns.reserveMemory(s.size - size) {
+		return errMemoryLimit
+	}
+	ns.releaseMemory(size - s.size)
+	for name, gr := range rec.Groups {
+		g := &consumerGroup{last: gr.Last, pending: make(map[entryID]*pendingEntry)}
+		for i := range gr.Pending {
+			p := gr.Pending[i]
+			g.pending[p.ID] = &p
+		}
+		s.groups[name] = g
+	}
+	ns.streams[key] = s
+	if ok {
+		close(old.appended)
+	} else {
+		ns.streamCreated()
+	}
+	return nil
+}
+
+// intParam parses optional non negative integer parameter, missing
+// parameter is def.
+func intParam(r *http.Request, name string, def int, max int) (int, bool) {
+	s := r.FormValue(name)
+	if s == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > max {
+		return 0, false
+	}
+	return n, true
+}
+
+// entryIDParam parses optional entry id parameter, missing parameter is
+// def.
+func entryIDParam(r *http.Request, name string, def entryID) (entryID, bool) {
+	s := r.FormValue(name)
+	if s == "" {
+		return def, true
+	}
+	id, err := parseEntryID(s)
+	return id, err == nil
+}
+
+func appendEntryHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	maxLen, ok := intParam(r, "maxlen", 0, math.MaxInt32)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad max length [%s].", r.FormValue("maxlen")), http.StatusBadRequest)
+		return
+	}
+	var value json.RawMessage
+	if _, ok := decodeValue(w, r, &value); !ok {
+		return
+	}
+	ns := namespaceOf(r)
+	id, err := ns.appendEntry(key, value, maxLen)
+	if err == errMemoryLimit {
+		httpError(w, fmt.Sprintf("Namespace [%s] memory limit exceeded.", ns.name), http.StatusInsufficientStorage)
+		return
+	}
+	json.NewEncoder(w).Encode(pushResult{ID: id.String()})
+	log.Printf("Append: [%s] entry: [%s].\n", key, id)
+}
+
+// readParams parses count and wait parameters of stream reads.
+func readParams(w http.ResponseWriter, r *http.Request) (int, context.Context, context.CancelFunc, bool) {
+	count, ok := intParam(r, "count", defaultStreamCount, maxStreamCount)
+	if !ok || count == 0 {
+		httpError(w, fmt.Sprintf("Bad count [%s].", r.FormValue("count")), http.StatusBadRequest)
+		return 0, nil, nil, false
+	}
+	wait, ok := durationParam(r, "wait", maxWait)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad wait duration [%s].", r.FormValue("wait")), http.StatusBadRequest)
+		return 0, nil, nil, false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	return count, ctx, cancel, true
+}
+
+// rangeHandler returns entries from start to end inclusive or entries
+// after given id, optional wait parameter sets how long to wait for
+// new entries when there are none.
+func rangeHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	start, ok1 := entryIDParam(r, "start", entryID{})
+	end, ok2 := entryIDParam(r, "end", maxEntryID)
+	after, ok3 := entryIDParam(r, "after", entryID{})
+	if !ok1 || !ok2 || !ok3 {
+		httpError(w, "Bad entry id.", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("after") != "" {
+		start = after.next()
+	}
+	count, ctx, cancel, ok := readParams(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+	entries, _ := namespaceOf(r).rangeEntries(ctx, key, start, end, count)
+	json.NewEncoder(w).Encode(entries)
+}
+
+func streamInfoHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	info, ok := namespaceOf(r).streamInfo(key)
+	if !ok {
+		httpError(w, fmt.Sprintf("Stream [%s] not found.", key), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
+
+func trimHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	maxLen, ok := intParam(r, "maxlen", 0, math.MaxInt32)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad max length [%s].", r.FormValue("maxlen")), http.StatusBadRequest)
+		return
+	}
+	maxAge, ok := durationParam(r, "maxage", math.MaxInt64)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad max age [%s].", r.FormValue("maxage")), http.StatusBadRequest)
+		return
+	}
+	trimmed, ok := namespaceOf(r).trimStream(key, maxLen, maxAge)
+	if !ok {
+		httpError(w, fmt.Sprintf("Stream [%s] not found.", key), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Trimmed int `json:"trimmed"`
+	}{trimmed})
+	log.Printf("Trim: [%s] entries: [%d].\n", key, trimmed)
+}
+
+func dropStreamHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	if !namespaceOf(r).dropStream(key) {
+		httpError(w, fmt.Sprintf("Stream [%s] not found.", key), http.StatusNotFound)
+		return
+	}
+	log.Printf("Drop stream: [%s].\n", key)
+}
+
+// groupError replies with error of consumer group operation.
+func groupError(w http.ResponseWriter, err error, key string, group string) {
+	switch err {
+	case errGroupNotFound:
+		httpError(w, fmt.Sprintf("Group [%s] not found in stream [%s].", group, key), http.StatusNotFound)
+	case errExists:
+		httpError(w, fmt.Sprintf("Group [%s] already exists in stream [%s].", group, key), http.StatusConflict)
+	default:
+		httpError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// createGroupHandler creates consumer group, start parameter is id of
+// the last entry considered delivered, 0 delivers all entries and
+// missing start delivers only new entries.
+func createGroupHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	group := r.FormValue("group")
+	if group == "" {
+		httpError(w, "Empty group.", http.StatusBadRequest)
+		return
+	}
+	var start *entryID
+	if s := r.FormValue("start"); s != "" {
+		id, err := parseEntryID(s)
+		if err != nil {
+			httpError(w, fmt.Sprintf("Bad entry id [%s].", s), http.StatusBadRequest)
+			return
+		}
+		start = &id
+	}
+	if err := namespaceOf(r).createGroup(key, group, start); err != nil {
+		groupError(w, err, key, group)
+		return
+	}
+	log.Printf("Create group: [%s] stream: [%s].\n", group, key)
+}
+
+func dropGroupHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	group := r.FormValue("group")
+	if !namespaceOf(r).dropGroup(key, group) {
+		groupError(w, errGroupNotFound, key, group)
+		return
+	}
+	log.Printf("Drop group: [%s] stream: [%s].\n", group, key)
+}
+
+func readGroupHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	group, consumer := r.FormValue("group"), r.FormValue("consumer")
+	if consumer == "" {
+		httpError(w, "Empty consumer.", http.StatusBadRequest)
+		return
+	}
+	count, ctx, cancel, ok := readParams(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+	entries, err := namespaceOf(r).readGroup(ctx, key, group, consumer, count)
+	if err != nil {
+		groupError(w, err, key, group)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ackEntriesHandler acknowledges entries given by repeated id parameter.
+func ackEntriesHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	group := r.FormValue("group")
+	var ids []entryID
+	for _, s := range r.Form["id"] {
+		id, err := parseEntryID(s)
+		if err != nil {
+			httpError(w, fmt.Sprintf("Bad entry id [%s].", s), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	acked, err := namespaceOf(r).ackEntries(key, group, ids)
+	if err != nil {
+		groupError(w, err, key, group)
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Acked int `json:"acked"`
+	}{acked})
+}
+
+// claimHandler transfers entries pending longer than min_idle to
+// consumer so that entries of failed consumers are processed.
+func claimHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	group, consumer := r.FormValue("group"), r.FormValue("consumer")
+	if consumer == "" {
+		httpError(w, "Empty consumer.", http.StatusBadRequest)
+		return
+	}
+	minIdle, ok := durationParam(r, "min_idle", math.MaxInt64)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad min idle duration [%s].", r.FormValue("min_idle")), http.StatusBadRequest)
+		return
+	}
+	count, ok := intParam(r, "count", defaultStreamCount, maxStreamCount)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad count [%s].", r.FormValue("count")), http.StatusBadRequest)
+		return
+	}
+	entries, err := namespaceOf(r).claim(key, group, consumer, minIdle, count)
+	if err != nil {
+		groupError(w, err, key, group)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+func pendingHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	group := r.FormValue("group")
+	list, err := namespaceOf(r).pending(key, group)
+	if err != nil {
+		groupError(w, err, key, group)
+		return
+	}
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	s := cl.Stream(uuid.New())
+	defer s.Drop(ctx)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		id, err := s.Append(ctx, strings.NewReader(fmt.Sprintf(`{"n": %d}`, i)), 0)
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		if len(ids) > 0 && parseID(t, id).less(parseID(t, ids[len(ids)-1]).next()) {
+			t.Fatalf("entry ids do not grow: %v, %s", ids, id)
+		}
+		ids = append(ids, id)
+	}
+
+	entries, err := s.Range(ctx, "", "", 0)
+	if err != nil {
+		t.Fatalf("range: %v", err)
+	}
+	if len(entries) != 5 || entries[0].ID != ids[0] || string(entries[4].Value) != `{"n":4}` {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	entries, err = s.Range(ctx, ids[1], ids[3], 2)
+	if err != nil {
+		t.Fatalf("range: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != ids[1] || entries[1].ID != ids[2] {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	entries, err = s.Read(ctx, ids[3], 0, 0)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != ids[4] {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	trimmed, err := s.Trim(ctx, 3, 0)
+	if err != nil {
+		t.Fatalf("trim: %v", err)
+	}
+	info, err := s.Info(ctx)
+	if err != nil {
+		t.Fatalf("info: %v", err)
+	}
+	if trimmed != 2 || info.Length != 3 || info.FirstID != ids[2] || info.LastID != ids[4] {
+		t.Fatalf("unexpected trim result: %d, %+v", trimmed, info)
+	}
+	if _, err := s.Append(ctx, strings.NewReader(`{}`), 2); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if info, _ := s.Info(ctx); info.Length != 2 {
+		t.Fatalf("stream is not trimmed on append: %+v", info)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if trimmed, _ := s.Trim(ctx, 0, time.Millisecond); trimmed != 2 {
+		t.Fatalf("stream is not trimmed by age: %d", trimmed)
+	}
+
+	if _, err := cl.Stream(uuid.New()).Info(ctx); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func parseID(t *testing.T, s string) entryID {
+	id, err := parseEntryID(s)
+	if err != nil {
+		t.Fatalf("parse entry id [%s]: %v", s, err)
+	}
+	return id
+}
+
+func TestStreamRead(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	s := cl.Stream(uuid.New())
+	defer s.Drop(ctx)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.Append(ctx, strings.NewReader(`"late"`), 0)
+	}()
+	start := time.Now()
+	entries, err := s.Read(ctx, "0", 0, time.Second)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(entries) != 1 || string(entries[0].Value) != `"late"` {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("reader is not woken up on append")
+	}
+	entries, err = s.Read(ctx, entries[0].ID, 0, 20*time.Millisecond)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("unexpected entries: %+v, %v", entries, err)
+	}
+}
+
+func TestStreamMissing(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	s := cl.Stream(uuid.New())
+	entries, err := s.Read(ctx, "0", 0, 20*time.Millisecond)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("unexpected entries: %+v, %v", entries, err)
+	}
+	if _, err := s.Range(ctx, "", "", 0); err != nil {
+		t.Fatalf("range: %v", err)
+	}
+	if _, err := s.Info(ctx); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("stream is created by read: %v", err)
+	}
+}
+
+func TestStreamTrim(t *testing.T) {
+	ns := newNamespace("test", 0)
+	for i := 0; i < 1000; i++ {
+		ns.appendEntry("stream", []byte(fmt.Sprint(i)), 10)
+	}
+	s := ns.streams["stream"]
+	if len(s.entries) != 10 || string(s.entries[0].Value) != "990" || cap(s.entries) > 100 {
+		t.Fatalf("unexpected entries: %d, %d, %s", len(s.entries), cap(s.entries), s.entries[0].Value)
+	}
+	if n := s.trim(2, 0); n != 8 || len(s.entries) != 2 || cap(s.entries) != 2 || string(s.entries[0].Value) != "998" {
+		t.Fatalf("unexpected trim: %d, %+v", n, s.entries)
+	}
+}
+
+func TestStreamMemory(t *testing.T) {
+	ns := newNamespace("test", 100)
+	for i := 0; i < 4; i++ {
+		if _, err := ns.appendEntry("stream", []byte(`"value"`), 0); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if _, err := ns.appendEntry("stream", []byte(`"value"`), 0); err != errMemoryLimit {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if memory := ns.stats().Memory; memory != 92 {
+		t.Fatalf("unexpected memory: %d", memory)
+	}
+	ns.trimStream("stream", 1, 0)
+	if memory := ns.stats().Memory; memory != 23 {
+		t.Fatalf("memory is not released on trim: %d", memory)
+	}
+	ns.dropStream("stream")
+	if memory := ns.stats().Memory; memory != 0 {
+		t.Fatalf("memory is not released on drop: %d", memory)
+	}
+}
+
+func TestStreamGroup(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	s := cl.Stream(uuid.New())
+	defer s.Drop(ctx)
+	old, err := s.Append(ctx, strings.NewReader(`"old"`), 0)
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := s.CreateGroup(ctx, "workers", ""); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if err := s.CreateGroup(ctx, "workers", ""); !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.CreateGroup(ctx, "audit", "0"); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if _, err := s.ReadGroup(ctx, "missing", "a", 0, 0); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, v := range []string{`1`, `2`, `3`} {
+		if _, err := s.Append(ctx, strings.NewReader(v), 0); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	a, err := s.ReadGroup(ctx, "workers", "a", 2, 0)
+	if err != nil {
+		t.Fatalf("read group: %v", err)
+	}
+	b, err := s.ReadGroup(ctx, "workers", "b", 0, 0)
+	if err != nil {
+		t.Fatalf("read group: %v", err)
+	}
+	if len(a) != 2 || len(b) != 1 || string(a[0].Value) != `1` || string(b[0].Value) != `3` {
+		t.Fatalf("unexpected delivery: %+v, %+v", a, b)
+	}
+	audit, err := s.ReadGroup(ctx, "audit", "c", 0, 0)
+	if err != nil {
+		t.Fatalf("read group: %v", err)
+	}
+	if len(audit) != 4 || audit[0].ID != old {
+		t.Fatalf("group does not start from the beginning: %+v", audit)
+	}
+
+	acked, err := s.Ack(ctx, "workers", a[0].ID, a[1].ID, "1-1")
+	if err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if acked != 2 {
+		t.Fatalf("unexpected acknowledged entries: %d", acked)
+	}
+	pending, err := s.Pending(ctx, "workers")
+	if err != nil {
+		t.Fatalf("pending: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != b[0].ID || pending[0].Consumer != "b" || pending[0].Deliveries != 1 {
+		t.Fatalf("unexpected pending entries: %+v", pending)
+	}
+
+	claimed, err := s.Claim(ctx, "workers", "a", time.Minute, 0)
+	if err != nil || len(claimed) != 0 {
+		t.Fatalf("entry is claimed before idle timeout: %+v, %v", claimed, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	claimed, err = s.Claim(ctx, "workers", "a", 5*time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != b[0].ID {
+		t.Fatalf("unexpected claimed entries: %+v", claimed)
+	}
+	pending, _ = s.Pending(ctx, "workers")
+	if len(pending) != 1 || pending[0].Consumer != "a" || pending[0].Deliveries != 2 {
+		t.Fatalf("unexpected pending entries: %+v", pending)
+	}
+
+	info, err := s.Info(ctx)
+	if err != nil {
+		t.Fatalf("info: %v", err)
+	}
+	if len(info.Groups) != 2 || info.Groups[1].Name != "workers" || info.Groups[1].Pending != 1 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if err := s.DropGroup(ctx, "audit"); err != nil {
+		t.Fatalf("drop group: %v", err)
+	}
+}
+
+func TestStreamDumpRestore(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	s := cl.Stream(key)
+	defer s.Drop(ctx)
+	s.Append(ctx, strings.NewReader(`1`), 0)
+	s.CreateGroup(ctx, "g", "0")
+	s.Append(ctx, strings.NewReader(`2`), 0)
+	delivered, err := s.ReadGroup(ctx, "g", "c", 1, 0)
+	if err != nil || len(delivered) != 1 {
+		t.Fatalf("read group: %+v, %v", delivered, err)
+	}
+
+	var buf bytes.Buffer
+	err = cl.Dump(ctx, &buf)
+	if err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"key":"`+key+`","type":"stream"`) {
+		t.Fatalf("stream is not dumped: %s", buf.String())
+	}
+	s.Drop(ctx)
+
+	_, err = cl.Restore(ctx, &buf, client.RestoreSkip)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	info, err := s.Info(ctx)
+	if err != nil {
+		t.Fatalf("info: %v", err)
+	}
+	if info.Length != 2 || len(info.Groups) != 1 || info.Groups[0].Pending != 1 {
+		t.Fatalf("unexpected restored stream: %+v", info)
+	}
+	id, err := s.Append(ctx, strings.NewReader(`3`), 0)
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if !parseID(t, info.LastID).less(parseID(t, id)) {
+		t.Fatalf("entry id does not grow after restore: %s, %s", info.LastID, id)
+	}
+	next, err := s.ReadGroup(ctx, "g", "c", 0, 0)
+	if err != nil || len(next) != 2 || string(next[0].Value) != `2` {
+		t.Fatalf("unexpected delivery after restore: %+v, %v", next, err)
+	}
+}
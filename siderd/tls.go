@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+var (
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+)
+
+type certificates struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	lock   sync.RWMutex
+	config *tls.Config
+}
+
+func (c *certificates) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if c.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in [%s]", c.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.config = config
+	return nil
+}
+
+func (c *certificates) current() *tls.Config {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config
+}
+
+func (c *certificates) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &c.current().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.current(), nil
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/aandryashin/sider/siderd/client"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type pair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func issue(t *testing.T, dir string, name string, parent *pair, template *x509.Certificate) *pair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return &pair{cert, key}
+}
+
+func pki(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pki")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	ca := issue(t, dir, "ca", nil, &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign})
+	issue(t, dir, "server", ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	issue(t, dir, "client", ca, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	return dir
+}
+
+func tlsServer(t *testing.T, certs *certificates) *httptest.Server {
+	if err := certs.load(); err != nil {
+		t.Fatalf("load certificates: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler())
+	server.TLS = certs.tlsConfig()
+	server.StartTLS()
+	return server
+}
+
+func tlsClient(t *testing.T, url string, ca, cert, key string) *client.Client {
+	config, err := client.NewTLSConfig(ca, cert, key)
+	if err != nil {
+		t.Fatalf("tls config: %v", err)
+	}
+	cl := client.NewClient(url)
+	cl.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	return cl
+}
+
+func TestTLS(t *testing.T) {
+	dir := pki(t)
+	defer os.RemoveAll(dir)
+
+	server := tlsServer(t, &certificates{
+		certFile: filepath.Join(dir, "server.crt"),
+		keyFile:  filepath.Join(dir, "server.key"),
+	})
+	defer server.Close()
+
+	cl := tlsClient(t, server.URL, filepath.Join(dir, "ca.crt"), "", "")
+	_, err := cl.Keys(context.Background())
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+
+	_, err = client.NewClient(server.URL).Keys(context.Background())
+	if err == nil {
+		t.Fatalf("untrusted server certificate accepted")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := pki(t)
+	defer os.RemoveAll(dir)
+
+	certs := &certificates{
+		certFile:     filepath.Join(dir, "server.crt"),
+		keyFile:      filepath.Join(dir, "server.key"),
+		clientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	server := tlsServer(t, certs)
+	defer server.Close()
+
+	cl := tlsClient(t, server.URL, filepath.Join(dir, "ca.crt"), filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	_, err := cl.Keys(context.Background())
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+
+	_, err = tlsClient(t, server.URL, filepath.Join(dir, "ca.crt"), "", "").Keys(context.Background())
+	if err == nil {
+		t.Fatalf("request without client certificate accepted")
+	}
+
+	os.Remove(filepath.Join(dir, "server.crt"))
+	if err := certs.load(); err == nil {
+		t.Fatalf("reload with missing certificate")
+	}
+	_, err = cl.Keys(context.Background())
+	if err != nil {
+		t.Fatalf("keys after failed reload: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type account struct {
+	Name  string
+	Roles []string
+	Seen  time.Time
+}
+
+func TestTypedAccessors(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	err := client.SetValue(ctx, cl, key, []int{1, 2, 3}, 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	err = client.SetValue(ctx, cl, key, []int{4}, 0)
+	if !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = client.PutValue(ctx, cl, key, []int{4, 5}, time.Minute)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	v, err := client.GetAs[[]int](ctx, cl, key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !reflect.DeepEqual(v, []int{4, 5}) {
+		t.Fatalf("unexpected value: %v", v)
+	}
+	if ttl, _ := defaultNS().ttl(key); ttl <= 0 {
+		t.Fatalf("ttl is not set: %v", ttl)
+	}
+	_, err = client.GetAs[string](ctx, cl, key)
+	if err == nil {
+		t.Fatalf("get with wrong type succeeded")
+	}
+}
+
+func TestBucket(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	seen := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, codec := range []client.Codec{client.JSONCodec, client.GobCodec} {
+		prefix := uuid.New() + ":"
+		users := client.NewBucket[account](cl, prefix, client.WithDefaultTTL(time.Minute), client.WithCodec(codec))
+		u := account{"alice", []string{"admin"}, seen}
+		defer cleanup(prefix + "alice")
+		defer cleanup(prefix + "bob")
+
+		err := users.Set(ctx, "alice", u)
+		if err != nil {
+			t.Fatalf("set: %v", err)
+		}
+		err = users.Set(ctx, "alice", u)
+		if err != nil {
+			t.Fatalf("overwrite: %v", err)
+		}
+		err = users.Add(ctx, "alice", u)
+		if !errors.Is(err, client.ErrConflict) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		err = users.SetTTL(ctx, "bob", account{Name: "bob"}, 0)
+		if err != nil {
+			t.Fatalf("set: %v", err)
+		}
+		got, err := users.Get(ctx, "alice")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if !reflect.DeepEqual(got, u) {
+			t.Fatalf("unexpected value: %v", got)
+		}
+		if ttl, _ := defaultNS().ttl(prefix + "alice"); ttl <= 0 {
+			t.Fatalf("default ttl is not set: %v", ttl)
+		}
+		if ttl, _ := defaultNS().ttl(prefix + "bob"); ttl != 0 {
+			t.Fatalf("unexpected ttl: %v", ttl)
+		}
+		keys, err := users.Keys(ctx)
+		sort.Strings(keys)
+		if err != nil || !reflect.DeepEqual(keys, []string{"alice", "bob"}) {
+			t.Fatalf("unexpected keys: %v, %v", keys, err)
+		}
+		err = users.Del(ctx, "bob")
+		if err != nil {
+			t.Fatalf("del: %v", err)
+		}
+		_, err = users.Get(ctx, "bob")
+		if !errors.Is(err, client.ErrNotFound) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errNotList   = errors.New("value is not a list")
+	errEmptyList = errors.New("list is empty")
+)
+
+type pushListResult struct {
+	Length int `json:"length"`
+}
+
+// etag returns quoted version of the value for ETag header.
+func (n *node) etag() string {
+	return strconv.Quote(strconv.FormatUint(n.cas, 10))
+}
+
+// waiter is closed on next change of the key, refs counts requests
+// waiting for it.
+type waiter struct {
+	ch   chan struct{}
+	refs int
+}
+
+// await calls fn with write lock of the key shard held until it reports
+// done or ctx is done, fn is called again after every change of the key.
+func (ns *namespace) await(ctx context.Context, key string, fn func() bool) bool {
+	s := ns.shard(key)
+	for {
+		s.lock.Lock()
+		if fn() {
+			s.lock.Unlock()
+			return true
+		}
+		w, ok := s.waiters[key]
+		if !ok {
+			w = &waiter{ch: make(chan struct{})}
+			s.waiters[key] = w
+		}
+		w.refs++
+		s.lock.Unlock()
+		select {
+		case <-w.ch:
+		case <-ctx.Done():
+			s.lock.Lock()
+			w.refs--
+			if w.refs == 0 && s.waiters[key] == w {
+				delete(s.waiters, key)
+			}
+			s.lock.Unlock()
+			return false
+		}
+	}
+}
+
+// getWait returns node of the key waiting until it exists or, if etag
+// is not empty, until its version differs from etag.
+func (ns *namespace) getWait(ctx context.Context, key string, etag string) (*node, bool) {
+	var n *node
+	var ok bool
+	s := ns.shard(key)
+	ready := func() bool {
+		n, ok = s.storage[key]
+		if etag == "" {
+			return ok
+		}
+		return !ok || n.etag() != etag
+	}
+	s.lock.RLock()
+	done := ready()
+	s.lock.RUnlock()
+	if !done && ctx.Err() == nil {
+		ns.await(ctx, key, ready)
+	}
+	if ok {
+		atomic.AddUint64(&ns.counters.Hits, 1)
+	} else {
+		atomic.AddUint64(&ns.counters.Misses, 1)
+	}
+	return n, ok
+}
+
+// pushList appends value to the list stored under the key creating
+// it if key does not exist, it returns new length of the list.
+func (ns *namespace) pushList(key string, value interface{}, size int64) (int, error) {
+	s := ns.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var length int
+	_, err := ns.update(key, func(data interface{}) (interface{}, int64, error) {
+		l, ok := data.([]interface{})
+		if !ok {
+			return nil, 0, errNotList
+		}
+		l = append(l[:len(l):len(l)], value)
+		length = len(l)
+		return l, listSize(l), nil
+	})
+	if err != errNotFound {
+		return length, err
+	}
+	if err := checkLimits(key, size+2); err != nil {
+		return 0, err
+	}
+	n := &node{data: []interface{}{value}, size: int64(len(key)) + size + 2}
+	if err := validate(ns.name, key, n.data); err != nil {
+		return 0, err
+	}
+	if !ns.reserveMemory(n.size) {
+		return 0, errMemoryLimit
+	}
+	defer ns.releaseMemory(n.size)
+	ns.insert(key, n, 0)
+	atomic.AddUint64(&ns.counters.Sets, 1)
+	ns.notify(eventSet, key)
+	return 1, nil
+}
+
+// popList removes first element of the list stored under the key
+// waiting for it if ctx allows.
+func (ns *namespace) popList(ctx context.Context, key string) (interface{}, error) {
+	var value interface{}
+	var err error
+	ns.await(ctx, key, func() bool {
+		_, err = ns.update(key, func(data interface{}) (interface{}, int64, error) {
+			l, ok := data.([]interface{})
+			switch {
+			case !ok:
+				return nil, 0, errNotList
+			case len(l) == 0:
+				return nil, 0, errEmptyList
+			}
+			value = l[0]
+			rest := append([]interface{}{}, l[1:]...)
+			return rest, listSize(rest), nil
+		})
+		return err != errNotFound && err != errEmptyList
+	})
+	return value, err
+}
+
+func listSize(l []interface{}) int64 {
+	b, _ := json.Marshal(l)
+	return int64(len(b))
+}
+
+func pushListHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	var value interface{}
+	size, ok := decodeValue(w, r, &value)
+	if !ok {
+		return
+	}
+	ns := namespaceOf(r)
+	length, err := ns.pushList(key, value, size)
+	if ve, ok := err.(*validationError); ok {
+		validationFailed(w, ve)
+		return
+	}
+	switch err {
+	case nil:
+	case errNotList:
+		httpError(w, fmt.Sprintf("Value of key [%s] is not a list.", key), http.StatusBadRequest)
+		return
+	case errKeyTooLong, errValueTooLarge:
+		limitExceeded(w, err)
+		return
+	case errMemoryLimit:
+		httpError(w, fmt.Sprintf("Namespace [%s] memory limit exceeded.", ns.name), http.StatusInsufficientStorage)
+		return
+	}
+	json.NewEncoder(w).Encode(pushListResult{Length: length})
+	log.Printf("Push: [%s].\n", key)
+}
+
+// popListHandler removes first element of the list, optional wait
+// parameter sets how long to wait for element when list is empty or
+// missing. Empty list responds with 204.
+func popListHandler(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration) {
+	wait, ok := durationParam(r, "wait", maxWait)
+	if !ok {
+		httpError(w, fmt.Sprintf("Bad wait duration [%s].", r.FormValue("wait")), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	ns := namespaceOf(r)
+	value, err := ns.popList(ctx, key)
+	if ve, ok := err.(*validationError); ok {
+		validationFailed(w, ve)
+		return
+	}
+	switch err {
+	case nil:
+	case errNotFound, errEmptyList:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case errNotList:
+		httpError(w, fmt.Sprintf("Value of key [%s] is not a list.", key), http.StatusBadRequest)
+		return
+	case errKeyTooLong, errValueTooLarge:
+		limitExceeded(w, err)
+		return
+	case errMemoryLimit:
+		httpError(w, fmt.Sprintf("Namespace [%s] memory limit exceeded.", ns.name), http.StatusInsufficientStorage)
+		return
+	}
+	json.NewEncoder(w).Encode(value)
+	log.Printf("Pop: [%s].\n", key)
+}
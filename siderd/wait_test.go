@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aandryashin/sider/siderd/client"
+	"github.com/pborman/uuid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitExists(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cl.Set(ctx, key, strings.NewReader(`"ready"`), 0)
+	}()
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	start := time.Now()
+	var v string
+	version, err := cl.Wait(wctx, key, "", &v)
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if v != "ready" || version == "" {
+		t.Fatalf("unexpected value: %s, %s", v, version)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("waiter is not woken up on set")
+	}
+	same, err := cl.Wait(wctx, key, "", &v)
+	if err != nil || same != version {
+		t.Fatalf("existing key version: %s, %v", same, err)
+	}
+}
+
+func TestWaitChange(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	cl.Set(ctx, key, strings.NewReader(`1`), 0)
+	var v int
+	version, err := cl.Wait(ctx, key, "", &v)
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if _, err := cl.Wait(wctx, key, version, &v); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unchanged value is returned: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cl.Put(ctx, key, strings.NewReader(`2`), 0)
+	}()
+	next, err := cl.Wait(ctx, key, version, &v)
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if v != 2 || next == version {
+		t.Fatalf("unexpected change: %d, %s", v, next)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cl.Del(ctx, key)
+	}()
+	if _, err := cl.Wait(ctx, key, next, &v); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("deletion is not reported: %v", err)
+	}
+}
+
+func TestWaitNotModified(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	cl.Set(ctx, key, strings.NewReader(`{}`), 0)
+	resp, err := http.Get(server.URL + "/keys/" + key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("missing etag")
+	}
+	r, _ := http.NewRequest(http.MethodGet, server.URL+"/keys/"+key+"?wait=20ms", nil)
+	r.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
+func TestWaitDisconnect(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+
+	key := uuid.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		var v interface{}
+		_, err := cl.Wait(ctx, key, "", &v)
+		done <- err
+	}()
+	ns := defaultNS()
+	waiting := func() bool {
+		s := ns.shard(key)
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		_, ok := s.waiters[key]
+		return ok
+	}
+	for i := 0; i < 100 && !waiting(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if !waiting() {
+		t.Fatalf("request is not waiting")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 100 && waiting(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if waiting() {
+		t.Fatalf("waiter is not removed on client disconnect")
+	}
+}
+
+func TestListPop(t *testing.T) {
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	cl := client.NewClient(server.URL)
+	ctx := context.Background()
+
+	key := uuid.New()
+	defer cleanup(key)
+	for i, v := range []string{`"a"`, `"b"`} {
+		n, err := cl.ListPush(ctx, key, strings.NewReader(v))
+		if err != nil {
+			t.Fatalf("push: %v", err)
+		}
+		if n != i+1 {
+			t.Fatalf("unexpected length: %d", n)
+		}
+	}
+	var v string
+	for _, expected := range []string{"a", "b"} {
+		ok, err := cl.ListPop(ctx, key, 0, &v)
+		if err != nil || !ok || v != expected {
+			t.Fatalf("unexpected pop: %s, %v, %v", v, ok, err)
+		}
+	}
+	ok, err := cl.ListPop(ctx, key, 10*time.Millisecond, &v)
+	if err != nil || ok {
+		t.Fatalf("element in empty list: %v, %v", ok, err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cl.ListPush(ctx, key, strings.NewReader(`"late"`))
+	}()
+	start := time.Now()
+	ok, err = cl.ListPop(ctx, key, time.Second, &v)
+	if err != nil || !ok || v != "late" {
+		t.Fatalf("unexpected pop: %s, %v, %v", v, ok, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("waiter is not woken up on push")
+	}
+
+	other := uuid.New()
+	defer cleanup(other)
+	cl.Set(ctx, other, strings.NewReader(`{}`), 0)
+	if _, err := cl.ListPush(ctx, other, strings.NewReader(`1`)); err == nil {
+		t.Fatalf("pushed to value which is not a list")
+	}
+	if _, err := cl.ListPop(ctx, other, 0, &v); err == nil {
+		t.Fatalf("popped from value which is not a list")
+	}
+}